@@ -0,0 +1,12 @@
+package main
+
+// The listenForCacheInvalidations() method applies the cache invalidations sent by the other instances of the API until the done channel is closed. If it
+// can't start listening, the error is logged and the cache relies on its entries expiring instead.
+func (app *application) listenForCacheInvalidations(done <-chan struct{}) {
+	err := app.cache.Listen(app.config.db.dsn, done, func(err error) {
+		app.logger.PrintError(err, nil)
+	})
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"cache": "listen"})
+	}
+}
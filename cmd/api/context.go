@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"net"
 	"net/http"
+	"time"
 )
 
 //Define a custom contextKey type, with the underlying type string
@@ -14,6 +16,9 @@ type contextKey string
 //We will use this constant as the key for getting and setting user information in the request context
 const userContextKey = contextKey("user")
 
+// connContextKey is the key for the connection that a request arrived on, which the server adds to every request context.
+const connContextKey = contextKey("conn")
+
 //The contextSetUser() method returns a new copy of the request with the provided, User struct added to the context
 //. Note that we use our userContextKey constant as the key.
 //
@@ -33,3 +38,13 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// The extendWriteDeadline() helper gives the response to a request another d to be written, replacing the server's WriteTimeout (which runs from the start
+// of the request). It does nothing if the connection isnt in the request context, as in tests which dont use our server.
+func (app *application) extendWriteDeadline(r *http.Request, d time.Duration) error {
+	conn, ok := r.Context().Value(connContextKey).(net.Conn)
+	if !ok {
+		return nil
+	}
+	return conn.SetWriteDeadline(time.Now().Add(d))
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
 	"net/http"
+	"strings"
 )
 
 // The logError() method is a generic helper for logging an error message. Later in the
@@ -37,12 +40,32 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 // The serverErrorResponse()  method will be used when our aapplication encounters aan unexpected problem at runtime . It logs the detailed error message,
 // then uses the errorResponse() helper to send a 500 internal server error status code and JSON response (containing a generic error message) to client
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// A query that was cancelled because the client went away isnt a problem with our application, so we hand it over to the requestCanceledResponse() helper
+	// instead of logging it as an error.
+	if errors.Is(err, data.ErrCanceled) {
+		app.requestCanceledResponse(w, r)
+		return
+	}
+
 	app.logError(r, err)
 
 	message := "the server encountered a problem and couldnt process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+// The requestCanceledResponse() method is used when a database query was abandoned because the request context was cancelled. The client has usually gone
+// away by this point, so we log the request at the INFO level with the nginx-style 499 status code and make a best-effort attempt at sending the same status.
+func (app *application) requestCanceledResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.PrintInfo("request canceled", map[string]string{
+		"request_method": r.Method,
+		"request_url":    r.URL.String(),
+		"status":         "499",
+	})
+
+	message := "the request was canceled before it could be completed"
+	app.errorResponse(w, r, 499, message)
+}
+
 // The notFoundResponse() method will be used to send a 404 not found status code and JSON response to the client.
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "The requested resource couldnt be found."
@@ -69,6 +92,43 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// The preconditionFailedResponse() method is used when the If-Match header of a request to change a movie doesnt match the movie's current ETag, because
+// it has been changed since the client read it.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the movie has been changed since you read it, fetch it again and retry your changes"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// The preconditionRequiredResponse() method is used when a request to change a movie has no If-Match header and the -require-if-match flag is set.
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request must have an If-Match header with the ETag of the movie"
+	app.errorResponse(w, r, http.StatusPreconditionRequired, message)
+}
+
+// The unsupportedMediaTypeResponse() method is used when the Content-Type of a request body isnt one of the types that the endpoint accepts.
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the Content-Type header must be one of: %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// The notAcceptableResponse() method is used when none of the media types in the Accept header can be produced by the endpoint.
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the Accept header must allow one of: %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, message)
+}
+
+// The duplicateMovieResponse() method is used when a new or changed movie looks like a duplicate of other movies. The ids of those movies are sent with
+// the error message, so that the client can show them to the user before they decide whether to save the movie anyway.
+func (app *application) duplicateMovieResponse(w http.ResponseWriter, r *http.Request, ids []int64) {
+	message := "the movie appears to duplicate other movies, send the request again with force=true to save it anyway"
+
+	err := app.writeJSON(w, http.StatusConflict, envelope{"error": message, "duplicate_ids": ids}, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"net/http"
+	"strings"
+)
+
+// Define the errors returned by checkIfMatch(), which the handlers turn into 412 Precondition Failed and 428 Precondition Required responses.
+var (
+	errPreconditionFailed   = errors.New("the If-Match header doesnt match the current version")
+	errPreconditionRequired = errors.New("the If-Match header is required")
+)
+
+// movieVersionTag returns the part of a movie's entity tag which is made from its id and version, and so changes whenever the movie is updated. The If-Match
+// header of a request to change a movie is checked against this part only, so that clients can make their changes conditional on nobody else having
+// changed the movie since they read it, whatever representation of the movie they read.
+func movieVersionTag(movie *data.Movie) string {
+	return fmt.Sprintf("%d-%d", movie.ID, movie.Version)
+}
+
+// representationETag returns a strong entity tag for a response body, made from the given tag (if there is one) and a hash of the body. The hash covers
+// everything in the body, like the rating of a movie (which changes without its version changing) and the language and runtime format it was written in.
+func representationETag(tag string, body []byte) string {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:16])
+
+	if tag == "" {
+		return `"` + hash + `"`
+	}
+	return `"` + tag + "-" + hash + `"`
+}
+
+// etagsMatch reports whether any of the entity tags in an If-Match or If-None-Match header is "*" or satisfies match. If-Match uses the strong comparison,
+// where weak tags (with a W/ prefix) never match, and If-None-Match uses the weak comparison, where the prefix is ignored.
+func etagsMatch(header []string, weak bool, match func(etag string) bool) bool {
+	for _, value := range header {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+
+			if tag == "*" {
+				return true
+			}
+			if strings.HasPrefix(tag, "W/") {
+				if !weak {
+					continue
+				}
+				tag = strings.TrimPrefix(tag, "W/")
+			}
+			if match(tag) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// The checkIfMatch() helper checks the If-Match header of a request to change a movie against the movie's current version. An entity tag matches if it was
+// sent with this version of the movie in any representation. It returns errPreconditionFailed if none match, and errPreconditionRequired if there is no
+// If-Match header but the -require-if-match flag is set.
+func (app *application) checkIfMatch(r *http.Request, movie *data.Movie) error {
+	ifMatch := r.Header.Values("If-Match")
+
+	if len(ifMatch) == 0 {
+		if app.config.requireIfMatch {
+			return errPreconditionRequired
+		}
+		return nil
+	}
+
+	version := `"` + movieVersionTag(movie)
+
+	matched := etagsMatch(ifMatch, false, func(etag string) bool {
+		return etag == version+`"` || strings.HasPrefix(etag, version+"-")
+	})
+	if !matched {
+		return errPreconditionFailed
+	}
+
+	return nil
+}
+
+// The writeConditionalJSON() helper sends a JSON response in the same way as writeJSON(), along with an ETag header made from tag and the body by
+// representationETag(). If a GET request for a 200 OK response has an If-None-Match header which matches the entity tag, a 304 Not Modified response is
+// sent without the body instead.
+func (app *application) writeConditionalJSON(w http.ResponseWriter, r *http.Request, status int, env envelope, headers http.Header, tag string) error {
+	js, err := encodeJSON(w, env)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	etag := representationETag(tag, js)
+	w.Header().Set("ETag", etag)
+
+	if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		notModified := etagsMatch(r.Header.Values("If-None-Match"), true, func(tag string) bool {
+			return tag == etag
+		})
+		if notModified {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEtagsMatch(t *testing.T) {
+	equals := func(want string) func(string) bool {
+		return func(etag string) bool { return etag == want }
+	}
+
+	tests := []struct {
+		name   string
+		header []string
+		weak   bool
+		want   bool
+	}{
+		{"no header", nil, false, false},
+		{"same tag", []string{`"1-2"`}, false, true},
+		{"other tag", []string{`"1-3"`}, false, false},
+		{"unquoted tag", []string{`1-2`}, false, false},
+		{"any", []string{`*`}, false, true},
+		{"one of a list", []string{`"a", "1-2" ,"b"`}, false, true},
+		{"one of several headers", []string{`"a"`, `"1-2"`}, false, true},
+		{"weak tag with strong comparison", []string{`W/"1-2"`}, false, false},
+		{"weak tag with weak comparison", []string{`W/"1-2"`}, true, true},
+		{"strong tag with weak comparison", []string{`"1-2"`}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagsMatch(tt.header, tt.weak, equals(`"1-2"`)); got != tt.want {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepresentationETag(t *testing.T) {
+	a := representationETag("1-2", []byte(`{"title":"Moana"}`))
+	b := representationETag("1-2", []byte(`{"title":"Vaiana"}`))
+
+	if a == b {
+		t.Errorf("got the same ETag %s for different bodies", a)
+	}
+	if a != representationETag("1-2", []byte(`{"title":"Moana"}`)) {
+		t.Error("got different ETags for the same body")
+	}
+	if a[:5] != `"1-2-` || a[len(a)-1] != '"' {
+		t.Errorf("got ETag %s; want a quoted tag starting with the version", a)
+	}
+	if etag := representationETag("", []byte("{}")); etag[1] == '-' {
+		t.Errorf("got ETag %s; want just the hash without a tag", etag)
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	movie := &data.Movie{ID: 1, Version: 2}
+	body := representationETag(movieVersionTag(movie), []byte(`{"movie":{}}`))
+
+	tests := []struct {
+		name     string
+		ifMatch  []string
+		required bool
+		want     error
+	}{
+		{name: "no header"},
+		{name: "no header when required", required: true, want: errPreconditionRequired},
+		{name: "version tag", ifMatch: []string{`"1-2"`}},
+		{name: "representation tag", ifMatch: []string{body}},
+		{name: "any", ifMatch: []string{"*"}, required: true},
+		{name: "older version", ifMatch: []string{`"1-1"`}, want: errPreconditionFailed},
+		{name: "version with more digits", ifMatch: []string{`"1-21-abc"`}, want: errPreconditionFailed},
+		{name: "other movie", ifMatch: []string{`"11-2"`}, want: errPreconditionFailed},
+		{name: "weak tag", ifMatch: []string{"W/" + body}, want: errPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{}
+			app.config.requireIfMatch = tt.required
+
+			r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", nil)
+			for _, value := range tt.ifMatch {
+				r.Header.Add("If-Match", value)
+			}
+
+			if err := app.checkIfMatch(r, movie); !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteConditionalJSON(t *testing.T) {
+	app := &application{}
+
+	// The rating of a movie changes without its version changing.
+	movie := &data.Movie{ID: 1, Title: "Moana", Version: 2}
+	rated := &data.Movie{ID: 1, Title: "Moana", Version: 2, AverageRating: 4, RatingCount: 1}
+
+	write := func(method string, status int, movie *data.Movie, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/v1/movies/1", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+
+		err := app.writeConditionalJSON(w, r, status, envelope{"movie": movie}, nil, movieVersionTag(movie))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	first := write(http.MethodGet, http.StatusOK, movie, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || first.Body.Len() == 0 || etag == "" {
+		t.Fatalf("got %d with ETag %q; want 200 with a body and an ETag", first.Code, etag)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		status      int
+		movie       *data.Movie
+		ifNoneMatch string
+		want        int
+	}{
+		{"unchanged", http.MethodGet, http.StatusOK, movie, etag, http.StatusNotModified},
+		{"unchanged with weak tag", http.MethodGet, http.StatusOK, movie, "W/" + etag, http.StatusNotModified},
+		{"rated since", http.MethodGet, http.StatusOK, rated, etag, http.StatusOK},
+		{"other tag", http.MethodGet, http.StatusOK, movie, `"x"`, http.StatusOK},
+		{"not a GET", http.MethodPatch, http.StatusOK, movie, etag, http.StatusOK},
+		{"not a 200", http.MethodGet, http.StatusCreated, movie, etag, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := write(tt.method, tt.status, tt.movie, tt.ifNoneMatch)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d; want %d", w.Code, tt.want)
+			}
+			if w.Header().Get("ETag") == "" {
+				t.Error("got no ETag")
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("got body %q with 304; want none", w.Body.String())
+			}
+		})
+	}
+}
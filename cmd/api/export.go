@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportWriteTimeout is how long each batch of an export has to be written to the client. The deadline is pushed back before every batch, so that the
+// server's WriteTimeout doesnt cut off the export of a large catalogue, while a client which stops reading still times out.
+const exportWriteTimeout = 30 * time.Second
+
+// The exportMoviesHandler() handles "GET /v1/movies/export". It streams every movie matching the same filters as "GET /v1/movies" either
+// as newline-delimited JSON or as CSV, depending on the Accept header. The movies are written as they are read from the database and the response is
+// flushed after every batch, so neither the server nor the client has to hold the whole catalogue in memory. The export can take as long as it needs, as
+// long as each batch is written within exportWriteTimeout.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	movieFilters := app.readMovieFilters(r.URL.Query(), v)
+	err := app.canonicalGenreFilters(r.Context(), &movieFilters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if data.ValidateMovieFilters(v, movieFilters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	format := negotiateExportFormat(r.Header.Get("Accept"))
+	if format == "" {
+		app.notAcceptableResponse(w, r, "application/x-ndjson", "text/csv")
+		return
+	}
+
+	// Runtimes are written in the format the client asked for, as they are in JSON responses.
+	runtimeFormat := responseRuntimeFormat(w)
+
+	var (
+		writeMovie func(*data.Movie) error
+		flush      func() error
+	)
+
+	switch format {
+	case "text/csv":
+		cw := csv.NewWriter(w)
+		writeMovie = func(movie *data.Movie) error {
+			return cw.Write([]string{
+				strconv.FormatInt(movie.ID, 10),
+				movie.Title,
+				strconv.FormatInt(int64(movie.Year), 10),
+				fmt.Sprint(movie.Runtime.Format(runtimeFormat)),
+				strings.Join(movie.Genres, ","),
+				movie.Status,
+				strconv.FormatInt(int64(movie.Version), 10),
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+	default:
+		enc := json.NewEncoder(w)
+		writeMovie = func(movie *data.Movie) error {
+			movie.SetRuntimeFormat(runtimeFormat)
+			return enc.Encode(movie)
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+
+	// Once we start writing the body we can no longer send an error response, so from here on errors are only logged. The headers are written when the first
+	// movie arrives (or at the end, if there are no matching movies), so that an error from the initial query can still be reported properly.
+	started := false
+	start := func() error {
+		started = true
+
+		err := app.extendWriteDeadline(r, exportWriteTimeout)
+		if err != nil {
+			return err
+		}
+
+		w.Header().Set("Content-Type", format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, exportExtension(format)))
+		w.WriteHeader(http.StatusOK)
+
+		if format == "text/csv" {
+			return writeMovieHeader(w)
+		}
+		return nil
+	}
+
+	written := 0
+
+	err = app.models.Movies.Export(r.Context(), movieFilters, func(movie *data.Movie) error {
+		if !started {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+
+		err := writeMovie(movie)
+		if err != nil {
+			return err
+		}
+
+		written++
+		if written%500 == 0 {
+			err = flush()
+			if err != nil {
+				return err
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+
+			err = app.extendWriteDeadline(r, exportWriteTimeout)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	switch {
+	case err == nil && !started:
+		err = start()
+	case err == nil:
+		err = flush()
+	}
+
+	if err != nil {
+		switch {
+		case !started:
+			app.serverErrorResponse(w, r, err)
+		case errors.Is(err, data.ErrCanceled) || r.Context().Err() != nil:
+			app.logger.PrintInfo("export canceled", map[string]string{
+				"request_method": r.Method,
+				"request_url":    r.URL.String(),
+				"status":         "499",
+			})
+		default:
+			app.logError(r, err)
+		}
+	}
+}
+
+// writeMovieHeader writes the header row of a CSV export. The columns match the ones accepted by "POST /v1/movies/import", plus the id and version.
+func writeMovieHeader(w http.ResponseWriter) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "title", "year", "runtime", "genres", "status", "version"})
+	cw.Flush()
+	return cw.Error()
+}
+
+// negotiateExportFormat picks the export format from the Accept header, returning "application/x-ndjson", "text/csv" or the empty string if the client doesnt
+// accept either of them. Types are considered in the order the client lists them, and quality values are ignored except that q=0 rules a type out.
+func negotiateExportFormat(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return "application/x-ndjson"
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		rejected := false
+		for _, param := range fields[1:] {
+			if q := strings.ReplaceAll(param, " ", ""); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+				rejected = true
+			}
+		}
+		if rejected {
+			continue
+		}
+
+		switch mediaType {
+		case "application/x-ndjson", "application/*", "*/*":
+			return "application/x-ndjson"
+		case "text/csv", "text/*":
+			return "text/csv"
+		}
+	}
+
+	return ""
+}
+
+func exportExtension(format string) string {
+	if format == "text/csv" {
+		return "csv"
+	}
+	return "ndjson"
+}
@@ -5,24 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
 	"github.com/myk4040okothogodo/greenlight/internal/validator"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Retrieve the "id" URL parameter from the current request context, then convert it to an integer and return it. If thhe operation isnt successful return o
 // and an error
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readIntParam(r, "id")
+}
+
+// The readIntParam() helper does the same for any named URL parameter which must be a positive integer, like the "version" in
+// /v1/movies/:id/revisions/:version.
+func (app *application) readIntParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
-	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+	i, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || i < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
-	return id, nil
+	return i, nil
 }
 
 //Define an  envelope type
@@ -33,15 +41,11 @@ type envelope map[string]interface{}
 //
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	// Encode the data to JSON, returning the error if there was one.
-	//use MarshalIndent() function so that whitespace is added to the encoded JSON. Here we use no line prefix(" ") and tab indents ("\t")
-	js, err := json.MarshalIndent(data, "", "\t")
+	js, err := encodeJSON(w, data)
 	if err != nil {
 		return err
 	}
 
-	// Append a newline to make it easier to view in terminal applications.
-	js = append(js, '\n')
-
 	//At this point, we know that we wont encounter any more errors before writing the response, so its safe to add any headers that we want to include. We loop
 	//through the header map and add each header to the http.ResponseWriter header map. Note that its OK if the provided header map is nil. Go doesnt throw an error
 	//if you try to range over (or generally read from) a nil map.
@@ -58,6 +62,45 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 
 }
 
+// encodeJSON encodes the envelope for the response body of writeJSON() and writeConditionalJSON(), with any movies in it written with their runtimes in
+// the format that the client asked for.
+func encodeJSON(w http.ResponseWriter, env envelope) ([]byte, error) {
+	if format := responseRuntimeFormat(w); format != data.RuntimeText {
+		data.SetRuntimeFormat(env, format)
+	}
+
+	//use MarshalIndent() function so that whitespace is added to the encoded JSON. Here we use no line prefix(" ") and tab indents ("\t")
+	js, err := json.MarshalIndent(env, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	// Append a newline to make it easier to view in terminal applications.
+	return append(js, '\n'), nil
+}
+
+// A runtimeFormatWriter is a response writer which carries the format that the client wants movie runtimes written in. It is set up by the runtimeFormat()
+// middleware.
+type runtimeFormatWriter struct {
+	http.ResponseWriter
+	format string
+}
+
+// Flush passes flushes through to the wrapped writer, so that streamed responses like exports still work.
+func (w runtimeFormatWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// responseRuntimeFormat returns the format that runtimes should be written in for the response, which is data.RuntimeText unless the client asked for another.
+func responseRuntimeFormat(w http.ResponseWriter) string {
+	if w, ok := w.(runtimeFormatWriter); ok {
+		return w.format
+	}
+	return data.RuntimeText
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 
 	// Use http.MaxBytesReader() to limit the size of the request body to 1MB.
@@ -75,6 +118,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var runtimeError *data.RuntimeError
 
 		switch {
 		// Use the errors.As() function  to check whether the error has the type *json.SyntaxError. If it does, the return a plain-english error message which include
@@ -100,6 +144,11 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		case errors.Is(err, io.EOF):
 			return errors.New("body must not be empty")
 
+		// A *data.RuntimeError is returned by the Runtime type when a runtime cant be parsed, or is negative or too large. The decoder doesnt tell us which
+		// field it was for, so we include the value instead.
+		case errors.As(err, &runtimeError):
+			return fmt.Errorf("body contains invalid runtime %s: %s", runtimeError.Value, runtimeError.Err)
+
 		//If the JSON contains a field which cannot be mapped to the target destination then Decode() will now return an error message in the format
 		// "json: unknown field "<name>"". We check for this, extract the field name from the error, and interpolate it into our custome error message
 		case strings.HasPrefix(err.Error(), "json: unknown field"):
@@ -183,6 +232,62 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// The readBool() helper reads a boolean value from the query string, accepting the same values as strconv.ParseBool() ("true", "false", "1", "0" etc). If
+// no matching key could be found it returns the provided default value, and if the value isnt a boolean it records an error in the validator instance.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// The readRuntime() helper reads a runtime from the query string, in any of the formats accepted by data.ParseRuntime(). If no matching key could be found it
+// returns the provided default value, and if the value cant be parsed it records an error in the validator instance.
+func (app *application) readRuntime(qs url.Values, key string, defaultValue data.Runtime, v *validator.Validator) data.Runtime {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	runtime, err := data.ParseRuntime(s)
+	if err != nil {
+		v.AddError(key, err.Error())
+		return defaultValue
+	}
+
+	return runtime
+}
+
+// The readTime() helper reads a time from the query string, either as an RFC 3339 timestamp or as a date in the format "2006-01-02" (which is taken as
+// midnight UTC). If no matching key could be found it returns the zero time, and if the value cant be parsed it records an error in the validator instance.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a date in the format YYYY-MM-DD")
+	return time.Time{}
+}
+
 // The background() helper accepts an arbitrary function as a parameter
 func (app *application) background(fn func()) {
 
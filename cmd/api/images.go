@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/myk4040okothogodo/greenlight/internal/blob"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"github.com/myk4040okothogodo/greenlight/internal/imaging"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// The maximum size of an uploaded image (10MB).
+const imageMaxBytes = 10 * 1_048_576
+
+// thumbnailWidths are the widths of the thumbnails generated for each uploaded image. Only the widths narrower than the image itself are generated.
+var thumbnailWidths = []int{185, 342, 780}
+
+// The putMoviePosterHandler() handles "PUT /v1/movies/:id/poster", uploading the poster of a movie and replacing any poster it already has. The image is
+// either the "file" part of a multipart/form-data body or the whole request body.
+func (app *application) putMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	image, ok := app.uploadMovieImage(w, r, id, data.ImagePoster)
+	if !ok {
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"poster": image}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteMoviePosterHandler() handles "DELETE /v1/movies/:id/poster".
+func (app *application) deleteMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	posters, err := app.models.Images.GetAllForMovie(r.Context(), id, data.ImagePoster)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if len(posters) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.deleteImage(w, r, id, posters[0].ID, data.ImagePoster, "poster successfully deleted")
+}
+
+// The listMovieStillsHandler() handles "GET /v1/movies/:id/stills", returning the stills of a movie in the order they were uploaded.
+func (app *application) listMovieStillsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Check that the movie exists (and isnt in the trash), so that a missing movie is a 404 rather than an empty list.
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	stills, err := app.models.Images.GetAllForMovie(r.Context(), movie.ID, data.ImageStill)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stills": stills}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createMovieStillHandler() handles "POST /v1/movies/:id/stills", uploading a still from a movie in the same way as putMoviePosterHandler().
+func (app *application) createMovieStillHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	image, ok := app.uploadMovieImage(w, r, id, data.ImageStill)
+	if !ok {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/stills", id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"still": image}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteMovieStillHandler() handles "DELETE /v1/movies/:id/stills/:image_id".
+func (app *application) deleteMovieStillHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	imageID, err := app.readIntParam(r, "image_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	app.deleteImage(w, r, id, imageID, data.ImageStill, "still successfully deleted")
+}
+
+// The showMediaHandler() handles "GET /v1/media/*key", serving an image or thumbnail from the blob store. The key of every image is unique to its upload,
+// so the response can be cached indefinitely, and it is served without authentication so that the URLs on movies can be used directly in <img> tags.
+func (app *application) showMediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("key"), "/")
+
+	// Only images are served, with the content type given by their extension.
+	contentType := imaging.TypeByExtension(strings.TrimPrefix(path.Ext(key), "."))
+	if contentType == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	f, err := app.blobs.Open(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound), errors.Is(err, blob.ErrInvalidKey):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", fmt.Sprintf("%q", key))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// ServeContent() handles Range and If-None-Match requests for us.
+	http.ServeContent(w, r, "", time.Time{}, f)
+}
+
+// uploadMovieImage reads an uploaded image from the request, checks it, stores it and its thumbnails in the blob store and adds it to the movie. If
+// anything goes wrong it sends the error response itself and returns false.
+func (app *application) uploadMovieImage(w http.ResponseWriter, r *http.Request, movieID int64, kind string) (*data.Image, bool) {
+	// Check that the movie exists before reading the upload, so that a missing movie is a 404 whatever was uploaded.
+	_, err := app.models.Movies.Get(r.Context(), movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	body, ok := app.readImage(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	v := validator.New()
+
+	// The type of the image is sniffed from its content, rather than trusting the Content-Type which the client sent.
+	info, err := imaging.Inspect(body)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedType):
+			v.AddError("file", "must be a JPEG, PNG or WebP image")
+		case errors.Is(err, imaging.ErrInvalidImage):
+			v.AddError("file", "must be a valid image")
+		case errors.Is(err, imaging.ErrTooManyPixels):
+			v.AddError("file", fmt.Sprintf("must not have more than %d pixels", imaging.MaxPixels))
+		default:
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	key, err := data.NewImageKey(movieID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	image := &data.Image{
+		MovieID:         movieID,
+		Kind:            kind,
+		Key:             key,
+		ContentType:     info.ContentType,
+		Width:           int32(info.Width),
+		Height:          int32(info.Height),
+		Size:            int64(len(body)),
+		ThumbnailWidths: []int32{},
+	}
+
+	err = app.storeImage(r.Context(), image, body)
+	if err != nil {
+		app.deleteImageBlobs(image)
+		switch {
+		case errors.Is(err, imaging.ErrInvalidImage):
+			v.AddError("file", "must be a valid image")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// The blobs are stored before the image is added to the movie, so that the movie never refers to an image which isnt there yet. If adding it fails,
+	// the blobs are deleted again.
+	replaced, err := app.models.Images.Insert(r.Context(), image)
+	if err != nil {
+		app.deleteImageBlobs(image)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrImageLimit):
+			v.AddError("file", fmt.Sprintf("movie must not have more than %d stills", data.MaxStills))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if replaced != nil {
+		app.deleteImageBlobs(replaced)
+	}
+
+	return image, true
+}
+
+// readImage reads the image from a multipart/form-data request (from the part named "file") or from the whole body of any other request with an image
+// or application/octet-stream Content-Type. If the request is unacceptable it sends the error response itself and returns false.
+func (app *application) readImage(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, imageMaxBytes)
+
+	var body []byte
+
+	switch {
+	case mediaType == "multipart/form-data":
+		body, err = readMultipartFile(r, "file")
+	case mediaType == "application/octet-stream" || validator.In(mediaType, imaging.ContentTypes...):
+		body, err = io.ReadAll(r.Body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, append([]string{"multipart/form-data", "application/octet-stream"}, imaging.ContentTypes...)...)
+		return nil, false
+	}
+	if err != nil {
+		// As in readJSON(), a body which exceeds the size limit fails with the error "http: request body too large".
+		if strings.Contains(err.Error(), "http: request body too large") {
+			err = fmt.Errorf("body must not be larger than %d bytes", imageMaxBytes)
+		}
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	if len(body) == 0 {
+		app.failedValidationResponse(w, r, map[string]string{"file": "must be provided"})
+		return nil, false
+	}
+
+	return body, true
+}
+
+// readMultipartFile returns the contents of the named part of a multipart/form-data request, or nil if there is no such part. The body is read as a
+// stream, so that the other parts are never held in memory or spilled to temporary files.
+func readMultipartFile(r *http.Request, name string) ([]byte, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == name {
+			return io.ReadAll(part)
+		}
+	}
+}
+
+// storeImage writes an image and its thumbnails to the blob store, recording the widths of the thumbnails on the image. Thumbnails are only generated for
+// the formats which the standard library can decode.
+func (app *application) storeImage(ctx context.Context, image *data.Image, body []byte) error {
+	err := app.blobs.Put(ctx, image.OriginalKey(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if !imaging.CanResize(image.ContentType) {
+		return nil
+	}
+
+	return imaging.Thumbnails(body, thumbnailWidths, func(width int, thumbnail []byte) error {
+		err := app.blobs.Put(ctx, image.ThumbnailKey(int32(width)), bytes.NewReader(thumbnail))
+		if err != nil {
+			return err
+		}
+
+		image.ThumbnailWidths = append(image.ThumbnailWidths, int32(width))
+		return nil
+	})
+}
+
+// deleteImage removes an image of the given kind from a movie and deletes its blobs, then sends the message in the response.
+func (app *application) deleteImage(w http.ResponseWriter, r *http.Request, movieID, imageID int64, kind, message string) {
+	image, err := app.models.Images.Delete(r.Context(), movieID, imageID, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deleteImageBlobs(image)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteImageBlobs deletes the blobs of an image. The image has already been removed from (or never added to) its movie, so a failure only leaves unused
+// files behind, and is logged rather than reported to the client.
+func (app *application) deleteImageBlobs(image *data.Image) {
+	err := app.blobs.DeleteAll(context.Background(), image.Key)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"key": image.Key})
+	}
+}
+
+// deleteMovieBlobs deletes the blobs of every image of a movie, after the movie has been purged or merged into another. Movies in the trash keep their images, so that they are
+// still there if the movie is restored.
+func (app *application) deleteMovieBlobs(movieID int64) {
+	prefix := data.MovieBlobPrefix(movieID)
+
+	err := app.blobs.DeleteAll(context.Background(), prefix)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"key": prefix})
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The maximum size of an import request body (10MB), and the number of movies which are inserted in each batch.
+	importMaxBytes  = 10 * 1_048_576
+	importBatchSize = 500
+)
+
+// An importRow holds a movie read from one row of an import file, or the reason the row couldnt be read.
+type importRow struct {
+	number int
+	movie  *data.Movie
+	errors map[string]string
+}
+
+// An importRowError reports the validation errors for a single row of an import file.
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// The importMoviesHandler() handles "POST /v1/movies/import". The request body is either a CSV file (with a header row naming the title, year, runtime and
+// genres columns) or newline-delimited JSON objects in the same format as the body for "POST /v1/movies". Every row is validated, the valid rows are inserted
+// in batches within a single transaction (so that either all of them are imported or none are), and the response lists the invalid rows with their errors.
+// If the dry_run query string parameter is true, nothing is inserted.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	dryRun := app.readBool(r.URL.Query(), "dry_run", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+
+	var rows []importRow
+
+	switch mediaType {
+	case "text/csv":
+		rows, err = readImportCSV(r.Body)
+	case "application/x-ndjson":
+		rows, err = readImportNDJSON(r.Body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+	if err != nil {
+		// As in readJSON(), a body which exceeds the size limit fails with the error "http: request body too large".
+		if strings.Contains(err.Error(), "http: request body too large") {
+			err = fmt.Errorf("body must not be larger than %d bytes", importMaxBytes)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	vocabulary, err := app.genreVocabulary(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Validate each row which was read successfully, mapping its genres to their slugs, and collect the valid movies.
+	rowErrors := []importRowError{}
+	movies := []*data.Movie{}
+
+	for _, row := range rows {
+		if row.errors == nil {
+			// As with "POST /v1/movies", movies without a status are taken to have been released.
+			if row.movie.Status == "" {
+				row.movie.Status = data.StatusReleased
+			}
+
+			rv := validator.New()
+			row.movie.Genres = vocabulary.Normalize(rv, "genres", row.movie.Genres)
+			data.ValidateMovie(rv, row.movie)
+			if !rv.Valid() {
+				row.errors = rv.Errors
+			}
+		}
+
+		if row.errors != nil {
+			rowErrors = append(rowErrors, importRowError{Row: row.number, Errors: row.errors})
+			continue
+		}
+
+		movies = append(movies, row.movie)
+	}
+
+	imported := 0
+
+	if !dryRun {
+		user := app.contextGetUser(r)
+
+		// If a batch fails, the batches before it are rolled back too, so that a client can safely retry the whole import.
+		err = app.models.WithTx(r.Context(), func(models data.Models) error {
+			for start := 0; start < len(movies); start += importBatchSize {
+				end := start + importBatchSize
+				if end > len(movies) {
+					end = len(movies)
+				}
+
+				err := models.Movies.InsertMany(r.Context(), movies[start:end], user.ID)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		imported = len(movies)
+	}
+
+	report := envelope{
+		"dry_run":    dryRun,
+		"total_rows": len(rows),
+		"valid_rows": len(movies),
+		"imported":   imported,
+		"errors":     rowErrors,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readImportCSV reads movies from a CSV file. The first record must be a header naming the title, year, runtime and genres columns (in any order), and
+// optionally the status column. Genres are separated by commas within their cell, like "drama,romance". Row numbers count the data rows, starting at 1 for the row after the header.
+// A row which isnt valid CSV (like one with a stray quote) is reported as an invalid row, and the rows after it are still read.
+func readImportCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		// The id and version columns written by "GET /v1/movies/export" are accepted but ignored, so that an export can be imported again.
+		if !validator.In(name, "title", "year", "runtime", "genres", "status", "id", "version") {
+			return nil, fmt.Errorf("header contains unknown column %q", name)
+		}
+		if _, exists := columns[name]; exists {
+			return nil, fmt.Errorf("header contains duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+
+	var rows []importRow
+
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		row := importRow{number: number, movie: &data.Movie{}}
+		v := validator.New()
+
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			v.AddError("row", fmt.Sprintf("contains badly-formed CSV: %s", parseError.Err))
+			row.errors = v.Errors
+			rows = append(rows, row)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) != len(header) {
+			v.AddError("row", fmt.Sprintf("must have %d fields", len(header)))
+			row.errors = v.Errors
+			rows = append(rows, row)
+			continue
+		}
+
+		// cell returns the value of the named column, or the empty string if the file doesnt have that column.
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row.movie.Title = cell("title")
+
+		if s := cell("year"); s != "" {
+			year, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				v.AddError("year", "must be an integer value")
+			}
+			row.movie.Year = int32(year)
+		}
+
+		if s := cell("runtime"); s != "" {
+			runtime, err := data.ParseRuntime(s)
+			if err != nil {
+				v.AddError("runtime", err.Error())
+			}
+			row.movie.Runtime = runtime
+		}
+
+		if s := cell("genres"); s != "" {
+			row.movie.Genres = []string{}
+			for _, genre := range strings.Split(s, ",") {
+				row.movie.Genres = append(row.movie.Genres, strings.TrimSpace(genre))
+			}
+		}
+
+		row.movie.Status = cell("status")
+
+		if !v.Valid() {
+			row.errors = v.Errors
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// readImportNDJSON reads movies from newline-delimited JSON, one object per line. Blank lines are skipped, but still counted, so that row numbers match the
+// line numbers in the file.
+func readImportNDJSON(body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1_048_576)
+
+	var rows []importRow
+
+	for number := 1; scanner.Scan(); number++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var input struct {
+			Title   string       `json:"title"`
+			Year    int32        `json:"year"`
+			Runtime data.Runtime `json:"runtime"`
+			Genres  []string     `json:"genres"`
+			Status  string       `json:"status"`
+		}
+
+		row := importRow{number: number}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		if err == nil && dec.More() {
+			err = errors.New("line must only contain a single JSON value")
+		}
+		if err != nil {
+			row.errors = importJSONErrors(err)
+			rows = append(rows, row)
+			continue
+		}
+
+		row.movie = &data.Movie{
+			Title:   input.Title,
+			Year:    input.Year,
+			Runtime: input.Runtime,
+			Genres:  input.Genres,
+			Status:  input.Status,
+		}
+
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("body must not be empty")
+	}
+
+	return rows, nil
+}
+
+// importJSONErrors turns the error from decoding one line of NDJSON into validation-style errors, keyed by the field at fault where we know it.
+func importJSONErrors(err error) map[string]string {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var runtimeError *data.RuntimeError
+
+	switch {
+	case errors.As(err, &runtimeError):
+		return map[string]string{"runtime": runtimeError.Error()}
+	case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+		return map[string]string{unmarshalTypeError.Field: "incorrect JSON type"}
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		return map[string]string{"row": "contains unknown key " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	case errors.As(err, &syntaxError), errors.Is(err, io.ErrUnexpectedEOF):
+		return map[string]string{"row": "contains badly-formed JSON"}
+	default:
+		return map[string]string{"row": err.Error()}
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The listListsHandler() handles "GET /v1/lists", returning a page of the current user's lists with their watchlist first.
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "id"),
+		SortSafelist: []string{"id", "name", "created_at", "-id", "-name", "-created_at"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Make sure that the user's watchlist exists, so that it is always part of the result.
+	_, err := app.models.Lists.GetWatchlist(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lists, metadata, err := app.models.Lists.GetAllForUser(r.Context(), user.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"lists": lists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createListHandler() handles "POST /v1/lists", creating a named list for the current user. A public list is given a share slug, which other users can
+// use to read it through "GET /v1/shared-lists/:slug".
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name   string `json:"name"`
+		Public bool   `json:"public"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.List{
+		UserID: app.contextGetUser(r).ID,
+		Name:   input.Name,
+		Public: input.Public,
+	}
+
+	v := validator.New()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Insert(r.Context(), list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showListHandler() handles "GET /v1/lists/:id". The id can be "watchlist" for the current user's watchlist.
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateListHandler() handles "PATCH /v1/lists/:id", changing the name of a list or whether it is public. Making a list private removes its share slug,
+// so any links to it stop working.
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name   *string `json:"name"`
+		Public *bool   `json:"public"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Public != nil {
+		list.Public = *input.Public
+	}
+
+	v := validator.New()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Update(r.Context(), list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteListHandler() handles "DELETE /v1/lists/:id", deleting one of the current user's named lists. The watchlist can't be deleted.
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	if list.Watchlist {
+		app.errorResponse(w, r, http.StatusConflict, "your watchlist can't be deleted")
+		return
+	}
+
+	err := app.models.Lists.Delete(r.Context(), list.ID, list.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "list successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listListItemsHandler() handles "GET /v1/lists/:id/movies", returning a page of the movies on one of the current user's lists, in the order they
+// chose by default.
+func (app *application) listListItemsHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeListItems(w, r, list)
+}
+
+// The showSharedListHandler() handles "GET /v1/shared-lists/:slug", returning a public list and a page of its movies to any user.
+func (app *application) showSharedListHandler(w http.ResponseWriter, r *http.Request) {
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+
+	list, err := app.models.Lists.GetShared(r.Context(), slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeListItems(w, r, list)
+}
+
+// writeListItems sends a page of the movies on a list along with the list itself, using the pagination and sort parameters in the query string.
+func (app *application) writeListItems(w http.ResponseWriter, r *http.Request, list *data.List) {
+	v := validator.New()
+
+	filters := app.readListItemFilters(r.URL.Query(), v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := app.models.Lists.GetItems(r.Context(), list.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list, "movies": items, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readListItemFilters reads the pagination and sort parameters for the movies on a list. As well as the list's own order, the movies can be sorted on when
+// they were added or watched, or on the same movie fields as the movies list.
+func (app *application) readListItemFilters(qs url.Values, v *validator.Validator) data.Filters {
+	return data.Filters{
+		Page:     app.readInt(qs, "page", 1, v),
+		PageSize: app.readInt(qs, "page_size", 20, v),
+		Sort:     app.readString(qs, "sort", "position"),
+		SortSafelist: []string{
+			"position", "added_at", "watched_at", "title", "year", "runtime", "rating",
+			"-position", "-added_at", "-watched_at", "-title", "-year", "-runtime", "-rating",
+		},
+	}
+}
+
+// The addListItemHandler() handles "POST /v1/lists/:id/movies", adding a movie to the end of one of the current user's lists.
+func (app *application) addListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	// A movie which doesnt exist is a problem with the request body rather than the URL, so it is reported as a validation error instead of a 404.
+	v.Check(input.MovieID != 0, "movie_id", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(r.Context(), input.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "must be an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	item := &data.ListItem{Movie: movie}
+
+	err = app.models.Lists.AddItem(r.Context(), list.ID, item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "must be an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateListItem):
+			v.AddError("movie_id", "is already on this list")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateListItemHandler() handles "PATCH /v1/lists/:id/movies/:movie_id". The position moves the movie within the list, shifting the movies in between,
+// and watched_at sets the date the movie was watched in YYYY-MM-DD format, or clears it if it is empty. Only the fields present in the request body are
+// changed.
+func (app *application) updateListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readIntParam(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	item, err := app.models.Lists.GetItem(r.Context(), list.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Position  *int32  `json:"position"`
+		WatchedAt *string `json:"watched_at"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Position != nil {
+		item.Position = *input.Position
+	}
+	if input.WatchedAt != nil {
+		item.WatchedAt = nil
+		if *input.WatchedAt != "" {
+			watchedAt, err := time.Parse("2006-01-02", *input.WatchedAt)
+			if err != nil {
+				v.AddError("watched_at", "must be a date in the format YYYY-MM-DD")
+			}
+			item.WatchedAt = &watchedAt
+		}
+	}
+
+	if data.ValidateListItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.UpdateItem(r.Context(), list.ID, item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The removeListItemHandler() handles "DELETE /v1/lists/:id/movies/:movie_id", removing a movie from one of the current user's lists.
+func (app *application) removeListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	movieID, err := app.readIntParam(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Lists.RemoveItem(r.Context(), list.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully removed from list"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readList reads the list in the :id parameter of the URL, which must belong to the current user. The id "watchlist" is the user's watchlist, which is
+// created if it doesnt exist yet. Lists which belong to other users are reported as not found. If anything is wrong it sends the error response itself and
+// returns false.
+func (app *application) readList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	user := app.contextGetUser(r)
+
+	var list *data.List
+	var err error
+
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") == "watchlist" {
+		list, err = app.models.Lists.GetWatchlist(r.Context(), user.ID)
+	} else {
+		var id int64
+
+		id, err = app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return nil, false
+		}
+
+		list, err = app.models.Lists.Get(r.Context(), id, user.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return list, true
+}
@@ -14,9 +14,12 @@ import (
 	//import the pq driver so that it can register itself with the database/sql package. Note that we alias this import to the blank identifier, to stop the Go
 	//compiler complaining that the package isnt being used.
 	_ "github.com/lib/pq"
+	"github.com/myk4040okothogodo/greenlight/internal/blob"
 	"github.com/myk4040okothogodo/greenlight/internal/data"
 	"github.com/myk4040okothogodo/greenlight/internal/jsonlog"
 	"github.com/myk4040okothogodo/greenlight/internal/mailer"
+	"github.com/myk4040okothogodo/greenlight/internal/migrate"
+	"github.com/myk4040okothogodo/greenlight/migrations"
 )
 
 // Delcare a string containing the version number
@@ -34,13 +37,27 @@ var buildTime string
 //Add a db struct field to hold the configuration settings for our database connection pool. For now this only holds DSN,which we will read in from a command-line flag
 //Add maxOpenConns, maxIdleConns and maxIdleTime fields to hole the configurtaion setting for the connection pool
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port    int
+	env     string
+	storage string
+	db      struct {
 		dsn          string
+		replicaDSNs  []string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		autoMigrate  bool
+
+		// How often the read replicas are health checked.
+		replicaCheckInterval time.Duration
+
+		// The maximum time that a single query may run for, per model.
+		timeouts struct {
+			movies      time.Duration
+			permissions time.Duration
+			tokens      time.Duration
+			users       time.Duration
+		}
 	}
 
 	// Add a new limiter struct containing fields for the request-per-second and burst values, and a boolean field which we can use to enable/disable rate limiting
@@ -61,6 +78,24 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	// How long deleted movies stay in the trash before they are permanently purged. Zero disables purging.
+	trash struct {
+		retention time.Duration
+	}
+	// The directory where uploaded images and their thumbnails are stored.
+	blob struct {
+		dir string
+	}
+	// The in-process cache of movies, permissions and authenticated users, which is off unless enabled. With notify set (as it is by default),
+	// invalidations are shared with the other instances of the API through PostgreSQL, so that none of them keeps serving a revoked token or permission.
+	cache struct {
+		enabled bool
+		size    int
+		ttl     time.Duration
+		notify  bool
+	}
+	// Whether requests to change or delete a movie must have an If-Match header, so that clients cant overwrite changes they havent seen.
+	requireIfMatch bool
 }
 
 // Define an applicaction struct to hold the dependencies for our HTTP handlers, helpers, and middleware. At the moment this only
@@ -70,6 +105,11 @@ type application struct {
 	config config
 	logger *jsonlog.Logger
 	models data.Models
+	// replicas routes read-only queries to the read replicas. It is nil unless any were configured.
+	replicas *data.ReplicaSet
+	// cache is the cache which wraps the models. It is nil if caching is disabled.
+	cache  *data.Cache
+	blobs  blob.Store
 	mailer mailer.Mailer
 	wg     sync.WaitGroup
 }
@@ -83,14 +123,33 @@ func main() {
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 
+	// Read the storage backend. "memory" keeps all data in-process, which lets us run the API without a PostgreSQL database (the data is lost on exit).
+	flag.StringVar(&cfg.storage, "storage", "postgres", "Storage backend (postgres|memory)")
+
 	//  Read the DSN value from the db-dsn command-line flag into the config struct. We default to using our development DSN if no flag is provided.
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
 
+	// Read the DSNs of any read replicas. The flag can be given more than once, and read-only queries are spread across the replicas which are healthy.
+	flag.Func("db-replica-dsn", "PostgreSQL read replica DSN (may be given more than once)", func(val string) error {
+		cfg.db.replicaDSNs = append(cfg.db.replicaDSNs, val)
+		return nil
+	})
+	flag.DurationVar(&cfg.db.replicaCheckInterval, "db-replica-check-interval", 5*time.Second, "How often PostgreSQL read replicas are health checked")
+
 	// Read the connection pool settings from command-line flags into the config struct Notice the default values we are using
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
 
+	// If this is set, any pending up migrations are applied when the server starts.
+	flag.BoolVar(&cfg.db.autoMigrate, "db-auto-migrate", false, "Apply pending database migrations on startup")
+
+	// Read the per-model query timeouts. Each query is also cancelled if the client disconnects, so these only bound how long a query can run for.
+	flag.DurationVar(&cfg.db.timeouts.movies, "db-movies-timeout", 3*time.Second, "PostgreSQL query timeout for movies")
+	flag.DurationVar(&cfg.db.timeouts.permissions, "db-permissions-timeout", 3*time.Second, "PostgreSQL query timeout for permissions")
+	flag.DurationVar(&cfg.db.timeouts.tokens, "db-tokens-timeout", 3*time.Second, "PostgreSQL query timeout for tokens")
+	flag.DurationVar(&cfg.db.timeouts.users, "db-users-timeout", 3*time.Second, "PostgreSQL query timeout for users")
+
 	//Create command -line flags to read the setting values into the config struct. Notice that we use true as the default for the "enabled" setting?
 	//
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
@@ -112,6 +171,17 @@ func main() {
 		return nil
 	})
 
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept before being purged (0 to keep forever)")
+
+	flag.StringVar(&cfg.blob.dir, "blob-dir", "./blobs", "Directory for storing uploaded images")
+
+	flag.BoolVar(&cfg.requireIfMatch, "require-if-match", false, "Require an If-Match header on requests to change or delete a movie")
+
+	flag.BoolVar(&cfg.cache.enabled, "cache-enabled", false, "Enable the in-process cache")
+	flag.IntVar(&cfg.cache.size, "cache-size", 10000, "Maximum number of entries in each table of the cache")
+	flag.DurationVar(&cfg.cache.ttl, "cache-ttl", time.Minute, "How long entries are kept in the cache")
+	flag.BoolVar(&cfg.cache.notify, "cache-notify", true, "Share cache invalidations with other instances through PostgreSQL LISTEN/NOTIFY")
+
   //Create a new version boolean flag with the default value of false
   displayVersion :=  flag.Bool("version", false, "Display version and exit")
 
@@ -128,21 +198,6 @@ func main() {
 	//Initialize a new jsonlog.logger which writes any messages *at or above* the INFO severity level to the standard out stream.
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
-	// Call the openDB() helper function to create the connection pool, passing in  the config struct. If this returns an error, we log it and exit  the application
-	// immediately
-	db, err := openDB(cfg)
-	if err != nil {
-		//Use the PrintFatal() method to write a log entry containing  the error at the FATAL level and exit. we have no additional properties to include in the log
-		//entry, so we pass nil as the second parameter.
-		logger.PrintFatal(err, nil)
-	}
-
-	//Defer a call to db.close() so that the connection pool is closed before the main() function  exits.
-	defer db.Close()
-
-	//Also log a message to say that the connection pool has been succesfully established.
-	logger.PrintInfo("database connection pool established", nil)
-
 	//Publish a new "version" variable in the expvar handler containing our application version number (currently the constant "1.0.0")
 	expvar.NewString("version").Set(version)
 
@@ -151,22 +206,140 @@ func main() {
 		return runtime.NumGoroutine()
 	}))
 
-	//Publish the database  connection pool statistics
-	expvar.Publish("database", expvar.Func(func() interface{} {
-		return db.Stats()
-	}))
-
 	// Publish the current Unix timestamp
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
 	}))
 
+	// The "migrate" subcommand (for example "api -db-dsn=... migrate up") manages the database schema using the migrations embedded in the binary, and then
+	// exits without starting the server.
+	if flag.Arg(0) == "migrate" {
+		db, err := openDB(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		err = migrateCommand(db, logger, flag.Args()[1:])
+		db.Close()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	}
+
+	// Choose the models for the configured storage backend.
+	var (
+		models   data.Models
+		replicas *data.ReplicaSet
+		db       *sql.DB
+	)
+
+	switch cfg.storage {
+	case "memory":
+		models = data.NewMemoryModels()
+		logger.PrintInfo("using in-memory storage", nil)
+
+	case "postgres":
+		// Call the openDB() helper function to create the connection pool, passing in  the config struct. If this returns an error, we log it and exit  the application
+		// immediately
+		var err error
+		db, err = openDB(cfg)
+		if err != nil {
+			//Use the PrintFatal() method to write a log entry containing  the error at the FATAL level and exit. we have no additional properties to include in the log
+			//entry, so we pass nil as the second parameter.
+			logger.PrintFatal(err, nil)
+		}
+
+		//Defer a call to db.close() so that the connection pool is closed before the main() function  exits.
+		defer db.Close()
+
+		//Also log a message to say that the connection pool has been succesfully established.
+		logger.PrintInfo("database connection pool established", nil)
+
+		// Bring the schema up to date before we start accepting requests, if asked to.
+		if cfg.db.autoMigrate {
+			migrator, err := migrate.New(db, migrations.Files)
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+
+			err = migrateUp(context.Background(), migrator, logger)
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+		}
+
+		//Publish the database  connection pool statistics
+		expvar.Publish("database", expvar.Func(func() interface{} {
+			return db.Stats()
+		}))
+
+		// Open the connection pools for the read replicas, if there are any. A replica which can't be reached yet doesnt stop the server starting: it is
+		// just left out until it passes a health check.
+		if len(cfg.db.replicaDSNs) > 0 {
+			replicas, err = openReplicas(cfg, db)
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+			defer replicas.Close()
+
+			logReplicaHealth(logger, replicas.CheckHealth(context.Background()))
+
+			// Publish the statistics for each replica's connection pool next to those for the primary, along with the number of reads which fell back
+			// to the primary.
+			expvar.Publish("database_replicas", expvar.Func(func() interface{} {
+				return map[string]interface{}{
+					"replicas":  replicas.Stats(),
+					"fallbacks": replicas.Fallbacks(),
+				}
+			}))
+		}
+
+		models = data.NewModels(db, replicas, data.QueryTimeouts{
+			Movies:      cfg.db.timeouts.movies,
+			Permissions: cfg.db.timeouts.permissions,
+			Tokens:      cfg.db.timeouts.tokens,
+			Users:       cfg.db.timeouts.users,
+		})
+
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown storage backend %q", cfg.storage), nil)
+	}
+
+	// Wrap the models in the cache, if it is enabled, and publish its hit and miss counts. Invalidations are only shared between instances when they all
+	// use the same PostgreSQL database, and a single instance can turn sharing off with -cache-notify=false.
+	var cache *data.Cache
+
+	if cfg.cache.enabled {
+		cache = data.NewCache(cfg.cache.size, cfg.cache.ttl)
+		models = cache.Wrap(models)
+
+		if cfg.cache.notify && db != nil {
+			cache.Notify(db, func(err error) {
+				logger.PrintError(err, nil)
+			})
+		}
+
+		expvar.Publish("cache", expvar.Func(func() interface{} {
+			return cache.Stats()
+		}))
+	}
+
+	// Open the blob store for uploaded images. The local filesystem store creates the directory if it doesnt exist yet.
+	blobs, err := blob.NewLocalStore(cfg.blob.dir)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	//Declare an instance of the application struct, containing the config struct and the logger .
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		models:   models,
+		replicas: replicas,
+		cache:    cache,
+		blobs:    blobs,
+		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 	}
 
 	//call app.serve() to start the server
@@ -178,8 +351,51 @@ func main() {
 
 // The openDB() function returns a sql.DB connection pool.
 func openDB(cfg config) (*sql.DB, error) {
-	//use sql.open() to create an empty connection pool, using the DSN from the config struct
-	db, err := sql.Open("postgres", cfg.db.dsn)
+	db, err := newPool(cfg, cfg.db.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a context with a 5-second timeout deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	//Use pingContext() to establish a new connection to the database, passing in the context we created above as a parameter. If the connection couldn't be
+	//established successfully within the 5 second deadline, then this will return an error.
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Return the sql.DB connection pool
+	return db, nil
+}
+
+// The openReplicas() function returns a ReplicaSet with a connection pool for each of the read replicas. Unlike openDB() it doesnt check that they can be
+// reached, as that is up to the health checks.
+func openReplicas(cfg config, primary *sql.DB) (*data.ReplicaSet, error) {
+	var pools []*sql.DB
+
+	for _, dsn := range cfg.db.replicaDSNs {
+		db, err := newPool(cfg, dsn)
+		if err != nil {
+			for _, pool := range pools {
+				pool.Close()
+			}
+			return nil, err
+		}
+
+		pools = append(pools, db)
+	}
+
+	return data.NewReplicaSet(primary, pools), nil
+}
+
+// The newPool() function creates a connection pool for the given DSN, with the pool settings from the config struct. It doesnt connect to the database.
+func newPool(cfg config, dsn string) (*sql.DB, error) {
+	//use sql.open() to create an empty connection pool, using the DSN
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -193,23 +409,12 @@ func openDB(cfg config) (*sql.DB, error) {
 	// Use the time.ParseDuration() function to convert the idle timeoout duration string to a time.Duration type.
 	duration, err := time.ParseDuration(cfg.db.maxIdleTime)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	//Set the maximum idle timeout
 	db.SetConnMaxIdleTime(duration)
 
-	// Create a context with a 5-second timeout deadline.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	//Use pingContext() to establish a new connection to the database, passing in the context we created above as a parameter. If the connection couldn't be
-	//established successfully within the 5 second deadline, then this will return an error.
-	err = db.PingContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the sql.DB connection pool
 	return db, nil
 }
@@ -160,7 +160,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// Retrieve the details of the user associated withe the authentication token, again calling the invalidAuthenticationTokenResponse() helper
 		// iff no matching record was found. IMPORTANT: Notice that we are using ScopeAuthentication as the first parameter here.
 		//
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -218,7 +218,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 		user := app.contextGetUser(r)
 
 		// Get the slice of permissions for the user.
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -265,7 +265,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 						/// set the necessary preflight response headers, as discussed previously
 
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Runtime-Format, If-Match, If-None-Match")
 
 						// Write the headers along with a 200 OK status and return from the middleware with no further action
 						//
@@ -280,6 +280,44 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// The runtimeFormat() middleware reads the format that the client wants movie runtimes written in, from the runtime_format query string parameter or
+// else the Runtime-Format header, and sends a 422 response if it isnt one of data.RuntimeFormats. For any format but the default, the response writer is
+// wrapped so that writeJSON() and the export handler can find it.
+func (app *application) runtimeFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response may vary based on the Runtime-Format header, so add it to the Vary header.
+		w.Header().Add("Vary", "Runtime-Format")
+
+		format := app.readString(r.URL.Query(), "runtime_format", r.Header.Get("Runtime-Format"))
+		if format == "" || format == data.RuntimeText {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+		if v.Check(validator.In(format, data.RuntimeFormats...), "runtime_format", "invalid value"); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		next.ServeHTTP(runtimeFormatWriter{ResponseWriter: w, format: format}, r)
+	})
+}
+
+// The readFromPrimary() middleware makes requests which change data (anything but GET, HEAD and OPTIONS) read from the primary database rather than a
+// replica. The handlers for these requests often read back what they have just written, which the replicas might not have caught up with yet.
+func (app *application) readFromPrimary(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			r = r.WithContext(data.UsePrimary(r.Context()))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) metrics(next http.Handler) http.Handler {
 	// Initialize the new exxpvar variables when the middleware chain is first built.
 	totalRequestsReceived := expvar.NewInt("total_requests_received")
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/myk4040okothogodo/greenlight/internal/jsonlog"
+	"github.com/myk4040okothogodo/greenlight/internal/migrate"
+	"github.com/myk4040okothogodo/greenlight/migrations"
+	"strconv"
+)
+
+// The migrateCommand() function implements the "migrate" subcommand. It supports "up", "down N", "status" and "force V", using the migrations which are
+// embedded in the binary.
+func migrateCommand(db *sql.DB, logger *jsonlog.Logger, args []string) error {
+	migrator, err := migrate.New(db, migrations.Files)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		return errors.New("usage: migrate up | down N | status | force V")
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) != 1 {
+			return errors.New("usage: migrate up")
+		}
+		return migrateUp(ctx, migrator, logger)
+
+	case "down":
+		if len(args) != 2 {
+			return errors.New("usage: migrate down N")
+		}
+
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return errors.New("migrate down: N must be a positive integer")
+		}
+
+		reverted, err := migrator.Down(ctx, n)
+		for _, migration := range reverted {
+			logger.PrintInfo("rolled back migration", map[string]string{
+				"version": strconv.FormatInt(migration.Version, 10),
+				"name":    migration.Name,
+			})
+		}
+		return err
+
+	case "status":
+		if len(args) != 1 {
+			return errors.New("usage: migrate status")
+		}
+
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Version:\t%d\n", status.Version)
+		fmt.Printf("Dirty:\t\t%t\n", status.Dirty)
+		for _, migration := range status.Migrations {
+			state := "pending"
+			if migration.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%06d\t%s\t%s\n", migration.Version, state, migration.Name)
+		}
+		return nil
+
+	case "force":
+		if len(args) != 2 {
+			return errors.New("usage: migrate force V")
+		}
+
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return errors.New("migrate force: V must be a non-negative integer")
+		}
+
+		err = migrator.Force(ctx, version)
+		if err != nil {
+			return err
+		}
+
+		logger.PrintInfo("forced migration version", map[string]string{
+			"version": args[1],
+		})
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// The migrateUp() function applies any pending up migrations and logs each one. It is shared by "migrate up" and the -db-auto-migrate flag.
+func migrateUp(ctx context.Context, migrator *migrate.Migrator, logger *jsonlog.Logger) error {
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		logger.PrintInfo("applied migration", map[string]string{
+			"version": strconv.FormatInt(migration.Version, 10),
+			"name":    migration.Name,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		logger.PrintInfo("database schema is up to date", nil)
+	}
+
+	return nil
+}
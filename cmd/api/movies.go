@@ -6,6 +6,9 @@ import (
 	"github.com/myk4040okothogodo/greenlight/internal/data"
 	"github.com/myk4040okothogodo/greenlight/internal/validator"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 // Add a createMovieHandler for the "POST /v1/movies" endpoint. For now we will simply return a plain-text placeholder response
@@ -16,10 +19,13 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// created earlier). This struct will be our *target decode destination*
 	// )
 	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
+		Title        string            `json:"title"`
+		Year         int32             `json:"year"`
+		Runtime      data.Runtime      `json:"runtime"`
+		Genres       []string          `json:"genres"`
+		ExternalIDs  data.ExternalIDs  `json:"external_ids"`
+		Status       string            `json:"status"`
+		ReleaseDates data.ReleaseDates `json:"release_dates"`
 	}
 
 	// Use the new readJSON() helper to decode the request body into the input struct
@@ -31,29 +37,61 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Initialize a new Validator instance
+	v := validator.New()
+
+	force, match := app.readDuplicateCheck(r.URL.Query(), v)
+
+	// Load the genre vocabulary, so that the genres can be given by any of their names or aliases and are stored as their slugs.
+	vocabulary, err := app.genreVocabulary(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Copy the values from the input struct to a new Movie struct
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:        input.Title,
+		Year:         input.Year,
+		Runtime:      input.Runtime,
+		Genres:       vocabulary.Normalize(v, "genres", input.Genres),
+		ExternalIDs:  input.ExternalIDs,
+		Status:       input.Status,
+		ReleaseDates: input.ReleaseDates,
 	}
 
-	// Initialize a new Validator instance
-	v := validator.New()
+	// Movies are released unless the client says otherwise, and the year can be left out when the release dates are given.
+	if movie.Status == "" {
+		movie.Status = data.StatusReleased
+	}
+	if movie.Year == 0 {
+		movie.Year = movie.ReleaseYear()
+	}
 
 	// Call the ValidateMovie() function and return a response containing the error is any of the checks failed
 
+	data.ValidateExternalIDs(v, movie.ExternalIDs)
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// Refuse to create a movie which looks like one we already have, unless the client has said that it really is a different film.
+	if !force && !app.checkDuplicateMovies(w, r, movie, match) {
+		return
+	}
+
 	// Call the Insert() method on our movies model, passing in a pointer to the validated movie struct.
 	// This will create a record in the database and update the movie struct with the system-generated information
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(r.Context(), movie, app.contextGetUser(r).ID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "must not be used by another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -63,8 +101,9 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
 
-	//write a JSON response with a 201 Created status code, the movie data in the response body, and the location header.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	//write a JSON response with a 201 Created status code, the movie data in the response body, and the location header. The ETag lets the client make
+	// its later changes conditional with If-Match.
+	err = app.writeConditionalJSON(w, r, http.StatusCreated, envelope{"movie": movie}, headers, movieVersionTag(movie))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -87,27 +126,92 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The title can be given in the client's preferred language, which is read before the movie is fetched so that an invalid lang parameter is reported.
+	v := validator.New()
+	languages := app.readLanguages(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	//Call the Get() method to fetch the data foe a specific movie. We alseo need to use the errors.Is() function  to check if it return a
 	//data.ErrRecordNotFound error, in which case we send a 404 Not Found response to the client.
 
-	movie, err := app.models.Movies.Get(id)
+	// A movie which has been merged into another is redirected to it.
+	movie, err := app.models.Movies.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			app.mergedMovieResponse(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	// Encode the struct to JSON and send it as the HTTP response
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+
+	err = app.localizeMovies(w, r, languages, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Encode the struct to JSON and send it as the HTTP response, with the movie's ETag so that the client can make its changes conditional with If-Match.
+	// A client which already has exactly this response body gets a 304 Not Modified response instead.
+	err = app.writeConditionalJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil, movieVersionTag(movie))
 	if err != nil {
 		// Use the new serverErrorResponse() helper
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// The lookupMovieHandler() handles "GET /v1/movies/lookup", finding a movie by its ID in another catalogue. The ID is given in a query string parameter
+// named after its source, like "?imdb=tt0111161", and exactly one source must be given.
+func (app *application) lookupMovieHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	var source, externalID string
+	for _, s := range data.ExternalSources {
+		if id := app.readString(qs, s, ""); id != "" {
+			v.Check(source == "", "external_id", "must only be given for one source")
+			source, externalID = s, id
+		}
+	}
+	v.Check(source != "", "external_id", fmt.Sprintf("must be given as one of the parameters %s", strings.Join(data.ExternalSources, ", ")))
+
+	languages := app.readLanguages(r, v)
+
+	if v.Valid() {
+		data.ValidateExternalID(v, source, source, externalID)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetByExternalID(r.Context(), source, externalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.localizeMovies(w, r, languages, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeConditionalJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil, movieVersionTag(movie))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the movie ID from the URL.
 	id, err := app.readIDParam(r)
@@ -117,7 +221,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	//Fetch the existing movie record from the database , sending a 404 Not Found response to the client if we couldnt find a matching record.
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -128,12 +232,29 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// If the client says which version of the movie it edited with If-Match, the changes are only made to that version.
+	err = app.checkIfMatch(r, movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPreconditionRequired):
+			app.preconditionRequiredResponse(w, r)
+		default:
+			app.preconditionFailedResponse(w, r)
+		}
+		return
+	}
+
 	// Declare an input struct to hold the expected data from the client.
+	// The external IDs are merged into the movie's current IDs, and an ID which is null or empty removes the ID from that source. Release dates are merged
+	// in the same way, by region.
 	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+		Title        *string            `json:"title"`
+		Year         *int32             `json:"year"`
+		Runtime      *data.Runtime      `json:"runtime"`
+		Genres       []string           `json:"genres"`
+		ExternalIDs  map[string]*string `json:"external_ids"`
+		Status       *string            `json:"status"`
+		ReleaseDates map[string]*string `json:"release_dates"`
 	}
 
 	// Read the JSON request body data into the input struct
@@ -160,38 +281,200 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Runtime = *input.Runtime
 	}
 
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+	if input.Status != nil {
+		movie.Status = *input.Status
+	}
+
+	// When the release dates change, the year follows the earliest one unless the client has given the year as well.
+	if input.ReleaseDates != nil {
+		releaseDates := data.ReleaseDates{}
+		for region, date := range movie.ReleaseDates {
+			releaseDates[region] = date
+		}
+		for region, date := range input.ReleaseDates {
+			if date == nil || *date == "" {
+				delete(releaseDates, region)
+				continue
+			}
+			releaseDates[region] = *date
+		}
+		movie.ReleaseDates = releaseDates
+
+		if year := movie.ReleaseYear(); input.Year == nil && year != 0 {
+			movie.Year = year
+		}
 	}
 
 	// Validate the updated movie record, sending the client a 422 Unprocessable Entity response if any check fails.
 	v := validator.New()
 
+	force, match := app.readDuplicateCheck(r.URL.Query(), v)
+
+	// New genres are mapped to their slugs in the same way as in createMovieHandler().
+	if input.Genres != nil {
+		vocabulary, err := app.genreVocabulary(r.Context())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		movie.Genres = vocabulary.Normalize(v, "genres", input.Genres)
+	}
+
+	if input.ExternalIDs != nil {
+		externalIDs := data.ExternalIDs{}
+		for source, id := range movie.ExternalIDs {
+			externalIDs[source] = id
+		}
+		for source, id := range input.ExternalIDs {
+			if id == nil || *id == "" {
+				delete(externalIDs, source)
+				continue
+			}
+			externalIDs[source] = *id
+		}
+		movie.ExternalIDs = externalIDs
+	}
+
+	data.ValidateExternalIDs(v, movie.ExternalIDs)
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// The duplicate check is only made when the title or year changes, so that movies which were saved with force=true can still be edited.
+	if (input.Title != nil || input.Year != nil) && !force && !app.checkDuplicateMovies(w, r, movie, match) {
+		return
+	}
+
 	// Intercept any ErrEditConflict error and call the new editConflictResponse() helper.
 
-	err = app.models.Movies.Update(movie)
+	// The movie can still be changed by another request after it was checked against If-Match, in which case Update() returns ErrEditConflict and the
+	// precondition has failed after all.
+	err = app.models.Movies.Update(r.Context(), movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && len(r.Header.Values("If-Match")) > 0:
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "must not be used by another movie")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	//write the updated movie record in a JSON response
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	//write the updated movie record in a JSON response, with the ETag of its new version.
+	err = app.writeConditionalJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil, movieVersionTag(movie))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// The mergeMovieHandler() handles "POST /v1/movies/:id/merge", folding the movie given by movie_id in the request body into this one. The other movie is
+// deleted, and requests for it are redirected to this one from then on.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.MovieID > 0, "movie_id", "must be a positive integer")
+	v.Check(input.MovieID != id, "movie_id", "must not be the movie being merged into")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Merge(r.Context(), input.MovieID, id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTooManyGenres):
+			v.AddError("movie_id", "must not have genres which would give the merged movie more than 5 genres")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The images of the merged movie were deleted along with it.
+	app.deleteMovieBlobs(input.MovieID)
+
+	err = app.writeConditionalJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil, movieVersionTag(movie))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The mergedMovieResponse() helper is used when a movie couldnt be found. If the movie was merged into another it sends a 301 Moved Permanently response
+// pointing to that movie, and otherwise a 404 Not Found response.
+func (app *application) mergedMovieResponse(w http.ResponseWriter, r *http.Request, id int64) {
+	targetID, err := app.models.Movies.GetMergedInto(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", targetID))
+
+	err = app.writeJSON(w, http.StatusMovedPermanently, envelope{"message": fmt.Sprintf("the movie has been merged into movie %d", targetID)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readDuplicateCheck() helper reads the query string parameters which control the duplicate check on a new or changed movie: force=true skips the
+// check, and duplicate_match chooses how movies are matched.
+func (app *application) readDuplicateCheck(qs url.Values, v *validator.Validator) (bool, string) {
+	force := app.readBool(qs, "force", false, v)
+
+	match := app.readString(qs, "duplicate_match", data.DuplicateExact)
+	v.Check(validator.In(match, data.DuplicateMatches...), "duplicate_match", "must be exact or fuzzy")
+
+	return force, match
+}
+
+// The checkDuplicateMovies() helper looks for movies which are probably the same film as the movie, and sends a 409 Conflict response listing their ids if
+// there are any. It returns false if a response has been sent.
+func (app *application) checkDuplicateMovies(w http.ResponseWriter, r *http.Request, movie *data.Movie, match string) bool {
+	duplicates, err := app.models.Movies.FindDuplicates(r.Context(), movie, match)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if len(duplicates) > 0 {
+		app.duplicateMovieResponse(w, r, duplicates)
+		return false
+	}
+
+	return true
+}
+
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the movie ID from the URL
 	id, err := app.readIDParam(r)
@@ -200,12 +483,29 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Delete the movie from the database, sending a 404 Not found response to the client is there is nst a matching record.
-	err = app.models.Movies.Delete(id)
+	// Delete the movie from the database, sending a 404 Not found response to the client is there is nst a matching record. The movie is checked
+	// against the If-Match header in the same transaction, so that it cant be changed between the check and the delete.
+	err = app.models.WithTx(r.Context(), func(models data.Models) error {
+		movie, err := models.Movies.Get(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		err = app.checkIfMatch(r, movie)
+		if err != nil {
+			return err
+		}
+
+		return models.Movies.Delete(r.Context(), id, app.contextGetUser(r).ID)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, errPreconditionRequired):
+			app.preconditionRequiredResponse(w, r)
+		case errors.Is(err, errPreconditionFailed):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -223,9 +523,11 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	// To keep things consistent with our other handlers, we'll define an input struct to hold the expected values from the request query string.
 	//
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieFilters
 		data.Filters
+		Highlight bool
+		Facets    []string
+		Languages []string
 	}
 
 	// Initialize a new validator instance
@@ -234,11 +536,15 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	// Call r.URL.Query() to get the url.Values map containing the query string data.
 	qs := r.URL.Query()
 
-	// Use our helpers to extract the title and genres query string values, falling back  to defaults of an empty string and an empty slice respectively if they
+	// Use our helpers to extract the title, genres and range filters from the query string, falling back to defaults which dont filter anything out if they
 	// are not provided by the client
 	//
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	err := app.canonicalGenreFilters(r.Context(), &input.MovieFilters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// Get the page and page_size query string values as integers. Notice that we set the default page value to 1 and the default Page_size to 20, and then we pass the
 	// validator instance as the final argument here.
@@ -246,28 +552,159 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
+	// Read the opaque cursor returned in the next_cursor or prev_cursor metadata, which can be used instead of page, and whether the total number of matching
+	// records should be counted.
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.IncludeTotal = app.readBool(qs, "include_total", true, v)
+
 	//Extract the sort query string value.falling back to "id" if its not provided by the client()
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	// Add the supported sort values for this endpoint to the sort safelist
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "rating", "relevance", "-id", "-title", "-year", "-runtime", "-rating"}
+
+	// Read whether the matching words in each title should be marked up in a highlight field, and which facets to count the matching movies by.
+	input.Highlight = app.readBool(qs, "highlight", false, v)
+	input.Facets = app.readCSV(qs, "facets", []string{})
+
+	// Read the languages that the titles should be translated into, if the movies have translations into them.
+	input.Languages = app.readLanguages(r, v)
 
 	//Execute the validation checks on the Filters struct and send a response containing the errors if neccessary.
+	data.ValidateMovieFilters(v, input.MovieFilters)
+	v.Check(input.Sort != "relevance" || input.Title != "", "sort", "must not be relevance unless searching by title")
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicate values")
+	for _, facet := range input.Facets {
+		if !validator.In(facet, data.MovieFacets...) {
+			v.AddError("facets", "must only contain genres, decade or runtime_bucket")
+			break
+		}
+	}
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Call the GetAll() method to retrieve the movies, passing in the various filter parameters.
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(r.Context(), input.MovieFilters, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidCursor):
+			v.AddError("cursor", "must be a valid cursor")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The facets count every movie matching the filters, not just the ones on this page.
+	var facets data.Facets
+	if len(input.Facets) > 0 {
+		facets, err = app.models.Movies.Facets(r.Context(), input.MovieFilters, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Translate the titles before highlighting them, so that the highlight matches the title which is shown.
+	err = app.localizeMovies(w, r, input.Languages, movies...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
+	}
 
+	if input.Highlight {
+		for _, movie := range movies {
+			movie.Highlight = data.HighlightTitle(movie.Title, input.Title, input.SearchMode)
+		}
 	}
 
 	// Send a JSON response containing the movie data.
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	env := envelope{"movies": movies, "metadata": metadata}
+	if facets != nil {
+		env["facets"] = facets
+	}
+
+	// The page has no version of its own, so its ETag is made from the body, and a client which already has the same page gets a 304 Not Modified response.
+	err = app.writeConditionalJSON(w, r, http.StatusOK, env, nil, "")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// The readMovieFilters() helper reads the filters shared by "GET /v1/movies" and "GET /v1/movies/export" from the query string. search_mode says how the title
+// is matched (words, prefix or fuzzy). genres_all is another name for genres, and takes precedence if both are given. Any values which cant be parsed are
+// recorded in the validator instance.
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) data.MovieFilters {
+	var f data.MovieFilters
+
+	f.Title = app.readString(qs, "title", "")
+	f.SearchMode = app.readString(qs, "search_mode", data.SearchWords)
+	f.Genres = app.readCSV(qs, "genres_all", app.readCSV(qs, "genres", []string{}))
+	f.GenresAny = app.readCSV(qs, "genres_any", []string{})
+	f.ExcludeGenres = app.readCSV(qs, "exclude_genres", []string{})
+
+	f.YearMin = app.readYear(qs, "year_min", v)
+	f.YearMax = app.readYear(qs, "year_max", v)
+
+	f.RuntimeMin = app.readRuntime(qs, "runtime_min", 0, v)
+	f.RuntimeMax = app.readRuntime(qs, "runtime_max", 0, v)
+
+	f.CreatedAfter = app.readTime(qs, "created_after", v)
+	f.CreatedBefore = app.readTime(qs, "created_before", v)
+
+	f.PersonID = int64(app.readInt(qs, "person_id", 0, v))
+
+	f.HasExternalIDs = app.readCSV(qs, "has_external_ids", []string{})
+	f.MissingExternalIDs = app.readCSV(qs, "missing_external_ids", []string{})
+
+	f.Statuses = app.readCSV(qs, "status", []string{})
+	f.ReleasedFrom, f.ReleasedTo = app.readReleasedBetween(qs, v)
+	f.ReleaseRegion = app.readString(qs, "release_region", "")
+
+	return f
+}
+
+// readReleasedBetween reads the released_between range from the query string, which is two dates separated by a comma like "2020-01-01,2020-12-31". Either
+// date can be left out for a range which is open at that end.
+func (app *application) readReleasedBetween(qs url.Values, v *validator.Validator) (time.Time, time.Time) {
+	s := qs.Get("released_between")
+	if s == "" {
+		return time.Time{}, time.Time{}
+	}
+
+	var dates [2]time.Time
+
+	from, to, ok := strings.Cut(s, ",")
+	for i, part := range []string{from, to} {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		date, err := data.ParseDate(part)
+		if err != nil {
+			ok = false
+			break
+		}
+		dates[i] = date
+	}
+
+	if !ok {
+		v.AddError("released_between", "must be two dates separated by a comma like 2020-01-01,2020-12-31, either of which can be left out")
+		return time.Time{}, time.Time{}
+	}
+
+	return dates[0], dates[1]
+}
+
+// readYear reads a year from the query string, returning zero if it is missing or isnt a plausible year.
+func (app *application) readYear(qs url.Values, key string, v *validator.Validator) int32 {
+	year := app.readInt(qs, key, 0, v)
+	if year < 0 || year > 9999 {
+		v.AddError(key, "must be between 0 and 9999")
+		return 0
+	}
+
+	return int32(year)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"github.com/myk4040okothogodo/greenlight/internal/jsonlog"
+	"time"
+)
+
+// The checkReplicas() method health checks the read replicas at the configured interval until the done channel is closed, logging any which go down or
+// come back up.
+func (app *application) checkReplicas(done <-chan struct{}) {
+	ticker := time.NewTicker(app.config.db.replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			logReplicaHealth(app.logger, app.replicas.CheckHealth(context.Background()))
+		}
+	}
+}
+
+// The logReplicaHealth() function logs changes in the health of the read replicas. Replicas going down are logged as errors, so that they get noticed.
+func logReplicaHealth(logger *jsonlog.Logger, changes []data.ReplicaHealth) {
+	for _, change := range changes {
+		properties := map[string]string{"replica": change.Name}
+
+		if change.Healthy {
+			logger.PrintInfo("database replica is healthy", properties)
+		} else {
+			logger.PrintError(change.Err, properties)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"math"
+	"net/http"
+)
+
+// The listMovieRevisionsHandler() handles "GET /v1/movies/:id/revisions", returning the revision history of a movie newest first. The history is kept after
+// a movie is deleted, so this doesnt check that the movie still exists.
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	// Revisions are always returned newest first, so only the pagination part of the filters is read from the query string.
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "-version",
+		SortSafelist: []string{"-version"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.MovieRevisions.GetAllForMovie(r.Context(), id, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showMovieRevisionHandler() handles "GET /v1/movies/:id/revisions/:version", returning the state of a movie at a specific version.
+func (app *application) showMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readIntParam(r, "version")
+	if err != nil || version > math.MaxInt32 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.MovieRevisions.Get(r.Context(), id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revertMovieHandler() handles "POST /v1/movies/:id/revert". It copies the state of an earlier revision onto the current movie and saves it through the
+// normal Update() method, so a revert creates a new version and fails with an edit conflict if somebody else changed the movie at the same time. As for an
+// update, the revert can be made conditional on the current version with If-Match.
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Version int32 `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Version > 0, "version", "must be a positive integer"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.checkIfMatch(r, movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPreconditionRequired):
+			app.preconditionRequiredResponse(w, r)
+		default:
+			app.preconditionFailedResponse(w, r)
+		}
+		return
+	}
+
+	revision, err := app.models.MovieRevisions.Get(r.Context(), id, input.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("version", "no revision exists with this version")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Copy the content of the revision onto the current movie. The ID and Version fields are left alone, so that Update() checks against the version we
+	// just read.
+	movie.Title = revision.Movie.Title
+	movie.Year = revision.Movie.Year
+	movie.Runtime = revision.Movie.Runtime
+	movie.Status = revision.Movie.Status
+
+	// Revisions recorded before release dates and external IDs were kept dont have them, in which case the movie keeps its current ones, along with the
+	// year of the earliest release date.
+	if revision.Movie.ReleaseDates != nil {
+		movie.ReleaseDates = revision.Movie.ReleaseDates
+	}
+	if revision.Movie.ExternalIDs != nil {
+		movie.ExternalIDs = revision.Movie.ExternalIDs
+	}
+	if year := movie.ReleaseYear(); year != 0 {
+		movie.Year = year
+	}
+
+	// The genres of an old revision may have been renamed or merged since, so they are mapped to their current slugs. A revision with a genre which no
+	// longer exists can't be reverted to.
+	vocabulary, err := app.genreVocabulary(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	movie.Genres = vocabulary.Normalize(v, "genres", revision.Movie.Genres)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The revision was valid when it was recorded, but the rules may have changed since, and a movie which kept its current release dates may not match
+	// the status of the revision, so the movie is validated again before it is saved.
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Movies.Update(r.Context(), movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && len(r.Header.Values("If-Match")) > 0:
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "must not be used by another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeConditionalJSON(w, r, http.StatusOK, envelope{"movie": movie}, nil, movieVersionTag(movie))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -25,9 +25,73 @@ func (app *application) routes() http.Handler {
 	// Add the route for the GET /v1/movies endpoint
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticIDRoutes(app.methodNotAllowedResponse, map[string]http.HandlerFunc{
+		"import": app.requirePermission("movies:write", app.importMoviesHandler),
+	}))
+	// httprouter doesnt allow a fixed path segment like "trash" in the same position as the :id parameter, so fixed paths under /v1/movies/ are
+	// dispatched by the staticIDRoutes() helper instead.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticIDRoutes(app.requirePermission("movies:read", app.showMovieHandler), map[string]http.HandlerFunc{
+		"trash":  app.requirePermission("movies:write", app.listTrashedMoviesHandler),
+		"export": app.requirePermission("movies:export", app.exportMoviesHandler),
+		"lookup": app.requirePermission("movies:read", app.lookupMovieHandler),
+	}))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	// Add the routes for reading the revision history of a movie and reverting it to an earlier version.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movies:read", app.listMovieRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.requirePermission("movies:read", app.showMovieRevisionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert", app.requirePermission("movies:write", app.revertMovieHandler))
+	// Add the routes for restoring a movie from the trash and for permanently deleting it, which needs its own permission.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/purge", app.requirePermission("movies:purge", app.purgeMovieHandler))
+	// Add the route for merging a duplicate movie into another.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.requirePermission("movies:write", app.mergeMovieHandler))
+	// Add the routes for the translated titles and synopses of a movie, one per language.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.requirePermission("movies:read", app.listMovieTranslationsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations/:language", app.requirePermission("movies:write", app.putMovieTranslationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/translations/:language", app.requirePermission("movies:write", app.deleteMovieTranslationHandler))
+	// Add the routes for the cast and crew of a movie, and for managing the people who are credited. People are part of the movie catalogue, so they use the same
+	// permissions as movies.
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requirePermission("movies:read", app.listMovieCreditsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.createMovieCreditHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.requirePermission("movies:write", app.deleteMovieCreditHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission("movies:read", app.listPeopleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission("movies:write", app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission("movies:read", app.showPersonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission("movies:write", app.updatePersonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission("movies:write", app.deletePersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id/filmography", app.requirePermission("movies:read", app.showFilmographyHandler))
+	// Add the routes for users to rate and review movies. Anyone who can read movies can rate them, and users can only change their own rating.
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/ratings", app.requirePermission("movies:read", app.createRatingHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/ratings", app.requirePermission("movies:read", app.updateRatingHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/ratings", app.requirePermission("movies:read", app.deleteRatingHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission("movies:read", app.listMovieReviewsHandler))
+	// Add the routes for users' watchlists and custom lists. Users can only see and change their own lists (the :id can be "watchlist" for their watchlist),
+	// apart from public lists which anyone can read through their share slug.
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requirePermission("movies:read", app.listListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission("movies:read", app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requirePermission("movies:read", app.showListHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission("movies:read", app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission("movies:read", app.deleteListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id/movies", app.requirePermission("movies:read", app.listListItemsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/movies", app.requirePermission("movies:read", app.addListItemHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id/movies/:movie_id", app.requirePermission("movies:read", app.updateListItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/movies/:movie_id", app.requirePermission("movies:read", app.removeListItemHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/shared-lists/:slug", app.requirePermission("movies:read", app.showSharedListHandler))
+	// Add the routes for uploading the poster and stills of a movie, and for serving the images. Images are served without authentication, so that
+	// their URLs can be used directly by browsers.
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requirePermission("movies:write", app.putMoviePosterHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/poster", app.requirePermission("movies:write", app.deleteMoviePosterHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/stills", app.requirePermission("movies:read", app.listMovieStillsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/stills", app.requirePermission("movies:write", app.createMovieStillHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/stills/:image_id", app.requirePermission("movies:write", app.deleteMovieStillHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/media/*key", app.showMediaHandler)
+	// Add the routes for the genre vocabulary. Changing genres rewrites movies across the whole catalogue, so it needs its own permission.
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("movies:read", app.listGenresHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission("genres:write", app.createGenreHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.requirePermission("movies:read", app.showGenreHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:id", app.requirePermission("genres:write", app.updateGenreHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres/:id/merge", app.requirePermission("genres:write", app.mergeGenreHandler))
 	// Add the route for the POST /v1/users endpoint
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
@@ -38,5 +102,20 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
 	// Return the httprouter instance
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(app.readFromPrimary(app.runtimeFormat(router)))))))
+}
+
+// The staticIDRoutes() helper returns a handler for a route ending in the :id parameter which sends requests where the parameter is one of the fixed names
+// in the static map (like "trash" in /v1/movies/trash) to the matching handler, and all other requests to the next handler.
+func (app *application) staticIDRoutes(next http.HandlerFunc, static map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
 }
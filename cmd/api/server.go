@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,6 +13,11 @@ import (
 )
 
 func (app *application) serve() error {
+	// Create a base context for every request. Request contexts (and so the database queries made with them) are derived from this, which lets us cancel
+	// any queries which are still running once the graceful shutdown period is over.
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
 	//Declare a HTTP server using the same settings as in our main() function.
 	//
 	srv := &http.Server{
@@ -20,11 +26,39 @@ func (app *application) serve() error {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+		// Put each connection in the context of its requests, so that handlers which stream long responses can extend the WriteTimeout.
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey, conn)
+		},
 	}
 
 	//Create a shutdown channel. We will use this to receive any errors returned  by graceful shutdown() function
 	shutdownError := make(chan error)
 
+	// Start the long-running background jobs. Closing the stopJobs channel tells them to return, so that app.wg.Wait() doesnt block forever during shutdown.
+	stopJobs := make(chan struct{})
+
+	if app.config.trash.retention > 0 {
+		app.background(func() {
+			app.purgeTrashedMovies(stopJobs)
+		})
+	}
+
+	if app.replicas != nil {
+		app.background(func() {
+			app.checkReplicas(stopJobs)
+		})
+	}
+
+	if app.cache != nil && app.config.cache.notify && app.config.storage == "postgres" {
+		app.background(func() {
+			app.listenForCacheInvalidations(stopJobs)
+		})
+	}
+
 	go func() {
 		// Intercept the signals, as before
 		quit := make(chan os.Signal, 1)
@@ -45,9 +79,13 @@ func (app *application) serve() error {
 		// context deadline is hit). We relay this return value to the shutdownError channel
 		err := srv.Shutdown(ctx)
 		if err != nil {
+			// The deadline passed with requests still in flight, so cancel the base context to abandon any database queries they are waiting on.
+			cancelBase()
 			shutdownError <- err
 		}
 
+		close(stopJobs)
+
 		// Log a message to say that we are waitin for any background goroutines to complete their tasks,
 		app.logger.PrintInfo("Completing background tasks", map[string]string{
 			"addr": srv.Addr,
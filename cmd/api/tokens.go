@@ -34,7 +34,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 
 	// Lookup the user record based on the email address. If no matching user was found, then we call the app.invalidCredentialsResponse() helper
 	// to senda 401 Unauthorized response to the client
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -60,7 +60,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 
 	//Otherwise, if the password is correct, we generate a new token with a 24- hour expiry time and the scope "authentication".
 	//
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, 24*time.Hour, data.ScopeAuthentication)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
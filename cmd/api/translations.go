@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/myk4040okothogodo/greenlight/internal/data"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The listMovieTranslationsHandler() handles "GET /v1/movies/:id/translations", returning every translation of a movie ordered by language.
+func (app *application) listMovieTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Check that the movie exists (and isnt in the trash), so that a missing movie is a 404 rather than an empty list.
+	_, err = app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	translations, err := app.models.Translations.GetAllForMovies(r.Context(), []int64{id})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	list := translations[id]
+	if list == nil {
+		list = []*data.Translation{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"translations": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The putMovieTranslationHandler() handles "PUT /v1/movies/:id/translations/:language", setting the title and synopsis of a movie in a language. Any
+// existing translation into the same language is replaced.
+func (app *application) putMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title    string `json:"title"`
+		Synopsis string `json:"synopsis"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	translation := &data.Translation{
+		MovieID:  id,
+		Language: httprouter.ParamsFromContext(r.Context()).ByName("language"),
+		Title:    input.Title,
+		Synopsis: input.Synopsis,
+	}
+
+	v := validator.New()
+
+	if data.ValidateTranslation(v, translation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Store the language in its canonical case, so that "pt-br" and "pt-BR" are the same translation.
+	translation.Language, _ = data.NormalizeLanguage(translation.Language)
+
+	err = app.models.Translations.Put(r.Context(), translation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"translation": translation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteMovieTranslationHandler() handles "DELETE /v1/movies/:id/translations/:language".
+func (app *application) deleteMovieTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	language, ok := data.NormalizeLanguage(httprouter.ParamsFromContext(r.Context()).ByName("language"))
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Translations.Delete(r.Context(), id, language)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "translation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readLanguages() helper returns the languages that the client would like movies in, most preferred first. They are taken from the lang query string
+// parameter (a comma-separated list) if it is given, and otherwise from the Accept-Language header. Tags in the header which dont suit translations are
+// skipped, but an invalid lang parameter is recorded in the validator instance.
+func (app *application) readLanguages(r *http.Request, v *validator.Validator) []string {
+	languages := []string{}
+
+	qs := r.URL.Query()
+	if qs.Has("lang") {
+		for _, tag := range app.readCSV(qs, "lang", []string{}) {
+			language, ok := data.NormalizeLanguage(tag)
+			if !ok {
+				v.AddError("lang", "must be a comma-separated list of language tags like en or pt-BR")
+				return nil
+			}
+			languages = append(languages, language)
+		}
+		return languages
+	}
+
+	// Each language in the header may have a quality value, like "fr-CH, fr;q=0.9, en;q=0.8". Languages without one have the highest quality, and those
+	// with a quality of zero are not acceptable at all.
+	type weighted struct {
+		language string
+		quality  float64
+	}
+	preferences := []weighted{}
+
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			q, err := strconv.ParseFloat(params[2:], 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+
+		language, ok := data.NormalizeLanguage(strings.TrimSpace(tag))
+		if !ok || quality <= 0 {
+			continue
+		}
+
+		preferences = append(preferences, weighted{language, quality})
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	for _, preference := range preferences {
+		languages = append(languages, preference.language)
+	}
+
+	return languages
+}
+
+// The localizeMovies() helper replaces the title of each movie with its translation into the language which best suits the client (see readLanguages()),
+// where it has one. The response depends on the Accept-Language header, so that is added to the Vary header, and a response for a single movie which has
+// been translated also gets a Content-Language header.
+func (app *application) localizeMovies(w http.ResponseWriter, r *http.Request, languages []string, movies ...*data.Movie) error {
+	w.Header().Add("Vary", "Accept-Language")
+
+	if len(languages) == 0 || len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	translations, err := app.models.Translations.GetAllForMovies(r.Context(), ids)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		if translation := data.BestTranslation(translations[movie.ID], languages); translation != nil {
+			movie.Localize(translation)
+		}
+	}
+
+	if len(movies) == 1 && movies[0].Language != "" {
+		w.Header().Set("Content-Language", movies[0].Language)
+	}
+
+	return nil
+}
@@ -48,8 +48,24 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Insert the user data into the database
-	err = app.models.Users.Insert(user)
+	// Insert the user data into the database, add the "movies:read" permission for the new user and generate a new activation token for them. These are
+	// done in a single transaction, so that a failure part way through cant leave an account with no permissions or no way to activate it.
+	var token *data.Token
+
+	err = app.models.WithTx(r.Context(), func(models data.Models) error {
+		err := models.Users.Insert(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		err = models.Permissions.AddForUser(r.Context(), user.ID, "movies:read")
+		if err != nil {
+			return err
+		}
+
+		token, err = models.Tokens.New(r.Context(), user.ID, 3*24*time.Hour, data.ScopeActivation)
+		return err
+	})
 	if err != nil {
 		switch {
 		// If we get an ErrDuplicateEmail error, use the v.AddError() method to manually add a message to the validator instance, and then call our
@@ -62,19 +78,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	// Add the "movies:read" permission for the new user.
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// After the user record has been created in the database, generate a new activation token for the user.
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
 
 	// Use the background helper to execute an anonymous function that sends the welcome email.
 	app.background(func() {
@@ -122,29 +125,37 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Retrieve the details of the user associated with the token using the GetForToken() method (which we will create in a minute).
-	// If no matching record is found, then we let the client know that the token they provided is not valid.
-	//
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
-			app.failedValidationResponse(w, r, v.Errors)
-		default:
-			app.serverErrorResponse(w, r, err)
+	// Retrieve the details of the user associated with the token, activate them and delete all of their activation tokens in a single transaction, so that
+	// the token can't be left behind for an activated user (or used twice by concurrent requests).
+	var user *data.User
+
+	err = app.models.WithTx(r.Context(), func(models data.Models) error {
+		var err error
+
+		user, err = models.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
+		if err != nil {
+			return err
 		}
-		return
-	}
 
-	//update the user's activation status
-	user.Activated = true
+		//update the user's activation status
+		user.Activated = true
 
-	//save the updated user record in our database, checking for any edit conflicts in the same way that the we ddid for our movie records.
-	//
-	err = app.models.Users.Update(user)
+		//save the updated user record in our database, checking for any edit conflicts in the same way that the we ddid for our movie records.
+		//
+		err = models.Users.Update(r.Context(), user)
+		if err != nil {
+			return err
+		}
+
+		// If everything went successfully, then we delete all activation tokens for the user.
+		return models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
+	})
 	if err != nil {
 		switch {
+		// If no matching record is found, then we let the client know that the token they provided is not valid.
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -153,14 +164,6 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// If everything went successfully, then we delete all activation tokens for the user.
-
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	// send the updated user details to the client in a JSON response
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
@@ -0,0 +1,146 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when opening a key which hasnt been stored.
+	ErrNotFound = errors.New("blob not found")
+
+	// ErrInvalidKey is returned for keys which arent slash-separated relative paths, like "movies/1/poster.jpg".
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// The Store interface describes a place to keep binary objects, like uploaded images, under slash-separated keys. The LocalStore keeps them on the local
+// filesystem, but another implementation (such as an object storage service) can be swapped in without the handlers needing to know.
+type Store interface {
+	// Put stores the contents of r under the key, replacing anything already stored there. Readers never see a partly written object.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Open returns the object stored under the key, or ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+
+	// DeleteAll removes every object whose key starts with the prefix followed by a slash, like "movies/1" for "movies/1/poster.jpg". It is not an error
+	// if there are none.
+	DeleteAll(ctx context.Context, prefix string) error
+}
+
+// The LocalStore type is a Store which keeps each object in a file under a root directory, at the path given by its key.
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore returns a LocalStore which keeps its files under the given directory, creating it if it doesnt exist.
+func NewLocalStore(root string) (*LocalStore, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{root: root}, nil
+}
+
+// path returns the filesystem path for a key. Keys are validated with fs.ValidPath(), so they can't escape the root directory.
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "." || !fs.ValidPath(key) || strings.Contains(key, `\`) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object to a temporary file in the same directory and then renames it into place, so that a concurrent Open() sees either the old object
+// or the whole of the new one.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, contextReader{ctx: ctx, r: r})
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	// Directories (the parents of other keys) arent objects.
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		if err == nil {
+			err = ErrNotFound
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *LocalStore) DeleteAll(ctx context.Context, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	path, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(path)
+}
+
+// contextReader stops a copy when the context is cancelled, so that an abandoned upload doesnt keep writing.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
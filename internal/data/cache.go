@@ -0,0 +1,360 @@
+package data
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheChannel is the PostgreSQL notification channel that caches use to tell each other about invalidations.
+const cacheChannel = "greenlight_cache"
+
+// cacheNotifyTimeout is how long an invalidation notification may take to send.
+const cacheNotifyTimeout = 2 * time.Second
+
+// The tables held in a Cache. Invalidations name one of them, along with the id of the movie or user whose entries are out of date (or 0 for all of them).
+const (
+	cacheMovies      = "movies"
+	cachePermissions = "permissions"
+	cacheUsers       = "users"
+)
+
+// CacheStats reports on one of the tables in a Cache.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+}
+
+// An lruCache holds up to a fixed number of entries, each for up to a fixed time. When it is full, adding an entry evicts the least recently used one.
+type lruCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[K]*list.Element
+	stats   CacheStats
+
+	// generation is incremented whenever entries are removed. A value read from the models while it was being removed would be out of date, so set()
+	// only adds values which were read during the current generation.
+	generation uint64
+}
+
+// An lruEntry is the value of an element in the order list of an lruCache.
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func newLRUCache[K comparable, V any](size int, ttl time.Duration) *lruCache[K, V] {
+	return &lruCache[K, V]{size: size, ttl: ttl, order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+// get returns the value for the key, if there is one which hasnt expired.
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*lruEntry[K, V])
+		if time.Now().Before(entry.expires) {
+			c.order.MoveToFront(e)
+			c.stats.Hits++
+			return entry.value, true
+		}
+		c.remove(e)
+	}
+
+	c.stats.Misses++
+
+	var zero V
+	return zero, false
+}
+
+// currentGeneration returns the generation to pass to set() for a value which is about to be read.
+func (c *lruCache[K, V]) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// set adds or replaces the value for the key, evicting the least recently used entry if the cache is full. It does nothing if entries have been removed
+// since the given generation, as the value may have been read before a write which made it out of date.
+func (c *lruCache[K, V]) set(generation uint64, key K, value V) {
+	c.setUntil(generation, key, value, time.Time{})
+}
+
+// setUntil is like set, but the entry also expires at the given time if that is sooner than the cache's ttl. A zero time sets no earlier expiry.
+func (c *lruCache[K, V]) setUntil(generation uint64, key K, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	entry := &lruEntry[K, V]{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	if !expires.IsZero() && expires.Before(entry.expires) {
+		entry.expires = expires
+	}
+
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// removeFunc removes every entry for which fn returns true.
+func (c *lruCache[K, V]) removeFunc(fn func(K, V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for e := c.order.Front(); e != nil; {
+		next := e.Next()
+		if entry := e.Value.(*lruEntry[K, V]); fn(entry.key, entry.value) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// remove removes an element. The caller must hold the lock.
+func (c *lruCache[K, V]) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*lruEntry[K, V]).key)
+}
+
+func (c *lruCache[K, V]) statistics() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// A Cache holds recently read movies, user permissions and the users for authentication tokens, in front of the models that Wrap() is given. Each table
+// holds up to a fixed number of entries for up to a fixed time. Writes made through the wrapped models remove the entries they make out of date, and with
+// Notify() and Listen() the caches of other instances of the API are told to remove them too.
+type Cache struct {
+	movies      *lruCache[int64, Movie]
+	permissions *lruCache[int64, Permissions]
+	users       *lruCache[string, User]
+
+	// base holds the models that the cache wraps.
+	base Models
+
+	// instance identifies this cache in the notifications it sends, so that it can ignore its own.
+	instance string
+
+	notifyDB DBTX
+	onError  func(error)
+}
+
+// A cacheInvalidation names a table in the cache and the id of the movie or user whose entries are out of date, or 0 for all of them.
+type cacheInvalidation struct {
+	table string
+	id    int64
+}
+
+// A cacheTx collects the invalidations for the writes made in a transaction, so that they are only applied once it has finished. Otherwise another request
+// could read the old values back into the cache before the transaction commits.
+type cacheTx struct {
+	mu            sync.Mutex
+	invalidations []cacheInvalidation
+}
+
+// NewCache returns a cache with up to size entries in each table, which are each kept for up to ttl.
+func NewCache(size int, ttl time.Duration) *Cache {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &Cache{
+		movies:      newLRUCache[int64, Movie](size, ttl),
+		permissions: newLRUCache[int64, Permissions](size, ttl),
+		users:       newLRUCache[string, User](size, ttl),
+		instance:    hex.EncodeToString(id),
+	}
+}
+
+// Wrap() returns a copy of the models with the movie, permission and user lookups cached. The rating, image and genre models are wrapped too, as their
+// writes change the cached movies.
+func (c *Cache) Wrap(models Models) Models {
+	c.base = models
+
+	wrapped := c.wrap(models, nil)
+	wrapped.cache = c
+	return wrapped
+}
+
+// wrap returns a copy of the models wrapped by the cache. Inside a transaction (when tx isnt nil) the lookups go straight to the models, and the
+// invalidations are collected in tx.
+func (c *Cache) wrap(models Models, tx *cacheTx) Models {
+	models.Movies = CachedMovieModel{MovieModelInterface: models.Movies, cache: c, tx: tx}
+	models.Ratings = CachedRatingModel{RatingModelInterface: models.Ratings, cache: c, tx: tx}
+	models.Images = CachedImageModel{ImageModelInterface: models.Images, cache: c, tx: tx}
+	models.Genres = CachedGenreModel{GenreModelInterface: models.Genres, cache: c, tx: tx}
+	models.Permissions = CachedPermissionModel{PermissionModelInterface: models.Permissions, cache: c, tx: tx}
+	models.Tokens = CachedTokenModel{TokenModelInterface: models.Tokens, cache: c, tx: tx}
+	models.Users = CachedUserModel{UserModelInterface: models.Users, cache: c, tx: tx}
+	return models
+}
+
+// Notify() makes the cache send its invalidations to the other instances of the API, as notifications on db. Errors sending them are passed to onError.
+func (c *Cache) Notify(db DBTX, onError func(error)) {
+	c.notifyDB = db
+	c.onError = onError
+}
+
+// Listen() applies the invalidations sent by other instances of the API, until the done channel is closed. It opens its own connection to the database
+// with the given DSN, and reconnects if the connection is lost, emptying the cache as any notifications sent in the meantime are missed. Errors on the
+// connection are passed to onError.
+func (c *Cache) Listen(dsn string, done <-chan struct{}, onError func(error)) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			onError(err)
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(cacheChannel)
+	if err != nil {
+		return err
+	}
+
+	// Ping the connection when there have been no notifications for a while, to find out if it has been lost.
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+
+		case notification := <-listener.Notify:
+			// A nil notification means that the connection was re-established.
+			if notification == nil {
+				c.clear()
+				continue
+			}
+			c.applyNotification(notification.Extra)
+
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
+
+// Stats() returns the stats of each table in the cache, keyed by name.
+func (c *Cache) Stats() map[string]CacheStats {
+	return map[string]CacheStats{
+		cacheMovies:      c.movies.statistics(),
+		cachePermissions: c.permissions.statistics(),
+		cacheUsers:       c.users.statistics(),
+	}
+}
+
+// invalidate removes the entries for the movie or user with the given id from a table (or all of its entries, if id is 0) and tells the other instances
+// of the API to do the same. Inside a transaction it is put off until commit().
+func (c *Cache) invalidate(tx *cacheTx, table string, id int64) {
+	if tx != nil {
+		tx.mu.Lock()
+		tx.invalidations = append(tx.invalidations, cacheInvalidation{table, id})
+		tx.mu.Unlock()
+		return
+	}
+
+	c.evict(table, id)
+	c.notify(table, id)
+}
+
+// commit applies the invalidations collected for a transaction. It is called whether or not the transaction committed, as there is no harm in removing
+// entries which are still up to date.
+func (c *Cache) commit(tx *cacheTx) {
+	done := make(map[cacheInvalidation]bool)
+
+	for _, inv := range tx.invalidations {
+		if !done[inv] {
+			done[inv] = true
+			c.invalidate(nil, inv.table, inv.id)
+		}
+	}
+}
+
+// evict removes the entries for the movie or user with the given id from a table, or all of its entries if id is 0.
+func (c *Cache) evict(table string, id int64) {
+	switch table {
+	case cacheMovies:
+		c.movies.removeFunc(func(movieID int64, _ Movie) bool { return id == 0 || movieID == id })
+	case cachePermissions:
+		c.permissions.removeFunc(func(userID int64, _ Permissions) bool { return id == 0 || userID == id })
+	case cacheUsers:
+		c.users.removeFunc(func(_ string, user User) bool { return id == 0 || user.ID == id })
+	}
+}
+
+// clear empties the cache.
+func (c *Cache) clear() {
+	for _, table := range []string{cacheMovies, cachePermissions, cacheUsers} {
+		c.evict(table, 0)
+	}
+}
+
+// notify sends an invalidation to the other instances of the API, if Notify() has been called. The payload is the instance, table and id separated by
+// spaces.
+func (c *Cache) notify(table string, id int64) {
+	if c.notifyDB == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cacheNotifyTimeout)
+	defer cancel()
+
+	payload := fmt.Sprintf("%s %s %d", c.instance, table, id)
+
+	_, err := c.notifyDB.ExecContext(ctx, "SELECT pg_notify($1, $2)", cacheChannel, payload)
+	if err != nil && c.onError != nil {
+		c.onError(fmt.Errorf("sending cache invalidation: %w", err))
+	}
+}
+
+// applyNotification applies an invalidation sent by notify() from another instance. Anything it can't parse empties the whole cache, to be safe.
+func (c *Cache) applyNotification(payload string) {
+	fields := strings.Fields(payload)
+	if len(fields) != 3 {
+		c.clear()
+		return
+	}
+
+	if fields[0] == c.instance {
+		return
+	}
+
+	id, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		c.clear()
+		return
+	}
+
+	c.evict(fields[1], id)
+}
@@ -0,0 +1,306 @@
+package data
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache[int, string](2, time.Minute)
+	generation := c.currentGeneration()
+
+	c.set(generation, 1, "one")
+	c.set(generation, 2, "two")
+
+	// Reading 1 makes 2 the least recently used entry, so it is the one evicted to make room for 3.
+	c.get(1)
+	c.set(generation, 3, "three")
+
+	if _, ok := c.get(2); ok {
+		t.Error("got entry 2; want it evicted")
+	}
+	for key, want := range map[int]string{1: "one", 3: "three"} {
+		if got, ok := c.get(key); !ok || got != want {
+			t.Errorf("got entry %d = %q, %v; want %q", key, got, ok, want)
+		}
+	}
+
+	// Replacing an entry doesnt evict anything.
+	c.set(generation, 3, "THREE")
+	if got, _ := c.get(3); got != "THREE" {
+		t.Errorf("got entry 3 = %q; want THREE", got)
+	}
+
+	stats := c.statistics()
+	if stats.Evictions != 1 || stats.Entries != 2 || stats.Misses != 1 || stats.Hits != 4 {
+		t.Errorf("got stats %+v; want 1 eviction, 2 entries, 1 miss and 4 hits", stats)
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	c := newLRUCache[int, string](10, 20*time.Millisecond)
+
+	c.set(c.currentGeneration(), 1, "one")
+	if _, ok := c.get(1); !ok {
+		t.Fatal("got no entry before it expired")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := c.get(1); ok {
+		t.Error("got an entry after it expired")
+	}
+	if stats := c.statistics(); stats.Entries != 0 {
+		t.Errorf("got %d entries; want the expired entry removed", stats.Entries)
+	}
+}
+
+func TestLRUCacheSetUntil(t *testing.T) {
+	c := newLRUCache[int, string](10, 20*time.Millisecond)
+	generation := c.currentGeneration()
+
+	// An entry expires at the given time if that is sooner than the ttl, and after the ttl otherwise.
+	c.setUntil(generation, 1, "one", time.Now().Add(5*time.Millisecond))
+	c.setUntil(generation, 2, "two", time.Now().Add(time.Hour))
+	c.setUntil(generation, 3, "three", time.Time{})
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := c.get(1); ok {
+		t.Error("got entry 1 after its expiry")
+	}
+	for _, key := range []int{2, 3} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("got no entry %d before the ttl", key)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	for _, key := range []int{2, 3} {
+		if _, ok := c.get(key); ok {
+			t.Errorf("got entry %d after the ttl", key)
+		}
+	}
+}
+
+func TestLRUCacheGeneration(t *testing.T) {
+	c := newLRUCache[int, string](10, time.Minute)
+
+	c.set(c.currentGeneration(), 1, "one")
+	c.set(c.currentGeneration(), 2, "two")
+
+	// A value read before an invalidation isnt cached after it, as it may be out of date.
+	generation := c.currentGeneration()
+	c.removeFunc(func(key int, _ string) bool { return key == 1 })
+	c.set(generation, 3, "three")
+
+	if _, ok := c.get(1); ok {
+		t.Error("got entry 1; want it removed")
+	}
+	if _, ok := c.get(2); !ok {
+		t.Error("got no entry 2; want it kept")
+	}
+	if _, ok := c.get(3); ok {
+		t.Error("got entry 3; want it ignored as it was read before the invalidation")
+	}
+
+	// A value read after the invalidation is cached as usual.
+	c.set(c.currentGeneration(), 3, "three")
+	if _, ok := c.get(3); !ok {
+		t.Error("got no entry 3; want it cached")
+	}
+}
+
+func TestCacheTransaction(t *testing.T) {
+	c := NewCache(10, time.Minute)
+	c.movies.set(c.movies.currentGeneration(), 1, Movie{ID: 1})
+	c.movies.set(c.movies.currentGeneration(), 2, Movie{ID: 2})
+
+	// Invalidations in a transaction wait for it to finish.
+	tx := &cacheTx{}
+	c.invalidate(tx, cacheMovies, 1)
+	c.invalidate(tx, cacheMovies, 1)
+
+	if _, ok := c.movies.get(1); !ok {
+		t.Fatal("got no entry 1; want it kept until the transaction finishes")
+	}
+
+	c.commit(tx)
+
+	if _, ok := c.movies.get(1); ok {
+		t.Error("got entry 1; want it removed")
+	}
+	if _, ok := c.movies.get(2); !ok {
+		t.Error("got no entry 2; want it kept")
+	}
+}
+
+func TestCacheApplyNotification(t *testing.T) {
+	c := NewCache(10, time.Minute)
+
+	fill := func() {
+		for _, id := range []int64{1, 2} {
+			c.movies.set(c.movies.currentGeneration(), id, Movie{ID: id})
+			c.permissions.set(c.permissions.currentGeneration(), id, Permissions{"movies:read"})
+		}
+	}
+
+	tests := []struct {
+		name        string
+		payload     string
+		movies      int
+		permissions int
+	}{
+		{"one movie", "other movies 1", 1, 2},
+		{"all movies", "other movies 0", 0, 2},
+		{"one user", "other permissions 2", 2, 1},
+		{"own notification", c.instance + " movies 1", 2, 2},
+		{"bad id", "other movies one", 0, 0},
+		{"bad payload", "movies", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fill()
+			c.applyNotification(tt.payload)
+
+			if got := c.movies.statistics().Entries; got != tt.movies {
+				t.Errorf("got %d movies; want %d", got, tt.movies)
+			}
+			if got := c.permissions.statistics().Entries; got != tt.permissions {
+				t.Errorf("got %d permissions; want %d", got, tt.permissions)
+			}
+		})
+	}
+}
+
+// laggingMovieModel stands in for a movie model whose reads go to a replica which hasnt caught up with the latest update, unless the primary is asked for.
+type laggingMovieModel struct {
+	MovieModelInterface
+	primary, replica *Movie
+}
+
+func (m *laggingMovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	if usesPrimary(ctx) {
+		return cloneMovie(*m.primary), nil
+	}
+	return cloneMovie(*m.replica), nil
+}
+
+func (m *laggingMovieModel) Update(ctx context.Context, movie *Movie, userID int64) error {
+	movie.Version++
+	m.primary = cloneMovie(*movie)
+	return nil
+}
+
+// laggingPermissionModel does the same for permissions.
+type laggingPermissionModel struct {
+	primary, replica Permissions
+}
+
+func (m *laggingPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	if usesPrimary(ctx) {
+		return cloneStrings(m.primary), nil
+	}
+	return cloneStrings(m.replica), nil
+}
+
+func (m *laggingPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.primary = append(cloneStrings(m.primary), codes...)
+	return nil
+}
+
+// TestCacheReplicaLag checks that the value cached after an invalidation comes from the primary rather than from a replica which hasnt caught up yet.
+func TestCacheReplicaLag(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(10, time.Minute)
+
+	original := &Movie{ID: 1, Title: "Old", Version: 1}
+	movies := &laggingMovieModel{primary: original, replica: original}
+	permissions := &laggingPermissionModel{primary: Permissions{"movies:read"}, replica: Permissions{"movies:read"}}
+
+	models := c.Wrap(Models{Movies: movies, Permissions: permissions})
+
+	// Fill the cache, then change the movie and the permissions. The replica is still returning the old values.
+	models.Movies.Get(ctx, 1)
+	models.Permissions.GetAllForUser(ctx, 1)
+
+	err := models.Movies.Update(ctx, &Movie{ID: 1, Title: "New", Version: 1}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.Permissions.AddForUser(ctx, 1, "movies:write")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		movie, err := models.Movies.Get(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if movie.Title != "New" || movie.Version != 2 {
+			t.Errorf("read %d: got movie %q version %d; want New version 2", i+1, movie.Title, movie.Version)
+		}
+
+		granted, err := models.Permissions.GetAllForUser(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !granted.Include("movies:write") {
+			t.Errorf("read %d: got permissions %v; want movies:write included", i+1, granted)
+		}
+	}
+
+	// The second reads were served from the cache.
+	if stats := c.Stats(); stats[cacheMovies].Hits != 1 || stats[cachePermissions].Hits != 1 {
+		t.Errorf("got stats %+v; want one hit on each table", stats)
+	}
+}
+
+// TestCacheTokenExpiry checks that a user looked up by a token is only cached until the token expires, when that is sooner than the cache's ttl.
+func TestCacheTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(10, time.Hour)
+	models := c.Wrap(NewMemoryModels())
+
+	user := &User{Name: "Alice", Email: "alice@example.com", Activated: true}
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.Users.Insert(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := models.Tokens.New(ctx, user.ID, time.Minute, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := models.Users.GetForToken(ctx, ScopeAuthentication, token.Plaintext)
+		if err != nil {
+			t.Fatalf("read %d: %v", i+1, err)
+		}
+		if got.ID != user.ID {
+			t.Errorf("read %d: got user %d; want %d", i+1, got.ID, user.ID)
+		}
+	}
+	if stats := c.Stats(); stats[cacheUsers].Hits != 1 {
+		t.Errorf("got stats %+v; want the second read served from the cache", stats)
+	}
+
+	// The stored expiry is truncated to the second, in the same way as by the timestamp(0) column in PostgreSQL.
+	e, ok := c.users.entries[ScopeAuthentication+":"+hex.EncodeToString(token.Hash)]
+	if !ok {
+		t.Fatal("got no cached user")
+	}
+	if expires := e.Value.(*lruEntry[string, User]).expires; !expires.Equal(token.Expiry.Truncate(time.Second)) {
+		t.Errorf("got cached user expiring at %v; want the token expiry %v", expires, token.Expiry.Truncate(time.Second))
+	}
+}
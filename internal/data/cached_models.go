@@ -0,0 +1,272 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// The CachedMovieModel caches the movies looked up by Get(), and invalidates them when movies are changed. The methods which arent overridden go
+// straight to the wrapped model. Inside a transaction (when tx is set) nothing is read from the cache, and the invalidations wait for the transaction.
+// Lookups with a context from UsePrimary() skip the cache too, as they need to see the latest writes. Values which are going to be cached are always read
+// from the primary, as a replica which is behind could return a value from before the invalidation, which would then stay in the cache until it expired.
+// The other cached models work in the same way.
+type CachedMovieModel struct {
+	MovieModelInterface
+	cache *Cache
+	tx    *cacheTx
+}
+
+// Get() returns a copy of the cached movie, or looks it up and caches it.
+func (m CachedMovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	if m.tx != nil || usesPrimary(ctx) {
+		return m.MovieModelInterface.Get(ctx, id)
+	}
+
+	if movie, ok := m.cache.movies.get(id); ok {
+		return cloneMovie(movie), nil
+	}
+
+	generation := m.cache.movies.currentGeneration()
+
+	movie, err := m.MovieModelInterface.Get(UsePrimary(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cache.movies.set(generation, id, *cloneMovie(*movie))
+	return movie, nil
+}
+
+func (m CachedMovieModel) Update(ctx context.Context, movie *Movie, userID int64) error {
+	err := m.MovieModelInterface.Update(ctx, movie, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, movie.ID)
+	}
+	return err
+}
+
+func (m CachedMovieModel) Delete(ctx context.Context, id int64, userID int64) error {
+	err := m.MovieModelInterface.Delete(ctx, id, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, id)
+	}
+	return err
+}
+
+func (m CachedMovieModel) Restore(ctx context.Context, id int64, userID int64) (*Movie, error) {
+	movie, err := m.MovieModelInterface.Restore(ctx, id, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, id)
+	}
+	return movie, err
+}
+
+func (m CachedMovieModel) Purge(ctx context.Context, id int64, userID int64) error {
+	err := m.MovieModelInterface.Purge(ctx, id, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, id)
+	}
+	return err
+}
+
+func (m CachedMovieModel) PurgeDeleted(ctx context.Context, before time.Time) ([]int64, error) {
+	ids, err := m.MovieModelInterface.PurgeDeleted(ctx, before)
+	for _, id := range ids {
+		m.cache.invalidate(m.tx, cacheMovies, id)
+	}
+	return ids, err
+}
+
+func (m CachedMovieModel) Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Movie, error) {
+	movie, err := m.MovieModelInterface.Merge(ctx, sourceID, targetID, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, sourceID)
+		m.cache.invalidate(m.tx, cacheMovies, targetID)
+	}
+	return movie, err
+}
+
+// The CachedRatingModel invalidates the cached movies whose aggregate scores are changed by a rating.
+type CachedRatingModel struct {
+	RatingModelInterface
+	cache *Cache
+	tx    *cacheTx
+}
+
+func (m CachedRatingModel) Insert(ctx context.Context, rating *Rating) error {
+	err := m.RatingModelInterface.Insert(ctx, rating)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, rating.MovieID)
+	}
+	return err
+}
+
+func (m CachedRatingModel) Update(ctx context.Context, rating *Rating) error {
+	err := m.RatingModelInterface.Update(ctx, rating)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, rating.MovieID)
+	}
+	return err
+}
+
+func (m CachedRatingModel) Delete(ctx context.Context, movieID, userID int64) error {
+	err := m.RatingModelInterface.Delete(ctx, movieID, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, movieID)
+	}
+	return err
+}
+
+// The CachedImageModel invalidates the cached movies whose poster is changed by an image.
+type CachedImageModel struct {
+	ImageModelInterface
+	cache *Cache
+	tx    *cacheTx
+}
+
+func (m CachedImageModel) Insert(ctx context.Context, image *Image) (*Image, error) {
+	replaced, err := m.ImageModelInterface.Insert(ctx, image)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, image.MovieID)
+	}
+	return replaced, err
+}
+
+func (m CachedImageModel) Delete(ctx context.Context, movieID, id int64, kind string) (*Image, error) {
+	image, err := m.ImageModelInterface.Delete(ctx, movieID, id, kind)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, movieID)
+	}
+	return image, err
+}
+
+// The CachedGenreModel invalidates all of the cached movies when a genre is renamed or merged, as that rewrites the genres of any number of movies.
+type CachedGenreModel struct {
+	GenreModelInterface
+	cache *Cache
+	tx    *cacheTx
+}
+
+func (m CachedGenreModel) Update(ctx context.Context, genre *Genre, userID int64) error {
+	err := m.GenreModelInterface.Update(ctx, genre, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, 0)
+	}
+	return err
+}
+
+func (m CachedGenreModel) Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Genre, error) {
+	genre, err := m.GenreModelInterface.Merge(ctx, sourceID, targetID, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheMovies, 0)
+	}
+	return genre, err
+}
+
+// The CachedPermissionModel caches the permissions of each user, and invalidates them when more are granted.
+type CachedPermissionModel struct {
+	PermissionModelInterface
+	cache *Cache
+	tx    *cacheTx
+}
+
+// GetAllForUser() returns a copy of the user's cached permissions, or looks them up and caches them.
+func (m CachedPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	if m.tx != nil || usesPrimary(ctx) {
+		return m.PermissionModelInterface.GetAllForUser(ctx, userID)
+	}
+
+	if permissions, ok := m.cache.permissions.get(userID); ok {
+		return cloneStrings(permissions), nil
+	}
+
+	generation := m.cache.permissions.currentGeneration()
+
+	permissions, err := m.PermissionModelInterface.GetAllForUser(UsePrimary(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cache.permissions.set(generation, userID, cloneStrings(permissions))
+	return permissions, nil
+}
+
+func (m CachedPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	err := m.PermissionModelInterface.AddForUser(ctx, userID, codes...)
+	if err == nil {
+		m.cache.invalidate(m.tx, cachePermissions, userID)
+	}
+	return err
+}
+
+// The CachedTokenModel invalidates the cached users for a user's tokens when the tokens are deleted.
+type CachedTokenModel struct {
+	TokenModelInterface
+	cache *Cache
+	tx    *cacheTx
+}
+
+func (m CachedTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	err := m.TokenModelInterface.DeleteAllForUser(ctx, scope, userID)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheUsers, userID)
+	}
+	return err
+}
+
+// The CachedUserModel caches the users looked up by GetForToken(), and invalidates them when the user is updated. The cache is keyed by the scope and the
+// hash of the token, so the plaintext tokens aren't kept in memory. Each entry expires when its token does, if that is sooner than the cache's ttl, so an
+// expired token is never accepted from the cache.
+type CachedUserModel struct {
+	UserModelInterface
+	cache *Cache
+	tx    *cacheTx
+}
+
+// GetForToken() returns a copy of the cached user for the token, or looks it up and caches it.
+func (m CachedUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	if m.tx != nil || usesPrimary(ctx) {
+		return m.UserModelInterface.GetForToken(ctx, tokenScope, tokenPlaintext)
+	}
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	key := tokenScope + ":" + hex.EncodeToString(tokenHash[:])
+
+	if user, ok := m.cache.users.get(key); ok {
+		return &user, nil
+	}
+
+	generation := m.cache.users.currentGeneration()
+
+	user, err := m.UserModelInterface.GetForToken(UsePrimary(ctx), tokenScope, tokenPlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cache.users.setUntil(generation, key, *user, user.tokenExpiry)
+	return user, nil
+}
+
+func (m CachedUserModel) Update(ctx context.Context, user *User) error {
+	err := m.UserModelInterface.Update(ctx, user)
+	if err == nil {
+		m.cache.invalidate(m.tx, cacheUsers, user.ID)
+	}
+	return err
+}
+
+// cloneMovie returns a copy of a movie which shares nothing with it, so that the caller can change the copy without affecting the cached movie.
+func cloneMovie(movie Movie) *Movie {
+	movie.Genres = cloneStrings(movie.Genres)
+	movie.ReleaseDates = cloneReleaseDates(movie.ReleaseDates)
+	movie.ExternalIDs = cloneExternalIDs(movie.ExternalIDs)
+	if movie.Poster != nil {
+		poster := *movie.Poster
+		poster.ThumbnailWidths = append([]int32{}, poster.ThumbnailWidths...)
+		poster.Thumbnails = append([]Thumbnail{}, poster.Thumbnails...)
+		movie.Poster = &poster
+	}
+	return &movie
+}
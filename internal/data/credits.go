@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"time"
+)
+
+// Define constants for the roles that a person can be credited with on a movie.
+const (
+	CreditDirector        = "director"
+	CreditActor           = "actor"
+	CreditWriter          = "writer"
+	CreditProducer        = "producer"
+	CreditComposer        = "composer"
+	CreditCinematographer = "cinematographer"
+	CreditEditor          = "editor"
+)
+
+// CreditRoles lists the supported credit roles.
+var CreditRoles = []string{CreditDirector, CreditActor, CreditWriter, CreditProducer, CreditComposer, CreditCinematographer, CreditEditor}
+
+// ErrDuplicateCredit is returned when a person already has the same credit on a movie.
+var ErrDuplicateCredit = errors.New("duplicate credit")
+
+// A Credit links a person to a movie in a particular role. Character is the part played, and is only set for actors. PersonName is populated when listing the
+// credits of a movie, and MovieTitle and MovieYear when listing the filmography of a person, so that clients dont need a request for each credit.
+type Credit struct {
+	ID         int64  `json:"id"`
+	MovieID    int64  `json:"movie_id"`
+	PersonID   int64  `json:"person_id"`
+	Role       string `json:"role"`
+	Character  string `json:"character,omitempty"`
+	PersonName string `json:"person_name,omitempty"`
+	MovieTitle string `json:"movie_title,omitempty"`
+	MovieYear  int32  `json:"movie_year,omitempty"`
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID != 0, "person_id", "must be provided")
+	v.Check(credit.PersonID >= 0, "person_id", "must be a positive integer")
+
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(credit.Role == "" || validator.In(credit.Role, CreditRoles...), "role", "must be a supported role")
+
+	v.Check(credit.Character == "" || credit.Role == CreditActor, "character", "must only be provided for actors")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+}
+
+// The CreditModel struct type wraps a sql.DB connection pool, along with the maximum time that any single query is allowed to run for.
+type CreditModel struct {
+	DB      DBTX
+	ReadDB  DBTX
+	Timeout time.Duration
+}
+
+// Insert() adds a credit, setting its id and the name of the person. It returns ErrRecordNotFound if the movie (or a movie which isnt in the trash) or the
+// person doesnt exist, and ErrDuplicateCredit if the same credit has already been added.
+func (m CreditModel) Insert(ctx context.Context, credit *Credit) error {
+	query := `
+        INSERT INTO credits (movie_id, person_id, role, character)
+        SELECT movies.id, people.id, $3, $4
+        FROM movies, people
+        WHERE movies.id = $1 AND movies.deleted_at IS NULL AND people.id = $2
+        RETURNING id, (SELECT name FROM people WHERE id = $2)`
+
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID, &credit.PersonName)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "credits_movie_id_person_id_role_character_key"`:
+			return ErrDuplicateCredit
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete() removes a credit from a movie, or returns ErrRecordNotFound.
+func (m CreditModel) Delete(ctx context.Context, movieID, creditID int64) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM credits WHERE id = $1 AND movie_id = $2", creditID, movieID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForMovie() returns the credits of a movie, with the directors first, then the other roles in alphabetical order, and the people in each role in the
+// order they were credited.
+func (m CreditModel) GetAllForMovie(ctx context.Context, movieID int64) ([]*Credit, error) {
+	query := `
+        SELECT credits.id, credits.movie_id, credits.person_id, credits.role, credits.character, people.name
+        FROM credits
+        INNER JOIN people ON people.id = credits.person_id
+        WHERE credits.movie_id = $1
+        ORDER BY credits.role <> 'director', credits.role, credits.id`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(&credit.ID, &credit.MovieID, &credit.PersonID, &credit.Role, &credit.Character, &credit.PersonName)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		credits = append(credits, &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return credits, nil
+}
+
+// GetAllForPerson() returns the filmography of a person: their credits on movies which arent in the trash, newest movie first.
+func (m CreditModel) GetAllForPerson(ctx context.Context, personID int64) ([]*Credit, error) {
+	query := `
+        SELECT credits.id, credits.movie_id, credits.person_id, credits.role, credits.character, movies.title, movies.year
+        FROM credits
+        INNER JOIN movies ON movies.id = credits.movie_id
+        WHERE credits.person_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY movies.year DESC, movies.id DESC, credits.id`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, personID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(&credit.ID, &credit.MovieID, &credit.PersonID, &credit.Role, &credit.Character, &credit.MovieTitle, &credit.MovieYear)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		credits = append(credits, &credit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return credits, nil
+}
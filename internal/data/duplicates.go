@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// The ways of matching probable duplicates. DuplicateExact matches movies with the same normalized title and year, and DuplicateFuzzy also matches movies
+// whose normalized titles are similar by trigrams and which were released within a year of each other, to catch typos and differences in the year.
+const (
+	DuplicateExact = "exact"
+	DuplicateFuzzy = "fuzzy"
+)
+
+// DuplicateMatches lists the supported ways of matching duplicates.
+var DuplicateMatches = []string{DuplicateExact, DuplicateFuzzy}
+
+// duplicateThreshold is the minimum trigram similarity between two normalized titles for a fuzzy duplicate.
+const duplicateThreshold = 0.4
+
+// maxDuplicates is the largest number of probable duplicates returned for a movie.
+const maxDuplicates = 20
+
+// ErrTooManyGenres is returned when merging two movies would leave the merged movie with more than 5 genres.
+var ErrTooManyGenres = errors.New("too many genres")
+
+// NormalizeTitle returns the form of a title which is compared when looking for duplicates: it is lowercased, split into words of letters and digits, and
+// any leading article is dropped, so "The Matrix!" and "matrix" are the same. It must match the normalized_title column on the movies table.
+func NormalizeTitle(title string) string {
+	normalized := strings.Join(searchTerms(title), " ")
+
+	for _, article := range []string{"the ", "a ", "an "} {
+		if strings.HasPrefix(normalized, article) {
+			return strings.TrimPrefix(normalized, article)
+		}
+	}
+
+	return normalized
+}
+
+// mergeMovieGenres returns the genres of the target movie followed by any genres of the source movie which it doesnt already have.
+func mergeMovieGenres(target, source []string) []string {
+	genres := cloneStrings(target)
+	for _, genre := range source {
+		if !containsAll(genres, []string{genre}) {
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
+
+// FindDuplicates() returns the ids of up to maxDuplicates movies (not counting those in the trash, or the movie itself) which are probably the same film as
+// the movie, matched in the given way. It doesnt stop duplicates being created by concurrent requests, so it is only a guard against editors
+// adding the same movie twice by mistake.
+func (m MovieModel) FindDuplicates(ctx context.Context, movie *Movie, match string) ([]int64, error) {
+	query := `
+        SELECT id
+        FROM movies
+        WHERE normalized_title = $1 AND year = $2 AND id <> $3 AND deleted_at IS NULL
+        ORDER BY id
+        LIMIT $4`
+
+	// The % operator finds the candidates with the trigram index, using the (much lower) default threshold of pg_trgm, and similarity() then applies ours.
+	if match == DuplicateFuzzy {
+		query = `
+            SELECT id
+            FROM movies
+            WHERE normalized_title % $1 AND similarity(normalized_title, $1) >= $5 AND year BETWEEN $2 - 1 AND $2 + 1 AND id <> $3 AND deleted_at IS NULL
+            ORDER BY similarity(normalized_title, $1) DESC, id
+            LIMIT $4`
+	}
+
+	args := []interface{}{NormalizeTitle(movie.Title), movie.Year, movie.ID, maxDuplicates}
+	if match == DuplicateFuzzy {
+		args = append(args, duplicateThreshold)
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return ids, nil
+}
+
+// Merge() folds the source movie into the target movie and returns the updated target. The target gains the genres of the source, along with its credits,
+// ratings, list entries, external IDs and translations, except where the target already has the same one (so a user who rated both movies keeps their
+// rating of the target). The images of the source are deleted with it, and the caller must delete their blobs. The source is then deleted and its id
+// redirected to the target, which GetMergedInto() reports. Both movies get a new version with a 'merge' revision. It returns ErrRecordNotFound if either
+// movie doesnt exist or is in the trash, and ErrTooManyGenres if the target would end up with more than 5 genres.
+func (m MovieModel) Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Movie, error) {
+	if sourceID < 1 || targetID < 1 || sourceID == targetID {
+		return nil, ErrRecordNotFound
+	}
+
+	mergeCtx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := beginTx(mergeCtx, m.DB, nil)
+	if err != nil {
+		return nil, contextError(mergeCtx, err)
+	}
+	defer tx.Rollback()
+
+	// Lock both movies in id order, so that two merges of the same movies in opposite directions can't deadlock.
+	rows, err := tx.QueryContext(mergeCtx, "SELECT id, genres FROM movies WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id FOR UPDATE", pq.Array([]int64{sourceID, targetID}))
+	if err != nil {
+		return nil, contextError(mergeCtx, err)
+	}
+
+	genres := make(map[int64][]string)
+
+	for rows.Next() {
+		var (
+			id          int64
+			movieGenres []string
+		)
+
+		err := rows.Scan(&id, pq.Array(&movieGenres))
+		if err != nil {
+			rows.Close()
+			return nil, contextError(mergeCtx, err)
+		}
+
+		genres[id] = movieGenres
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, contextError(mergeCtx, err)
+	}
+
+	if len(genres) != 2 {
+		return nil, ErrRecordNotFound
+	}
+
+	merged := mergeMovieGenres(genres[targetID], genres[sourceID])
+	if len(merged) > 5 {
+		return nil, ErrTooManyGenres
+	}
+
+	// Each of these statements takes the source id as $1 and the target id as $2. The lists which already have the target are renumbered without the source
+	// and its entries removed from them, before the rest are moved across. Any rows left on the source are deleted along with it.
+	queries := []string{
+		`UPDATE credits SET movie_id = $2
+        WHERE movie_id = $1 AND NOT EXISTS (
+            SELECT 1 FROM credits AS target
+            WHERE target.movie_id = $2 AND target.person_id = credits.person_id AND target.role = credits.role AND target.character = credits.character
+        )`,
+		`UPDATE ratings SET movie_id = $2 WHERE movie_id = $1 AND user_id NOT IN (SELECT user_id FROM ratings WHERE movie_id = $2)`,
+		`UPDATE list_items SET position = renumbered.position
+        FROM (
+            SELECT list_id, movie_id, row_number() OVER (PARTITION BY list_id ORDER BY position) AS position
+            FROM list_items
+            WHERE list_id IN (SELECT list_id FROM list_items WHERE movie_id = $2) AND movie_id <> $1
+        ) AS renumbered
+        WHERE list_items.list_id = renumbered.list_id AND list_items.movie_id = renumbered.movie_id AND list_items.position <> renumbered.position`,
+		`DELETE FROM list_items WHERE movie_id = $1 AND list_id IN (SELECT list_id FROM list_items WHERE movie_id = $2)`,
+		`UPDATE list_items SET movie_id = $2 WHERE movie_id = $1`,
+		`UPDATE movie_external_ids SET movie_id = $2 WHERE movie_id = $1 AND source NOT IN (SELECT source FROM movie_external_ids WHERE movie_id = $2)`,
+		`UPDATE movie_translations SET movie_id = $2 WHERE movie_id = $1 AND language NOT IN (SELECT language FROM movie_translations WHERE movie_id = $2)`,
+		`UPDATE movie_redirects SET target_id = $2 WHERE target_id = $1`,
+		`INSERT INTO movie_redirects (movie_id, target_id) VALUES ($1, $2)`,
+	}
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(mergeCtx, query, sourceID, targetID)
+		if err != nil {
+			return nil, contextError(mergeCtx, err)
+		}
+	}
+
+	query := `
+        WITH deleted AS (
+            DELETE FROM movies
+            WHERE id = $1
+            RETURNING id, title, year, runtime, genres, status, version
+        )
+        INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+        SELECT id, version + 1, 'merge', title, year, runtime, genres, status,
+            COALESCE((SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = deleted.id), '{}'),
+            COALESCE((SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = deleted.id), '{}'),
+            NULLIF($2::bigint, 0)
+        FROM deleted`
+
+	_, err = tx.ExecContext(mergeCtx, query, sourceID, userID)
+	if err != nil {
+		return nil, contextError(mergeCtx, err)
+	}
+
+	// The ratings moved from the source are included in the target's aggregate scores, which are recalculated in the same way as by the RatingModel.
+	query = `
+        WITH updated AS (
+            UPDATE movies
+            SET genres = $2, version = version + 1, (rating_count, average_rating) = (
+                SELECT count(*), COALESCE(round(avg(rating), 2), 0)
+                FROM ratings
+                WHERE movie_id = $1
+            )
+            WHERE id = $1
+            RETURNING id, title, year, runtime, genres, status, version
+        )
+        INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+        SELECT id, version, 'merge', title, year, runtime, genres, status,
+            COALESCE((SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = updated.id), '{}'),
+            COALESCE((SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = updated.id), '{}'),
+            NULLIF($3::bigint, 0)
+        FROM updated`
+
+	_, err = tx.ExecContext(mergeCtx, query, targetID, pq.Array(merged), userID)
+	if err != nil {
+		return nil, contextError(mergeCtx, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(mergeCtx, err)
+	}
+
+	return m.Get(ctx, targetID)
+}
+
+// GetMergedInto() returns the id of the movie that the movie with the given id was merged into, or ErrRecordNotFound if it wasnt merged.
+func (m MovieModel) GetMergedInto(ctx context.Context, id int64) (int64, error) {
+	var targetID int64
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.ReadDB.QueryRowContext(ctx, "SELECT target_id FROM movie_redirects WHERE movie_id = $1", id).Scan(&targetID)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return targetID, nil
+}
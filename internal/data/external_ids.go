@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"regexp"
+	"strings"
+)
+
+// Define constants for the other catalogues that a movie can be identified in.
+const (
+	SourceIMDb     = "imdb"
+	SourceTMDB     = "tmdb"
+	SourceWikidata = "wikidata"
+)
+
+// ExternalSources lists the supported external ID sources.
+var ExternalSources = []string{SourceIMDb, SourceTMDB, SourceWikidata}
+
+// ErrDuplicateExternalID is returned when an external ID is already used by another movie (including one in the trash).
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// externalIDFormats holds the pattern that IDs from each source must match, along with an example for the validation message.
+var externalIDFormats = map[string]struct {
+	pattern *regexp.Regexp
+	example string
+}{
+	SourceIMDb:     {regexp.MustCompile(`^tt[0-9]{7,10}$`), "tt0111161"},
+	SourceTMDB:     {regexp.MustCompile(`^[1-9][0-9]{0,9}$`), "278"},
+	SourceWikidata: {regexp.MustCompile(`^Q[1-9][0-9]{0,11}$`), "Q172241"},
+}
+
+// ExternalIDs holds the IDs of a movie in other catalogues, keyed by source. A movie has at most one ID from each source, and each ID belongs to at most one
+// movie.
+type ExternalIDs map[string]string
+
+// ValidateExternalID checks that id is a well-formed ID from the source, recording any problem under the key.
+func ValidateExternalID(v *validator.Validator, key, source, id string) {
+	format, ok := externalIDFormats[source]
+	if !ok {
+		v.AddError(key, fmt.Sprintf("must be one of %s", strings.Join(ExternalSources, ", ")))
+		return
+	}
+
+	v.Check(format.pattern.MatchString(id), key, fmt.Sprintf("must be a valid %s ID like %s", source, format.example))
+}
+
+// ValidateExternalIDs checks every ID in the set. Errors are recorded under "external_ids.<source>".
+func ValidateExternalIDs(v *validator.Validator, ids ExternalIDs) {
+	for source, id := range ids {
+		if !validator.In(source, ExternalSources...) {
+			v.AddError("external_ids", fmt.Sprintf("must only contain the sources %s", strings.Join(ExternalSources, ", ")))
+			continue
+		}
+
+		ValidateExternalID(v, "external_ids."+source, source, id)
+	}
+}
+
+// validateExternalSources checks that a list of sources in the filters only contains supported sources.
+func validateExternalSources(v *validator.Validator, key string, sources []string) {
+	for _, source := range sources {
+		if !validator.In(source, ExternalSources...) {
+			v.AddError(key, fmt.Sprintf("must only contain %s", strings.Join(ExternalSources, ", ")))
+			return
+		}
+	}
+}
+
+// externalIDsJSON encodes a set of external IDs as a JSON object for the queries which store them, or returns nil if the set is nil.
+func externalIDsJSON(ids ExternalIDs) (interface{}, error) {
+	if ids == nil {
+		return nil, nil
+	}
+
+	js, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+// GetByExternalID() returns the movie with the given ID in another catalogue, or ErrRecordNotFound if there isnt one or it is in the trash.
+func (m MovieModel) GetByExternalID(ctx context.Context, source, externalID string) (*Movie, error) {
+	query := `
+        SELECT movies.id
+        FROM movie_external_ids
+        INNER JOIN movies ON movies.id = movie_external_ids.movie_id
+        WHERE movie_external_ids.source = $1 AND movie_external_ids.external_id = $2 AND movies.deleted_at IS NULL`
+
+	var id int64
+
+	lookupCtx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.ReadDB.QueryRowContext(lookupCtx, query, source, externalID).Scan(&id)
+	err = contextError(lookupCtx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m.Get(ctx, id)
+}
+
+// attachExternalIDs looks up the external IDs of the movies in a single query and sets the ExternalIDs field of each movie which has any.
+func attachExternalIDs(ctx context.Context, db DBTX, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT movie_id, source, external_id FROM movie_external_ids WHERE movie_id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	externalIDs := make(map[int64]ExternalIDs)
+
+	for rows.Next() {
+		var (
+			movieID            int64
+			source, externalID string
+		)
+
+		err := rows.Scan(&movieID, &source, &externalID)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		if externalIDs[movieID] == nil {
+			externalIDs[movieID] = ExternalIDs{}
+		}
+		externalIDs[movieID][source] = externalID
+	}
+	if err = rows.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	for _, movie := range movies {
+		movie.ExternalIDs = externalIDs[movie.ID]
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Define constants for the facets which the movies list can be broken down by.
+const (
+	FacetGenres        = "genres"
+	FacetDecade        = "decade"
+	FacetRuntimeBucket = "runtime_bucket"
+)
+
+// MovieFacets lists the supported facets.
+var MovieFacets = []string{FacetGenres, FacetDecade, FacetRuntimeBucket}
+
+// A FacetCount holds the number of matching movies which have a particular facet value. The genres facet counts a movie once for each of its genres.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets maps the name of each requested facet to its counts. Genres are listed with the most common first, and decades and runtime buckets in ascending
+// order. Values with no matching movies are left out.
+type Facets map[string][]FacetCount
+
+// runtimeBuckets are the ranges of runtimes (in minutes) that the runtime_bucket facet counts. Each bucket holds the runtimes below its limit which aren't in
+// an earlier bucket, and the last bucket (with no limit) holds everything else.
+var runtimeBuckets = []struct {
+	label string
+	limit Runtime
+}{
+	{"0-89", 90},
+	{"90-119", 120},
+	{"120-149", 150},
+	{"150+", 0},
+}
+
+// Facets() counts the movies matching the filters for each value of the named facets. Every facet is counted by the same query, so it takes one round trip
+// however many facets are asked for: the matching movies are selected once in a CTE, and each facet is a GROUP BY over it.
+func (m MovieModel) Facets(ctx context.Context, movieFilters MovieFilters, names []string) (Facets, error) {
+	facets := Facets{}
+	if len(names) == 0 {
+		return facets, nil
+	}
+
+	q, _ := movieFilterQuery(movieFilters)
+
+	// The position column orders the counts within each facet, as described on the Facets type.
+	selects := []string{}
+	for _, name := range names {
+		switch name {
+		case FacetGenres:
+			selects = append(selects, `
+            SELECT 'genres', genre, count(*), -count(*)
+            FROM matches, unnest(genres) AS genre
+            GROUP BY genre`)
+		case FacetDecade:
+			selects = append(selects, `
+            SELECT 'decade', (year / 10 * 10)::text || 's', count(*), year / 10 * 10
+            FROM matches
+            GROUP BY year / 10 * 10`)
+		case FacetRuntimeBucket:
+			// The bucket labels are constants, so they are safe to quote directly.
+			label := runtimeBucketCase(func(position int) string {
+				return "'" + runtimeBuckets[position].label + "'"
+			})
+			position := runtimeBucketCase(strconv.Itoa)
+
+			selects = append(selects, fmt.Sprintf(`
+            SELECT 'runtime_bucket', %s, count(*), %s
+            FROM matches
+            GROUP BY 2, 4`, label, position))
+		}
+		facets[name] = []FacetCount{}
+	}
+
+	query := fmt.Sprintf(`
+        WITH matches AS (
+            SELECT genres, year, runtime
+            FROM movies
+            %s
+        )
+        %s
+        ORDER BY 1, 4, 2`, q.whereClause(), strings.Join(selects, "\n        UNION ALL"))
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name     string
+			count    FacetCount
+			position int64
+		)
+
+		err := rows.Scan(&name, &count.Value, &count.Count, &position)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		facets[name] = append(facets[name], count)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return facets, nil
+}
+
+// runtimeBucketCase returns a CASE expression which picks out the runtime bucket for the runtime column in the same way as runtimeBucket(), giving the
+// result of value for the position of the bucket.
+func runtimeBucketCase(value func(position int) string) string {
+	var b strings.Builder
+
+	b.WriteString("CASE")
+	for i, bucket := range runtimeBuckets {
+		if bucket.limit == 0 {
+			fmt.Fprintf(&b, " ELSE %s", value(i))
+			break
+		}
+		fmt.Fprintf(&b, " WHEN runtime < %d THEN %s", bucket.limit, value(i))
+	}
+	b.WriteString(" END")
+
+	return b.String()
+}
+
+// runtimeBucket returns the position of the runtime bucket which a runtime falls into.
+func runtimeBucket(runtime Runtime) int {
+	for i, bucket := range runtimeBuckets {
+		if bucket.limit == 0 || runtime < bucket.limit {
+			return i
+		}
+	}
+	return len(runtimeBuckets) - 1
+}
+
+// decade returns the first year of the decade that a year falls in.
+func decade(year int32) int32 {
+	return year / 10 * 10
+}
+
+// countFacets counts the facet values of the given movies in Go, in the same order as the query in MovieModel.Facets().
+func countFacets(movies []*Movie, names []string) Facets {
+	facets := Facets{}
+
+	for _, name := range names {
+		counts := map[string]int{}
+		positions := map[string]int{}
+
+		for _, movie := range movies {
+			switch name {
+			case FacetGenres:
+				for _, genre := range movie.Genres {
+					counts[genre]++
+				}
+			case FacetDecade:
+				value := fmt.Sprintf("%ds", decade(movie.Year))
+				counts[value]++
+				positions[value] = int(decade(movie.Year))
+			case FacetRuntimeBucket:
+				position := runtimeBucket(movie.Runtime)
+				value := runtimeBuckets[position].label
+				counts[value]++
+				positions[value] = position
+			}
+		}
+
+		if name == FacetGenres {
+			for value, count := range counts {
+				positions[value] = -count
+			}
+		}
+
+		list := []FacetCount{}
+		for value, count := range counts {
+			list = append(list, FacetCount{Value: value, Count: count})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			a, b := list[i], list[j]
+			if positions[a.Value] != positions[b.Value] {
+				return positions[a.Value] < positions[b.Value]
+			}
+			return a.Value < b.Value
+		})
+
+		facets[name] = list
+	}
+
+	return facets
+}
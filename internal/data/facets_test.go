@@ -0,0 +1,79 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountFacets(t *testing.T) {
+	movies := []*Movie{
+		{Year: 1994, Runtime: 89, Genres: []string{"drama", "crime"}},
+		{Year: 1999, Runtime: 90, Genres: []string{"drama"}},
+		{Year: 2001, Runtime: 119, Genres: []string{"action", "crime"}},
+		{Year: 2010, Runtime: 120, Genres: []string{"drama", "action"}},
+		{Year: 1987, Runtime: 150, Genres: []string{"comedy"}},
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		want  Facets
+	}{
+		{
+			// Genres are ordered by count, most common first, and then by name.
+			name:  "genres",
+			names: []string{FacetGenres},
+			want: Facets{FacetGenres: {
+				{Value: "drama", Count: 3},
+				{Value: "action", Count: 2},
+				{Value: "crime", Count: 2},
+				{Value: "comedy", Count: 1},
+			}},
+		},
+		{
+			name:  "decade",
+			names: []string{FacetDecade},
+			want: Facets{FacetDecade: {
+				{Value: "1980s", Count: 1},
+				{Value: "1990s", Count: 2},
+				{Value: "2000s", Count: 1},
+				{Value: "2010s", Count: 1},
+			}},
+		},
+		{
+			// Each bucket includes its lower bound, and the buckets are in runtime order.
+			name:  "runtime bucket",
+			names: []string{FacetRuntimeBucket},
+			want: Facets{FacetRuntimeBucket: {
+				{Value: "0-89", Count: 1},
+				{Value: "90-119", Count: 2},
+				{Value: "120-149", Count: 1},
+				{Value: "150+", Count: 1},
+			}},
+		},
+		{
+			name:  "none",
+			names: []string{},
+			want:  Facets{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := countFacets(movies, tt.names)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountFacetsNoMovies(t *testing.T) {
+	got := countFacets(nil, MovieFacets)
+
+	for _, name := range MovieFacets {
+		if counts, ok := got[name]; !ok || len(counts) != 0 {
+			t.Errorf("got %s facet %v; want an empty list", name, counts)
+		}
+	}
+}
@@ -1,24 +1,80 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"github.com/myk4040okothogodo/greenlight/internal/validator"
 	"math"
 	"strings"
 )
 
+// ErrInvalidCursor is returned when a cursor can't be decoded, or holds a value which doesnt suit the column it is sorted on.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Filters holds the pagination and sort parameters for a list. Cursor is an opaque position in the list, as returned in the next_cursor and prev_cursor
+// metadata; when it is set, the page starts from the cursor instead of from Page. IncludeTotal controls whether the (expensive) total number of matching
+// records is counted. Only GetAll() for movies supports these two at the moment.
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       string
+	IncludeTotal bool
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+}
+
+// A cursor marks a row in a list sorted by Filters.Sort, using the value of the sort column for that row plus its id, so that the next page can pick up
+// straight after it (or, if Before is set, straight before it) without counting through the rows in between. Rows inserted or deleted elsewhere in the list
+// while a client is paging through it don't shift the page boundaries. Cursors are encoded as base64 JSON, and clients should treat them as opaque.
+type cursor struct {
+	Sort   string `json:"s"`
+	Value  string `json:"v"`
+	ID     int64  `json:"id"`
+	Before bool   `json:"b,omitempty"`
+}
+
+// encode returns the cursor in the form which is handed to clients.
+func (c cursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeCursor reverses cursor.encode().
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// position returns the decoded cursor of the filters, or ErrInvalidCursor if it can't be decoded or was returned for a different sort value, as its value
+// would be compared with the wrong column.
+func (f Filters) position() (cursor, error) {
+	c, err := decodeCursor(f.Cursor)
+	if err == nil && c.Sort != f.Sort {
+		return c, ErrInvalidCursor
+	}
+	return c, err
 }
 
 //Check that the client-provided sort field matches one of the entries in our safelist and if it does, extract the column name from the sor field by stripping the
@@ -52,6 +108,14 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 
 	//Check that the sort parameter matches a value in the safelist
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalidm sort value")
+
+	// A cursor already says where the page starts, so it can't be combined with a page number, and it only makes sense for the sort order it was issued for.
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "must be a valid cursor")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "must be used with the same sort value it was returned for")
+		v.Check(f.Page == 1, "page", "must not be used together with cursor")
+	}
 }
 
 func (f Filters) limit() int {
@@ -80,3 +144,58 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// The keysetMetadata() function calculates the pagination metadata for a page of results which was fetched with one extra row, so that the extra row tells us
+// whether there are more results in the direction of travel. It returns the page without the extra row, back in sort order, along with cursors pointing
+// either side of it. When the page was fetched by page number rather than by cursor, the page number metadata is included as well. The key function returns
+// the value of the sort column for a row. A negative totalRecords means that the total wasnt counted.
+func keysetMetadata[T any](rows []T, filters Filters, totalRecords int, id func(T) int64, key func(T) string) ([]T, Metadata, error) {
+	var position cursor
+	if filters.Cursor != "" {
+		var err error
+		position, err = filters.position()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	more := len(rows) > filters.limit()
+	if more {
+		rows = rows[:filters.limit()]
+	}
+
+	// Rows before the cursor are fetched in reverse order, starting with the one closest to it.
+	hasNext, hasPrev := more, filters.Cursor != "" || filters.Page > 1
+	if position.Before {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+		hasNext, hasPrev = true, more
+	}
+
+	var metadata Metadata
+	switch {
+	case filters.Cursor == "" && totalRecords >= 0:
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	case filters.Cursor == "":
+		metadata = Metadata{CurrentPage: filters.Page, PageSize: filters.PageSize, FirstPage: 1}
+	default:
+		metadata = Metadata{PageSize: filters.PageSize}
+		if totalRecords > 0 {
+			metadata.TotalRecords = totalRecords
+		}
+	}
+
+	if len(rows) > 0 {
+		if hasNext {
+			last := rows[len(rows)-1]
+			metadata.NextCursor = cursor{Sort: filters.Sort, Value: key(last), ID: id(last)}.encode()
+		}
+		if hasPrev {
+			first := rows[0]
+			metadata.PrevCursor = cursor{Sort: filters.Sort, Value: key(first), ID: id(first), Before: true}.encode()
+		}
+	}
+
+	return rows, metadata, nil
+}
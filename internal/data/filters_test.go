@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{Sort: "id", Value: "1", ID: 1},
+		{Sort: "-title", Value: "Moana, \"the\" movie", ID: 42, Before: true},
+		{Sort: "rating", Value: "4.50", ID: 7},
+	}
+
+	for _, want := range tests {
+		got, err := decodeCursor(want.encode())
+		if err != nil {
+			t.Fatalf("decodeCursor(%+v): %v", want, err)
+		}
+		if got != want {
+			t.Errorf("got %+v; want %+v", got, want)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	valid := cursor{Sort: "year", Value: "1999", ID: 3}.encode()
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"id","v":"1","id":1}`))},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("year=1999"))},
+		{"wrong JSON type", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":"1","id":"1"}`))},
+		{"missing id", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":"1"}`))},
+		{"negative id", base64.RawURLEncoding.EncodeToString([]byte(`{"s":"id","v":"-1","id":-1}`))},
+		{"truncated", valid[:len(valid)-4]},
+		{"tampered", "X" + valid[1:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v; want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	base := Filters{Page: 1, PageSize: 20, Sort: "year", SortSafelist: []string{"id", "year", "-year"}}
+
+	tests := []struct {
+		name   string
+		cursor string
+		page   int
+		sort   string
+		errors map[string]string
+	}{
+		{name: "valid", cursor: cursor{Sort: "year", Value: "1999", ID: 3}.encode(), page: 1, sort: "year"},
+		{name: "invalid", cursor: "garbage", page: 1, sort: "year", errors: map[string]string{"cursor": "must be a valid cursor"}},
+		{
+			name:   "different sort",
+			cursor: cursor{Sort: "year", Value: "1999", ID: 3}.encode(),
+			page:   1,
+			sort:   "-year",
+			errors: map[string]string{"cursor": "must be used with the same sort value it was returned for"},
+		},
+		{
+			name:   "with page",
+			cursor: cursor{Sort: "year", Value: "1999", ID: 3}.encode(),
+			page:   2,
+			sort:   "year",
+			errors: map[string]string{"page": "must not be used together with cursor"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := base
+			f.Cursor, f.Page, f.Sort = tt.cursor, tt.page, tt.sort
+
+			v := validator.New()
+			ValidateFilters(v, f)
+
+			if len(v.Errors) != len(tt.errors) {
+				t.Fatalf("got errors %v; want %v", v.Errors, tt.errors)
+			}
+			for key, message := range tt.errors {
+				if v.Errors[key] != message {
+					t.Errorf("got %s error %q; want %q", key, v.Errors[key], message)
+				}
+			}
+		})
+	}
+}
+
+func TestKeysetMetadata(t *testing.T) {
+	id := func(n int64) int64 { return n }
+	key := func(n int64) string { return "k" }
+
+	// A first page fetched by number, with the extra row showing there is another page.
+	rows, metadata, err := keysetMetadata([]int64{1, 2, 3}, Filters{Page: 1, PageSize: 2, Sort: "id"}, 5, id, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0] != 1 || rows[1] != 2 {
+		t.Errorf("got rows %v; want [1 2]", rows)
+	}
+	if metadata.NextCursor == "" || metadata.PrevCursor != "" || metadata.LastPage != 3 {
+		t.Errorf("got metadata %+v; want a next cursor, no previous cursor and 3 pages", metadata)
+	}
+
+	next, _ := decodeCursor(metadata.NextCursor)
+	if next.ID != 2 || next.Before {
+		t.Errorf("got next cursor %+v; want one after id 2", next)
+	}
+
+	// Going backwards from a cursor, the rows arrive closest first and are put back in order, and there are more rows behind them.
+	before := cursor{Sort: "id", Value: "k", ID: 9, Before: true}.encode()
+
+	rows, metadata, err = keysetMetadata([]int64{8, 7, 6}, Filters{Page: 1, PageSize: 2, Sort: "id", Cursor: before}, -1, id, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0] != 7 || rows[1] != 8 {
+		t.Errorf("got rows %v; want [7 8]", rows)
+	}
+	if metadata.NextCursor == "" || metadata.PrevCursor == "" || metadata.TotalRecords != 0 {
+		t.Errorf("got metadata %+v; want both cursors and no total", metadata)
+	}
+
+	// A cursor returned for another sort value is rejected.
+	other := cursor{Sort: "-id", Value: "k", ID: 9}.encode()
+
+	_, _, err = keysetMetadata([]int64{1}, Filters{Page: 1, PageSize: 2, Sort: "id", Cursor: other}, -1, id, key)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("got error %v; want ErrInvalidCursor", err)
+	}
+}
+
+// TestKeysetPaginationTies pages through movies which mostly share the same year, in both directions, to check that the id tie-breaker neither skips nor
+// repeats any of them at the page boundaries.
+func TestKeysetPaginationTies(t *testing.T) {
+	ctx := context.Background()
+	models := NewMemoryModels()
+
+	years := []int32{2001, 1999, 2001, 2001, 1999, 2001, 2005, 2001}
+	for i, year := range years {
+		err := models.Movies.Insert(ctx, &Movie{Title: string(rune('A' + i)), Year: year, Runtime: 90, Genres: []string{"drama"}, Status: StatusReleased}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sort := range []string{"year", "-year"} {
+		t.Run(sort, func(t *testing.T) {
+			filters := Filters{Page: 1, PageSize: 3, Sort: sort, SortSafelist: []string{"year", "-year"}}
+
+			all, _, err := models.Movies.GetAll(ctx, MovieFilters{}, Filters{Page: 1, PageSize: 100, Sort: sort, SortSafelist: filters.SortSafelist})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []int64
+			for _, movie := range all {
+				want = append(want, movie.ID)
+			}
+
+			// Forwards, following next_cursor from the first page.
+			var pages [][]int64
+			var got []int64
+			for {
+				movies, metadata, err := models.Movies.GetAll(ctx, MovieFilters{}, filters)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var page []int64
+				for _, movie := range movies {
+					page = append(page, movie.ID)
+				}
+				pages = append(pages, page)
+				got = append(got, page...)
+
+				if metadata.NextCursor == "" {
+					break
+				}
+				filters.Cursor = metadata.NextCursor
+				if len(pages) > len(years) {
+					t.Fatal("pagination did not end")
+				}
+			}
+			if !equalIDs(got, want) {
+				t.Fatalf("forwards got %v; want %v", got, want)
+			}
+
+			// Backwards, following prev_cursor from the last page, should give the same pages.
+			movies, metadata, err := models.Movies.GetAll(ctx, MovieFilters{}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := len(pages) - 2; i >= 0; i-- {
+				filters.Cursor = metadata.PrevCursor
+				movies, metadata, err = models.Movies.GetAll(ctx, MovieFilters{}, filters)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var page []int64
+				for _, movie := range movies {
+					page = append(page, movie.ID)
+				}
+				if !equalIDs(page, pages[i]) {
+					t.Errorf("backwards page %d got %v; want %v", i+1, page, pages[i])
+				}
+			}
+			if metadata.PrevCursor != "" {
+				t.Errorf("got a prev_cursor on the first page")
+			}
+		})
+	}
+}
+
+func TestGetAllInvalidCursorValue(t *testing.T) {
+	models := NewMemoryModels()
+	safelist := []string{"id", "year", "title"}
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor cursor
+	}{
+		{"year which isnt a number", "year", cursor{Sort: "year", Value: "nineteen", ID: 1}},
+		{"id which doesnt match", "id", cursor{Sort: "id", Value: "2", ID: 1}},
+		{"different sort", "title", cursor{Sort: "year", Value: "1999", ID: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{Page: 1, PageSize: 5, Sort: tt.sort, SortSafelist: safelist, Cursor: tt.cursor.encode()}
+
+			_, _, err := models.Movies.GetAll(context.Background(), MovieFilters{}, filters)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v; want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
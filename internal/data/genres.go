@@ -0,0 +1,399 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrDuplicateGenre is returned when the slug, name or one of the aliases of a genre would match another genre.
+var ErrDuplicateGenre = errors.New("duplicate genre")
+
+// A Genre is an entry in the genre vocabulary. Movies store the slugs of their genres, and the name is for display. When a movie is saved, its genres can
+// be given as the slug, the name or any of the aliases of a genre, in any case and with any punctuation (so "Sci-Fi", "scifi" and "science fiction" can all
+// be mapped to "science-fiction").
+type Genre struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"-"`
+	Slug       string    `json:"slug"`
+	Name       string    `json:"name"`
+	Aliases    []string  `json:"aliases"`
+	MovieCount int64     `json:"movie_count"`
+	Version    int32     `json:"version"`
+}
+
+// GenreSlug returns the slug form of a genre: lowercase, with every run of characters other than letters and digits replaced by a single hyphen. The
+// migration which created the genres table uses the same rule.
+func GenreSlug(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(GenreSlug(genre.Name) != "", "name", "must contain a letter or digit")
+
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(genre.Slug == GenreSlug(genre.Slug), "slug", "must only contain lowercase letters, digits and single hyphens")
+
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+	for _, alias := range genre.Aliases {
+		v.Check(alias != "" && alias == GenreSlug(alias), "aliases", "must only contain lowercase letters, digits and single hyphens")
+		v.Check(alias != genre.Slug, "aliases", "must not contain the slug")
+	}
+}
+
+// keys returns every slug-form value which identifies the genre.
+func (g *Genre) keys() []string {
+	return append([]string{g.Slug, GenreSlug(g.Name)}, g.Aliases...)
+}
+
+// genreConflict reports whether any of the keys of genre also identify one of the other genres.
+func genreConflict(genres []*Genre, genre *Genre) bool {
+	for _, other := range genres {
+		if other.ID != genre.ID && containsAny(other.keys(), genre.keys()) {
+			return true
+		}
+	}
+	return false
+}
+
+// A GenreVocabulary maps every key of every genre (its slug, the slug form of its name, and its aliases) to the genre's slug.
+type GenreVocabulary map[string]string
+
+func NewGenreVocabulary(genres []*Genre) GenreVocabulary {
+	vocabulary := make(GenreVocabulary)
+	for _, genre := range genres {
+		for _, key := range genre.keys() {
+			vocabulary[key] = genre.Slug
+		}
+	}
+	return vocabulary
+}
+
+// Normalize returns the slugs of the given genres, in the same order and without any duplicates. A genre which isnt in the vocabulary is reported as a
+// validation error on the given key and left out.
+func (gv GenreVocabulary) Normalize(v *validator.Validator, key string, genres []string) []string {
+	if genres == nil {
+		return nil
+	}
+
+	slugs := []string{}
+	for _, genre := range genres {
+		slug, ok := gv[GenreSlug(genre)]
+		if !ok {
+			v.AddError(key, fmt.Sprintf("contains unknown genre %q", genre))
+			continue
+		}
+		if !validator.In(slug, slugs...) {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
+
+// Canonical returns the slugs of the given genres in the same way as Normalize, except that genres which arent in the vocabulary are left as they are. It
+// is used for filters, where an unknown genre simply matches nothing.
+func (gv GenreVocabulary) Canonical(genres []string) []string {
+	canonical := make([]string, len(genres))
+	for i, genre := range genres {
+		canonical[i] = genre
+		if slug, ok := gv[GenreSlug(genre)]; ok {
+			canonical[i] = slug
+		}
+	}
+	return canonical
+}
+
+// The GenreModel struct type wraps a sql.DB connection pool, along with the maximum time that any single operation is allowed to run for.
+type GenreModel struct {
+	DB      DBTX
+	ReadDB  DBTX
+	Timeout time.Duration
+}
+
+// Insert() adds a new genre, setting the system-generated id, created_at and version values on the struct. It returns ErrDuplicateGenre if the genre would
+// match an existing genre.
+func (m GenreModel) Insert(ctx context.Context, genre *Genre) error {
+	return m.withGenresLocked(ctx, func(ctx context.Context, tx DBTX, genres []*Genre) error {
+		if genreConflict(genres, genre) {
+			return ErrDuplicateGenre
+		}
+
+		query := `
+            INSERT INTO genres (slug, name, aliases)
+            VALUES ($1, $2, $3)
+            RETURNING id, created_at, version`
+
+		return tx.QueryRowContext(ctx, query, genre.Slug, genre.Name, pq.Array(genre.Aliases)).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	})
+}
+
+// Get() returns the genre with the given id, or ErrRecordNotFound.
+func (m GenreModel) Get(ctx context.Context, id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, slug, name, aliases, version,
+            (SELECT count(*) FROM movies WHERE movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL)
+        FROM genres
+        WHERE id = $1`
+
+	genre := Genre{Aliases: []string{}}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.ReadDB.QueryRowContext(ctx, query, id).Scan(
+		&genre.ID,
+		&genre.CreatedAt,
+		&genre.Slug,
+		&genre.Name,
+		pq.Array(&genre.Aliases),
+		&genre.Version,
+		&genre.MovieCount,
+	)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+// GetAll() returns the whole genre vocabulary ordered by slug, along with the number of movies (not counting those in the trash) in each genre.
+func (m GenreModel) GetAll(ctx context.Context) ([]*Genre, error) {
+	query := `
+        SELECT id, created_at, slug, name, aliases, version,
+            (SELECT count(*) FROM movies WHERE movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL)
+        FROM genres
+        ORDER BY slug`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		genre := Genre{Aliases: []string{}}
+
+		err := rows.Scan(
+			&genre.ID,
+			&genre.CreatedAt,
+			&genre.Slug,
+			&genre.Name,
+			pq.Array(&genre.Aliases),
+			&genre.Version,
+			&genre.MovieCount,
+		)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		genres = append(genres, &genre)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return genres, nil
+}
+
+// Update() saves changes to a genre, using the version number for optimistic locking, and returns ErrEditConflict if it has been changed or merged away
+// since it was read. If the slug changes, every movie in the genre is rewritten to use the new slug (recording a revision of each one for the user), and
+// the old slug is kept as an alias so that it can still be used.
+func (m GenreModel) Update(ctx context.Context, genre *Genre, userID int64) error {
+	return m.withGenresLocked(ctx, func(ctx context.Context, tx DBTX, genres []*Genre) error {
+		var current *Genre
+		for _, g := range genres {
+			if g.ID == genre.ID && g.Version == genre.Version {
+				current = g
+			}
+		}
+		if current == nil {
+			return ErrEditConflict
+		}
+
+		if current.Slug != genre.Slug && !validator.In(current.Slug, genre.Aliases...) {
+			genre.Aliases = append(genre.Aliases, current.Slug)
+		}
+
+		if genreConflict(genres, genre) {
+			return ErrDuplicateGenre
+		}
+
+		query := `
+            UPDATE genres
+            SET slug = $1, name = $2, aliases = $3, version = version + 1
+            WHERE id = $4
+            RETURNING version`
+
+		err := tx.QueryRowContext(ctx, query, genre.Slug, genre.Name, pq.Array(genre.Aliases), genre.ID).Scan(&genre.Version)
+		if err != nil {
+			return err
+		}
+
+		if current.Slug != genre.Slug {
+			return rewriteMovieGenres(ctx, tx, current.Slug, genre.Slug, userID)
+		}
+
+		return nil
+	})
+}
+
+// Merge() merges the source genre into the target genre: every movie in the source genre is rewritten to use the target instead (recording a revision of
+// each one for the user), the slug, name and aliases of the source become aliases of the target, and the source is deleted. It returns the updated target,
+// or ErrRecordNotFound if either genre doesnt exist.
+func (m GenreModel) Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Genre, error) {
+	var target *Genre
+
+	err := m.withGenresLocked(ctx, func(ctx context.Context, tx DBTX, genres []*Genre) error {
+		var source *Genre
+		for _, g := range genres {
+			switch g.ID {
+			case sourceID:
+				source = g
+			case targetID:
+				target = g
+			}
+		}
+		if source == nil || target == nil {
+			return ErrRecordNotFound
+		}
+
+		target.Aliases = mergeGenreAliases(target, source)
+
+		query := `
+            UPDATE genres
+            SET aliases = $1, version = version + 1
+            WHERE id = $2
+            RETURNING version`
+
+		err := tx.QueryRowContext(ctx, query, pq.Array(target.Aliases), target.ID).Scan(&target.Version)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM genres WHERE id = $1", source.ID)
+		if err != nil {
+			return err
+		}
+
+		err = rewriteMovieGenres(ctx, tx, source.Slug, target.Slug, userID)
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRowContext(ctx, "SELECT count(*) FROM movies WHERE genres @> ARRAY[$1::text] AND deleted_at IS NULL", target.Slug).Scan(&target.MovieCount)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// mergeGenreAliases returns the aliases of the target genre with the keys of the source genre added.
+func mergeGenreAliases(target, source *Genre) []string {
+	aliases := cloneStrings(target.Aliases)
+	for _, key := range source.keys() {
+		if !validator.In(key, target.keys()...) && !validator.In(key, aliases...) {
+			aliases = append(aliases, key)
+		}
+	}
+	return aliases
+}
+
+// rewriteMovieGenres replaces the genre slug from with to on every movie which has it (including those in the trash), removing it instead if the movie
+// already has the genre to. The version of each movie is incremented and a revision recorded for it, in the same way as MovieModel.Update().
+func rewriteMovieGenres(ctx context.Context, tx DBTX, from, to string, userID int64) error {
+	query := `
+        WITH updated AS (
+            UPDATE movies
+            SET genres = CASE WHEN genres @> ARRAY[$2::text] THEN array_remove(genres, $1::text) ELSE array_replace(genres, $1::text, $2::text) END,
+                version = version + 1
+            WHERE genres @> ARRAY[$1::text]
+            RETURNING id, title, year, runtime, genres, status, version
+        )
+        INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+        SELECT id, version, 'update', title, year, runtime, genres, status,
+            COALESCE((SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = updated.id), '{}'),
+            COALESCE((SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = updated.id), '{}'),
+            NULLIF($3::bigint, 0)
+        FROM updated`
+
+	_, err := tx.ExecContext(ctx, query, from, to, userID)
+	return err
+}
+
+// withGenresLocked runs fn in a transaction which holds an exclusive lock on the genres table, passing it every genre. Genres are only changed by
+// administrators, so locking the whole table is a simple way to make sure that no two genres can end up with the same key.
+func (m GenreModel) withGenresLocked(ctx context.Context, fn func(context.Context, DBTX, []*Genre) error) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "LOCK TABLE genres IN EXCLUSIVE MODE")
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, created_at, slug, name, aliases, version FROM genres")
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		genre := Genre{Aliases: []string{}}
+
+		err := rows.Scan(&genre.ID, &genre.CreatedAt, &genre.Slug, &genre.Name, pq.Array(&genre.Aliases), &genre.Version)
+		if err != nil {
+			rows.Close()
+			return contextError(ctx, err)
+		}
+
+		genres = append(genres, &genre)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = fn(ctx, tx, genres)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
+}
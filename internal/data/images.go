@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/myk4040okothogodo/greenlight/internal/imaging"
+	"time"
+)
+
+// Define constants for the kinds of image that a movie can have. A movie has at most one poster, and any number of stills up to MaxStills.
+const (
+	ImagePoster = "poster"
+	ImageStill  = "still"
+)
+
+// MaxStills is the largest number of stills that a movie can have.
+const MaxStills = 50
+
+// ErrImageLimit is returned when adding a still to a movie which already has MaxStills stills.
+var ErrImageLimit = errors.New("image limit reached")
+
+// An Image is a poster or still of a movie. The image file and its thumbnails are kept in a blob store under the Key, which is unique to each upload, so
+// the URLs of an image never change what they point to and can be cached indefinitely. URL and Thumbnails are filled in from the other fields when the
+// image is read.
+type Image struct {
+	ID              int64       `json:"id"`
+	MovieID         int64       `json:"-"`
+	Kind            string      `json:"-"`
+	Key             string      `json:"-"`
+	ContentType     string      `json:"content_type"`
+	Width           int32       `json:"width"`
+	Height          int32       `json:"height"`
+	Size            int64       `json:"size"`
+	ThumbnailWidths []int32     `json:"-"`
+	CreatedAt       time.Time   `json:"created_at"`
+	URL             string      `json:"url"`
+	Thumbnails      []Thumbnail `json:"thumbnails,omitempty"`
+}
+
+// A Thumbnail is a copy of an image scaled down to the given width.
+type Thumbnail struct {
+	Width int32  `json:"width"`
+	URL   string `json:"url"`
+}
+
+// NewImageKey returns a new, random blob key prefix for an image of the movie. Every blob for the movie is kept under MovieBlobPrefix().
+func NewImageKey(movieID int64) (string, error) {
+	randomBytes := make([]byte, 8)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s", MovieBlobPrefix(movieID), hex.EncodeToString(randomBytes)), nil
+}
+
+// MovieBlobPrefix returns the blob key prefix which every image of the movie is stored under, so that they can be deleted together when it is purged.
+func MovieBlobPrefix(movieID int64) string {
+	return fmt.Sprintf("movies/%d", movieID)
+}
+
+// OriginalKey returns the blob key of the uploaded image file.
+func (i *Image) OriginalKey() string {
+	return fmt.Sprintf("%s/original.%s", i.Key, imaging.Extension(i.ContentType))
+}
+
+// ThumbnailKey returns the blob key of the thumbnail with the given width. Thumbnails are stored in the same format as the original.
+func (i *Image) ThumbnailKey(width int32) string {
+	return fmt.Sprintf("%s/w%d.%s", i.Key, width, imaging.Extension(i.ContentType))
+}
+
+// setURLs fills in the URL and Thumbnails fields from the blob keys. The URLs are relative to the API, which serves blobs under /v1/media/.
+func (i *Image) setURLs() {
+	i.URL = "/v1/media/" + i.OriginalKey()
+
+	i.Thumbnails = []Thumbnail{}
+	for _, width := range i.ThumbnailWidths {
+		i.Thumbnails = append(i.Thumbnails, Thumbnail{Width: width, URL: "/v1/media/" + i.ThumbnailKey(width)})
+	}
+}
+
+// The ImageModel struct type wraps a sql.DB connection pool, along with the maximum time that any single query is allowed to run for.
+type ImageModel struct {
+	DB      DBTX
+	Timeout time.Duration
+}
+
+// imageColumns are the columns read into an Image by scanImage().
+const imageColumns = "id, movie_id, kind, key, content_type, width, height, size, thumbnail_widths, created_at"
+
+// scanImage scans a row of imageColumns into an Image and fills in its URLs.
+func scanImage(row interface{ Scan(...interface{}) error }) (*Image, error) {
+	var image Image
+
+	err := row.Scan(
+		&image.ID,
+		&image.MovieID,
+		&image.Kind,
+		&image.Key,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+		&image.Size,
+		pq.Array(&image.ThumbnailWidths),
+		&image.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	image.setURLs()
+	return &image, nil
+}
+
+// Insert() adds an image to a movie, setting its id, created_at and URLs. Adding a poster replaces the movie's existing poster, which is returned so that
+// the caller can delete its blobs. It returns ErrRecordNotFound if the movie doesnt exist or is in the trash, and ErrImageLimit if the movie already has
+// MaxStills stills. The movie row is locked while the image is added, so that concurrent uploads can't leave a movie with two posters or too many stills.
+func (m ImageModel) Insert(ctx context.Context, image *Image) (*Image, error) {
+	if image.MovieID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB, nil)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+
+	err = tx.QueryRowContext(ctx, "SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", image.MovieID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	var replaced *Image
+
+	switch image.Kind {
+	case ImagePoster:
+		query := fmt.Sprintf("DELETE FROM movie_images WHERE movie_id = $1 AND kind = 'poster' RETURNING %s", imageColumns)
+
+		replaced, err = scanImage(tx.QueryRowContext(ctx, query, image.MovieID))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, contextError(ctx, err)
+		}
+	case ImageStill:
+		var stills int
+
+		err = tx.QueryRowContext(ctx, "SELECT count(*) FROM movie_images WHERE movie_id = $1 AND kind = 'still'", image.MovieID).Scan(&stills)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		if stills >= MaxStills {
+			return nil, ErrImageLimit
+		}
+	}
+
+	query := `
+        INSERT INTO movie_images (movie_id, kind, key, content_type, width, height, size, thumbnail_widths)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, created_at`
+
+	args := []interface{}{image.MovieID, image.Kind, image.Key, image.ContentType, image.Width, image.Height, image.Size, pq.Array(image.ThumbnailWidths)}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.CreatedAt)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	image.setURLs()
+	return replaced, nil
+}
+
+// GetAllForMovie() returns the images of a movie of the given kind, in the order they were added.
+func (m ImageModel) GetAllForMovie(ctx context.Context, movieID int64, kind string) ([]*Image, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM movie_images
+        WHERE movie_id = $1 AND kind = $2
+        ORDER BY id`, imageColumns)
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, kind)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	images := []*Image{}
+
+	for rows.Next() {
+		image, err := scanImage(rows)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		images = append(images, image)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return images, nil
+}
+
+// Delete() removes an image of the given kind from a movie and returns it, so that the caller can delete its blobs, or returns ErrRecordNotFound.
+func (m ImageModel) Delete(ctx context.Context, movieID, id int64, kind string) (*Image, error) {
+	query := fmt.Sprintf("DELETE FROM movie_images WHERE id = $1 AND movie_id = $2 AND kind = $3 RETURNING %s", imageColumns)
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	image, err := scanImage(m.DB.QueryRowContext(ctx, query, id, movieID, kind))
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return image, nil
+}
+
+// attachPosters looks up the posters of the movies in a single query and sets the Poster field of each movie which has one.
+func attachPosters(ctx context.Context, db DBTX, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM movie_images WHERE movie_id = ANY($1) AND kind = 'poster'", imageColumns)
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	posters := make(map[int64]*Image)
+
+	for rows.Next() {
+		image, err := scanImage(rows)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		posters[image.MovieID] = image
+	}
+	if err = rows.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	for _, movie := range movies {
+		movie.Poster = posters[movie.ID]
+	}
+
+	return nil
+}
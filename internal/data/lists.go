@@ -0,0 +1,547 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"time"
+)
+
+// ErrDuplicateListItem is returned when a movie is added to a list which already contains it.
+var ErrDuplicateListItem = errors.New("duplicate list item")
+
+// A List is a user's personal list of movies. Every user has a watchlist, which is created the first time it is used and can't be deleted, and can also
+// create any number of named lists. A public list can be read by other users through its share slug.
+type List struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"-"`
+	Name      string    `json:"name"`
+	Watchlist bool      `json:"watchlist"`
+	Public    bool      `json:"public"`
+	ShareSlug string    `json:"share_slug,omitempty"`
+	ItemCount int32     `json:"item_count"`
+	Version   int32     `json:"version"`
+}
+
+// A ListItem is a movie on a list. Position is the order chosen by the owner of the list, starting from 1, and WatchedAt is the date they watched it.
+type ListItem struct {
+	Position  int32      `json:"position"`
+	AddedAt   time.Time  `json:"added_at"`
+	WatchedAt *time.Time `json:"watched_at,omitempty"`
+	Movie     *Movie     `json:"movie"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 500, "name", "must not be more than 500 bytes long")
+}
+
+func ValidateListItem(v *validator.Validator, item *ListItem) {
+	v.Check(item.Position >= 1, "position", "must be greater than zero")
+	v.Check(item.WatchedAt == nil || !item.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+}
+
+// setShareSlug gives a public list a random share slug if it doesnt already have one, and removes the slug from a private list, so that links to a list
+// stop working when it is made private and a new link is issued if it is made public again.
+func setShareSlug(list *List) error {
+	if !list.Public {
+		list.ShareSlug = ""
+		return nil
+	}
+
+	if list.ShareSlug == "" {
+		randomBytes := make([]byte, 9)
+
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return err
+		}
+
+		list.ShareSlug = base64.RawURLEncoding.EncodeToString(randomBytes)
+	}
+
+	return nil
+}
+
+// The ListModel struct type wraps a sql.DB connection pool, along with the maximum time that any single operation is allowed to run for.
+type ListModel struct {
+	DB      DBTX
+	Timeout time.Duration
+}
+
+// listColumns are the columns selected for a list. The item count leaves out movies which are in the trash, in the same way as GetItems().
+const listColumns = `
+        lists.id, lists.created_at, lists.user_id, lists.name, lists.is_watchlist, lists.public, COALESCE(lists.share_slug, ''), lists.version,
+        (SELECT count(*) FROM list_items INNER JOIN movies ON movies.id = list_items.movie_id
+         WHERE list_items.list_id = lists.id AND movies.deleted_at IS NULL)`
+
+// Insert() adds a new named list, setting the system-generated id, created_at and version values and the share slug on the struct.
+func (m ListModel) Insert(ctx context.Context, list *List) error {
+	err := setShareSlug(list)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO lists (user_id, name, public, share_slug)
+        VALUES ($1, $2, $3, NULLIF($4, ''))
+        RETURNING id, created_at, version`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, list.UserID, list.Name, list.Public, list.ShareSlug).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	return contextError(ctx, err)
+}
+
+// Get() returns the list with the given id if it belongs to the user, or ErrRecordNotFound. Lists which belong to other users are reported as not found,
+// so that their existence isnt revealed.
+func (m ListModel) Get(ctx context.Context, id, userID int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.get(ctx, "lists.id = $1 AND lists.user_id = $2", id, userID)
+}
+
+// GetWatchlist() returns the user's watchlist, creating it if they dont have one yet.
+func (m ListModel) GetWatchlist(ctx context.Context, userID int64) (*List, error) {
+	query := `
+        INSERT INTO lists (user_id, name, is_watchlist)
+        VALUES ($1, 'Watchlist', true)
+        ON CONFLICT (user_id) WHERE is_watchlist DO NOTHING`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return m.get(ctx, "lists.user_id = $1 AND lists.is_watchlist", userID)
+}
+
+// GetShared() returns the public list with the given share slug, or ErrRecordNotFound.
+func (m ListModel) GetShared(ctx context.Context, slug string) (*List, error) {
+	if slug == "" {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.get(ctx, "lists.share_slug = $1 AND lists.public", slug)
+}
+
+// get returns the single list matched by the where condition, or ErrRecordNotFound.
+func (m ListModel) get(ctx context.Context, where string, args ...interface{}) (*List, error) {
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM lists
+        WHERE %s`, listColumns, where)
+
+	var list List
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UserID,
+		&list.Name,
+		&list.Watchlist,
+		&list.Public,
+		&list.ShareSlug,
+		&list.Version,
+		&list.ItemCount,
+	)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetAllForUser() returns a page of the user's lists, with their watchlist first.
+func (m ListModel) GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM lists
+        WHERE lists.user_id = $1
+        ORDER BY lists.is_watchlist DESC, lists.%s %s, lists.id ASC
+        LIMIT $2 OFFSET $3`, listColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.CreatedAt,
+			&list.UserID,
+			&list.Name,
+			&list.Watchlist,
+			&list.Public,
+			&list.ShareSlug,
+			&list.Version,
+			&list.ItemCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return lists, metadata, nil
+}
+
+// Update() saves changes to the name and visibility of a list, using the version number for optimistic locking in the same way as MovieModel.Update(). It
+// returns ErrEditConflict if the list has been changed or deleted since it was read.
+func (m ListModel) Update(ctx context.Context, list *List) error {
+	err := setShareSlug(list)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE lists
+        SET name = $1, public = $2, share_slug = NULLIF($3, ''), version = version + 1
+        WHERE id = $4 AND user_id = $5 AND version = $6
+        RETURNING version`
+
+	args := []interface{}{list.Name, list.Public, list.ShareSlug, list.ID, list.UserID, list.Version}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete() removes a list belonging to the user along with its items, or returns ErrRecordNotFound. The caller is responsible for refusing to delete the
+// user's watchlist.
+func (m ListModel) Delete(ctx context.Context, id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM lists WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// listItemSortColumns maps the sort values for list items to the columns of the query in GetItems().
+var listItemSortColumns = map[string]string{
+	"position":   "list_items.position",
+	"added_at":   "list_items.added_at",
+	"watched_at": "list_items.watched_at",
+	"title":      "movies.title",
+	"year":       "movies.year",
+	"runtime":    "movies.runtime",
+	"rating":     "movies.average_rating",
+}
+
+// GetItems() returns a page of the movies on a list. Movies which are in the trash are left out, but keep their place on the list in case they are
+// restored; purging a movie removes it from every list through the ON DELETE CASCADE on list_items. The caller is responsible for checking that the user is
+// allowed to read the list.
+func (m ListModel) GetItems(ctx context.Context, listID int64, filters Filters) ([]*ListItem, Metadata, error) {
+	direction := filters.sortDirection()
+
+	// Movies which havent been watched sort before any that have, like the nil times in compareTimes().
+	nulls := "NULLS FIRST"
+	if direction == "DESC" {
+		nulls = "NULLS LAST"
+	}
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), list_items.position, list_items.added_at, list_items.watched_at,
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.status, movies.version, movies.average_rating, movies.rating_count
+        FROM list_items
+        INNER JOIN movies ON movies.id = list_items.movie_id
+        WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY %s %s %s, list_items.position ASC
+        LIMIT $2 OFFSET $3`, listItemSortColumns[filters.sortColumn()], direction, nulls)
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*ListItem{}
+
+	for rows.Next() {
+		item := ListItem{Movie: &Movie{}}
+
+		err := rows.Scan(
+			&totalRecords,
+			&item.Position,
+			&item.AddedAt,
+			&item.WatchedAt,
+			&item.Movie.ID,
+			&item.Movie.CreatedAt,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+			&item.Movie.Status,
+			&item.Movie.Version,
+			&item.Movie.AverageRating,
+			&item.Movie.RatingCount,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	rows.Close()
+
+	movies := make([]*Movie, len(items))
+	for i, item := range items {
+		movies[i] = item.Movie
+	}
+
+	err = attachMovieDetails(ctx, m.DB, movies)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
+
+// GetItem() returns the item for a movie on a list, or ErrRecordNotFound if the movie isnt on the list or is in the trash.
+func (m ListModel) GetItem(ctx context.Context, listID, movieID int64) (*ListItem, error) {
+	query := `
+        SELECT list_items.position, list_items.added_at, list_items.watched_at,
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.status, movies.version, movies.average_rating, movies.rating_count
+        FROM list_items
+        INNER JOIN movies ON movies.id = list_items.movie_id
+        WHERE list_items.list_id = $1 AND list_items.movie_id = $2 AND movies.deleted_at IS NULL`
+
+	item := ListItem{Movie: &Movie{}}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, listID, movieID).Scan(
+		&item.Position,
+		&item.AddedAt,
+		&item.WatchedAt,
+		&item.Movie.ID,
+		&item.Movie.CreatedAt,
+		&item.Movie.Title,
+		&item.Movie.Year,
+		&item.Movie.Runtime,
+		pq.Array(&item.Movie.Genres),
+		&item.Movie.Status,
+		&item.Movie.Version,
+		&item.Movie.AverageRating,
+		&item.Movie.RatingCount,
+	)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = attachMovieDetails(ctx, m.DB, []*Movie{item.Movie})
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// AddItem() adds the movie on the item to the end of a list, setting the position and added_at values on the struct. It returns ErrRecordNotFound if the
+// movie doesnt exist (or is in the trash), and ErrDuplicateListItem if it is already on the list.
+func (m ListModel) AddItem(ctx context.Context, listID int64, item *ListItem) error {
+	return m.withListLocked(ctx, listID, func(ctx context.Context, tx DBTX) error {
+		query := `
+            INSERT INTO list_items (list_id, movie_id, position)
+            SELECT $1, movies.id, (SELECT COALESCE(max(position), 0) + 1 FROM list_items WHERE list_id = $1)
+            FROM movies
+            WHERE movies.id = $2 AND movies.deleted_at IS NULL
+            RETURNING position, added_at`
+
+		err := tx.QueryRowContext(ctx, query, listID, item.Movie.ID).Scan(&item.Position, &item.AddedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			case err.Error() == `pq: duplicate key value violates unique constraint "list_items_pkey"`:
+				return ErrDuplicateListItem
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UpdateItem() moves a movie to a new position on a list, shifting the movies in between up or down by one, and saves the date it was watched. A position
+// past the end of the list moves the movie to the end, and the position on the struct is updated to match. It returns ErrRecordNotFound if the movie isnt
+// on the list.
+func (m ListModel) UpdateItem(ctx context.Context, listID int64, item *ListItem) error {
+	return m.withListLocked(ctx, listID, func(ctx context.Context, tx DBTX) error {
+		var current, last int32
+
+		query := `
+            SELECT position, (SELECT max(position) FROM list_items WHERE list_id = $1)
+            FROM list_items
+            WHERE list_id = $1 AND movie_id = $2`
+
+		err := tx.QueryRowContext(ctx, query, listID, item.Movie.ID).Scan(&current, &last)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		if item.Position > last {
+			item.Position = last
+		}
+
+		if item.Position != current {
+			query = `
+                UPDATE list_items
+                SET position = CASE
+                    WHEN movie_id = $2 THEN $4
+                    WHEN $3 < $4 THEN position - 1
+                    ELSE position + 1
+                END
+                WHERE list_id = $1 AND position BETWEEN least($3, $4) AND greatest($3, $4)`
+
+			_, err = tx.ExecContext(ctx, query, listID, item.Movie.ID, current, item.Position)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE list_items SET watched_at = $1 WHERE list_id = $2 AND movie_id = $3", item.WatchedAt, listID, item.Movie.ID)
+		return err
+	})
+}
+
+// RemoveItem() removes a movie from a list and closes the gap it leaves in the positions, or returns ErrRecordNotFound.
+func (m ListModel) RemoveItem(ctx context.Context, listID, movieID int64) error {
+	return m.withListLocked(ctx, listID, func(ctx context.Context, tx DBTX) error {
+		var position int32
+
+		err := tx.QueryRowContext(ctx, "DELETE FROM list_items WHERE list_id = $1 AND movie_id = $2 RETURNING position", listID, movieID).Scan(&position)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE list_items SET position = position - 1 WHERE list_id = $1 AND position > $2", listID, position)
+		return err
+	})
+}
+
+// withListLocked runs fn in a transaction which holds a lock on the list row, so that concurrent changes to the positions on the same list are applied one
+// after the other. It returns ErrRecordNotFound if the list doesnt exist.
+func (m ListModel) withListLocked(ctx context.Context, listID int64, fn func(context.Context, DBTX) error) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+
+	err = tx.QueryRowContext(ctx, "SELECT id FROM lists WHERE id = $1 FOR UPDATE", listID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
+}
@@ -0,0 +1,156 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// The memoryDB type is the shared state behind the in-memory models. It plays the part of the PostgreSQL database: every model holds a pointer to the same
+// memoryDB, and a single RWMutex protects all of the tables so that operations which touch more than one of them (like GetForToken) see a consistent view.
+type memoryDB struct {
+	mu sync.RWMutex
+
+	// txMu is held for the whole of a transaction started by withTx(), so that only one runs at a time.
+	txMu sync.Mutex
+
+	movies      map[int64]Movie
+	lastMovieID int64
+
+	// movieRevisions is append-only, so it is already ordered from oldest to newest.
+	movieRevisions []MovieRevision
+
+	people       map[int64]Person
+	lastPersonID int64
+
+	credits      map[int64]Credit
+	lastCreditID int64
+
+	ratings map[ratingKey]Rating
+
+	lists      map[int64]List
+	lastListID int64
+	listItems  map[listItemKey]memoryListItem
+
+	genres      map[int64]Genre
+	lastGenreID int64
+
+	images      map[int64]Image
+	lastImageID int64
+
+	externalIDs map[int64]ExternalIDs
+
+	releaseDates map[int64]ReleaseDates
+
+	translations map[translationKey]Translation
+
+	// movieRedirects maps the id of each movie which has been merged into another to the id of the movie it was merged into.
+	movieRedirects map[int64]int64
+
+	users      map[int64]User
+	lastUserID int64
+
+	// Tokens are keyed by the string form of their SHA-256 hash, mirroring the primary key on the tokens table.
+	tokens map[string]Token
+
+	// permissionCodes holds the codes which can be granted (the equivalent of the rows in the permissions table) and userPermissions the codes granted to each user.
+	permissionCodes []string
+	userPermissions map[int64]Permissions
+}
+
+func newMemoryDB() *memoryDB {
+	db := &memoryDB{
+		movies:          make(map[int64]Movie),
+		people:          make(map[int64]Person),
+		credits:         make(map[int64]Credit),
+		ratings:         make(map[ratingKey]Rating),
+		lists:           make(map[int64]List),
+		listItems:       make(map[listItemKey]memoryListItem),
+		genres:          make(map[int64]Genre),
+		images:          make(map[int64]Image),
+		externalIDs:     make(map[int64]ExternalIDs),
+		releaseDates:    make(map[int64]ReleaseDates),
+		movieRedirects:  make(map[int64]int64),
+		translations:    make(map[translationKey]Translation),
+		users:           make(map[int64]User),
+		tokens:          make(map[string]Token),
+		permissionCodes: []string{"movies:read", "movies:write", "movies:purge", "movies:export", "genres:write"},
+		userPermissions: make(map[int64]Permissions),
+	}
+
+	for _, genre := range defaultGenres {
+		genre := genre
+		db.insertGenre(&genre)
+	}
+
+	return db
+}
+
+// memoryContextError returns the error that a PostgreSQL query would have failed with if the caller's context is already done, or nil otherwise. The in-memory
+// operations never block, so checking the context once up front is enough.
+func memoryContextError(ctx context.Context) error {
+	return contextError(ctx, ctx.Err())
+}
+
+// paginate returns the page of items selected by the Page and PageSize fields of the filters.
+func paginate[T any](items []T, filters Filters) []T {
+	return window(items, filters.offset(), filters.limit())
+}
+
+// window returns up to n items starting from the given index.
+func window[T any](items []T, start, n int) []T {
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + n
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// searchTerms splits a string into lowercase words in the same way as the 'simple' text search configuration, so that the in-memory title search behaves like
+// to_tsvector('simple', ...) @@ plainto_tsquery('simple', ...).
+func searchTerms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsAll returns true if every value in want is present in have.
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAny returns true if at least one value in want is present in have.
+func containsAny(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cloneStrings returns a copy of a string slice, so that callers can't modify the data held in the store through a slice they were given (or handed in).
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"sort"
+)
+
+// FindDuplicates() returns the ids of the movies which are probably the same film as the movie, in the same way as MovieModel.FindDuplicates().
+func (m MemoryMovieModel) FindDuplicates(ctx context.Context, movie *Movie, match string) ([]int64, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	title := NormalizeTitle(movie.Title)
+
+	type candidate struct {
+		id    int64
+		score float64
+	}
+	candidates := []candidate{}
+
+	for _, other := range m.db.movies {
+		if other.ID == movie.ID || other.DeletedAt != nil {
+			continue
+		}
+
+		otherTitle := NormalizeTitle(other.Title)
+
+		switch match {
+		case DuplicateFuzzy:
+			score := similarity(otherTitle, title)
+			if score >= duplicateThreshold && other.Year >= movie.Year-1 && other.Year <= movie.Year+1 {
+				candidates = append(candidates, candidate{other.ID, score})
+			}
+		default:
+			if otherTitle == title && other.Year == movie.Year {
+				candidates = append(candidates, candidate{other.ID, 1})
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].id < candidates[j].id
+	})
+
+	ids := []int64{}
+	for _, c := range window(candidates, 0, maxDuplicates) {
+		ids = append(ids, c.id)
+	}
+
+	return ids, nil
+}
+
+// Merge() folds the source movie into the target movie, in the same way as MovieModel.Merge().
+func (m MemoryMovieModel) Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Movie, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	source, ok := m.db.movies[sourceID]
+	if !ok || source.DeletedAt != nil || sourceID == targetID {
+		return nil, ErrRecordNotFound
+	}
+	target, ok := m.db.movies[targetID]
+	if !ok || target.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	genres := mergeMovieGenres(target.Genres, source.Genres)
+	if len(genres) > 5 {
+		return nil, ErrTooManyGenres
+	}
+
+	// Move across the credits, ratings, list items, external IDs and translations which the target doesnt already have. Whatever is left on the source is
+	// deleted with it.
+	for id, credit := range m.db.credits {
+		if credit.MovieID != sourceID || m.db.hasCredit(targetID, credit) {
+			continue
+		}
+		credit.MovieID = targetID
+		m.db.credits[id] = credit
+	}
+
+	for key, rating := range m.db.ratings {
+		if key.movieID != sourceID {
+			continue
+		}
+		if _, ok := m.db.ratings[ratingKey{targetID, key.userID}]; !ok {
+			rating.MovieID = targetID
+			m.db.ratings[ratingKey{targetID, key.userID}] = rating
+		}
+		delete(m.db.ratings, key)
+	}
+
+	for key, item := range m.db.listItems {
+		if key.movieID != sourceID {
+			continue
+		}
+		if _, ok := m.db.listItems[listItemKey{key.listID, targetID}]; ok {
+			m.db.removeListItem(key)
+			continue
+		}
+		m.db.listItems[listItemKey{key.listID, targetID}] = item
+		delete(m.db.listItems, key)
+	}
+
+	for externalSource, externalID := range m.db.externalIDs[sourceID] {
+		if _, ok := m.db.externalIDs[targetID][externalSource]; ok {
+			continue
+		}
+		if m.db.externalIDs[targetID] == nil {
+			m.db.externalIDs[targetID] = ExternalIDs{}
+		}
+		m.db.externalIDs[targetID][externalSource] = externalID
+	}
+	delete(m.db.externalIDs, sourceID)
+
+	for key, translation := range m.db.translations {
+		if key.movieID != sourceID {
+			continue
+		}
+		if _, ok := m.db.translations[translationKey{targetID, key.language}]; !ok {
+			translation.MovieID = targetID
+			m.db.translations[translationKey{targetID, key.language}] = translation
+		}
+		delete(m.db.translations, key)
+	}
+
+	for from, to := range m.db.movieRedirects {
+		if to == sourceID {
+			m.db.movieRedirects[from] = targetID
+		}
+	}
+
+	source.Version++
+	m.db.addRevision(source, RevisionMerge, userID)
+	m.db.deleteMovie(sourceID)
+	m.db.movieRedirects[sourceID] = targetID
+
+	target.Genres = genres
+	target.Version++
+	m.db.movies[targetID] = target
+	m.db.updateRatingAggregates(targetID)
+
+	target = m.db.movies[targetID]
+	m.db.addRevision(target, RevisionMerge, userID)
+
+	target.Genres = cloneStrings(target.Genres)
+	m.db.addMovieDetails(&target)
+	return &target, nil
+}
+
+// GetMergedInto() returns the id of the movie that the movie with the given id was merged into, or ErrRecordNotFound if it wasnt merged.
+func (m MemoryMovieModel) GetMergedInto(ctx context.Context, id int64) (int64, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return 0, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	targetID, ok := m.db.movieRedirects[id]
+	if !ok {
+		return 0, ErrRecordNotFound
+	}
+
+	return targetID, nil
+}
+
+// hasCredit reports whether the movie already has a credit for the same person, role and character as the given credit. The caller must hold the lock.
+func (db *memoryDB) hasCredit(movieID int64, credit Credit) bool {
+	for _, existing := range db.credits {
+		if existing.MovieID == movieID && existing.PersonID == credit.PersonID && existing.Role == credit.Role && existing.Character == credit.Character {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+)
+
+// GetByExternalID() returns a copy of the movie with the given ID in another catalogue, or ErrRecordNotFound if there isnt one or it is in the trash.
+func (m MemoryMovieModel) GetByExternalID(ctx context.Context, source, externalID string) (*Movie, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for movieID, ids := range m.db.externalIDs {
+		if ids[source] != externalID {
+			continue
+		}
+
+		movie, ok := m.db.movies[movieID]
+		if !ok || movie.DeletedAt != nil {
+			break
+		}
+
+		movie.Genres = cloneStrings(movie.Genres)
+		m.db.addMovieDetails(&movie)
+		return &movie, nil
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// externalIDConflict reports whether any of the external IDs belongs to a movie other than the one with the given id, like the unique constraint on the
+// movie_external_ids table. The caller must hold the lock.
+func (db *memoryDB) externalIDConflict(movieID int64, ids ExternalIDs) bool {
+	for otherID, other := range db.externalIDs {
+		if otherID == movieID {
+			continue
+		}
+		for source, id := range ids {
+			if other[source] == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setExternalIDs replaces the external IDs of a movie with a copy of ids, unless ids is nil. The caller must hold the write lock.
+func (db *memoryDB) setExternalIDs(movieID int64, ids ExternalIDs) {
+	if ids == nil {
+		return
+	}
+
+	if len(ids) == 0 {
+		delete(db.externalIDs, movieID)
+		return
+	}
+
+	db.externalIDs[movieID] = cloneExternalIDs(ids)
+}
+
+// matchExternalIDs reports whether a movie has an external ID from every source in HasExternalIDs and from none of the sources in MissingExternalIDs. The
+// caller must hold the lock.
+func (db *memoryDB) matchExternalIDs(movieID int64, f MovieFilters) bool {
+	ids := db.externalIDs[movieID]
+
+	for _, source := range f.HasExternalIDs {
+		if _, ok := ids[source]; !ok {
+			return false
+		}
+	}
+	for _, source := range f.MissingExternalIDs {
+		if _, ok := ids[source]; ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addMovieDetails sets the data about a movie which is kept outside the movies table, like its poster, external IDs and release dates, in the same way as
+// attachMovieDetails(). The caller must hold the lock.
+func (db *memoryDB) addMovieDetails(movie *Movie) {
+	movie.Poster = db.moviePoster(movie.ID)
+	movie.ExternalIDs = cloneExternalIDs(db.externalIDs[movie.ID])
+	movie.ReleaseDates = cloneReleaseDates(db.releaseDates[movie.ID])
+}
+
+// attachMovieDetails calls addMovieDetails() for each of the movies. It takes the read lock itself.
+func (db *memoryDB) attachMovieDetails(movies []*Movie) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, movie := range movies {
+		db.addMovieDetails(movie)
+	}
+}
+
+// cloneExternalIDs returns a copy of a set of external IDs, or nil if it is empty.
+func cloneExternalIDs(ids ExternalIDs) ExternalIDs {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	clone := make(ExternalIDs, len(ids))
+	for source, id := range ids {
+		clone[source] = id
+	}
+	return clone
+}
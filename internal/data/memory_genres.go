@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"sort"
+	"time"
+)
+
+// defaultGenres is the vocabulary that a new in-memory store starts with, matching the genres inserted by the migration which created the genres table.
+var defaultGenres = []Genre{
+	{Slug: "action", Name: "Action"},
+	{Slug: "adventure", Name: "Adventure"},
+	{Slug: "animation", Name: "Animation", Aliases: []string{"animated"}},
+	{Slug: "comedy", Name: "Comedy"},
+	{Slug: "crime", Name: "Crime"},
+	{Slug: "documentary", Name: "Documentary"},
+	{Slug: "drama", Name: "Drama"},
+	{Slug: "family", Name: "Family"},
+	{Slug: "fantasy", Name: "Fantasy"},
+	{Slug: "history", Name: "History", Aliases: []string{"historical"}},
+	{Slug: "horror", Name: "Horror"},
+	{Slug: "music", Name: "Music", Aliases: []string{"musical"}},
+	{Slug: "mystery", Name: "Mystery"},
+	{Slug: "romance", Name: "Romance", Aliases: []string{"romantic"}},
+	{Slug: "science-fiction", Name: "Science Fiction", Aliases: []string{"sci-fi", "scifi", "sf"}},
+	{Slug: "thriller", Name: "Thriller"},
+	{Slug: "war", Name: "War"},
+	{Slug: "western", Name: "Western"},
+}
+
+// The MemoryGenreModel type stores the genre vocabulary in memory. It honours the same contract as GenreModel.
+type MemoryGenreModel struct {
+	db *memoryDB
+}
+
+// Insert() assigns the system-generated id, created_at and version values to the genre and stores a copy of it, or returns ErrDuplicateGenre.
+func (m MemoryGenreModel) Insert(ctx context.Context, genre *Genre) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if genreConflict(m.db.allGenres(), genre) {
+		return ErrDuplicateGenre
+	}
+
+	m.db.insertGenre(genre)
+
+	return nil
+}
+
+// Get() returns a copy of the genre with the given id, or ErrRecordNotFound.
+func (m MemoryGenreModel) Get(ctx context.Context, id int64) (*Genre, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	genre, ok := m.db.genres[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.db.genreWithCount(genre), nil
+}
+
+// GetAll() returns the whole genre vocabulary ordered by slug, along with the number of movies in each genre.
+func (m MemoryGenreModel) GetAll(ctx context.Context) ([]*Genre, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	genres := []*Genre{}
+	for _, genre := range m.db.genres {
+		genres = append(genres, m.db.genreWithCount(genre))
+	}
+
+	sort.Slice(genres, func(i, j int) bool {
+		return genres[i].Slug < genres[j].Slug
+	})
+
+	return genres, nil
+}
+
+// Update() saves changes to a genre only if the stored version still matches the version on the struct, rewriting the movies in the genre if the slug
+// changes, in the same way as GenreModel.Update().
+func (m MemoryGenreModel) Update(ctx context.Context, genre *Genre, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.genres[genre.ID]
+	if !ok || current.Version != genre.Version {
+		return ErrEditConflict
+	}
+
+	aliases := cloneStrings(genre.Aliases)
+	if current.Slug != genre.Slug && !validator.In(current.Slug, aliases...) {
+		aliases = append(aliases, current.Slug)
+	}
+
+	updated := *genre
+	updated.Aliases = aliases
+	if genreConflict(m.db.allGenres(), &updated) {
+		return ErrDuplicateGenre
+	}
+
+	updated.Version++
+	m.db.genres[genre.ID] = updated
+
+	genre.Aliases = cloneStrings(aliases)
+	genre.Version = updated.Version
+
+	if current.Slug != genre.Slug {
+		m.db.rewriteMovieGenres(current.Slug, genre.Slug, userID)
+	}
+
+	return nil
+}
+
+// Merge() merges the source genre into the target genre in the same way as GenreModel.Merge(), and returns the updated target.
+func (m MemoryGenreModel) Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Genre, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	source, ok := m.db.genres[sourceID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	target, ok := m.db.genres[targetID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	target.Aliases = mergeGenreAliases(&target, &source)
+	target.Version++
+
+	m.db.genres[targetID] = target
+	delete(m.db.genres, sourceID)
+
+	m.db.rewriteMovieGenres(source.Slug, target.Slug, userID)
+
+	return m.db.genreWithCount(target), nil
+}
+
+// allGenres returns pointers to copies of every stored genre. The caller must hold the lock.
+func (db *memoryDB) allGenres() []*Genre {
+	genres := make([]*Genre, 0, len(db.genres))
+	for _, genre := range db.genres {
+		genre := genre
+		genres = append(genres, &genre)
+	}
+	return genres
+}
+
+// insertGenre assigns the system-generated values to a genre and stores a copy of it. The caller must hold the write lock.
+func (db *memoryDB) insertGenre(genre *Genre) {
+	db.lastGenreID++
+
+	genre.ID = db.lastGenreID
+	genre.CreatedAt = time.Now().Truncate(time.Second)
+	genre.Version = 1
+	genre.MovieCount = 0
+	if genre.Aliases == nil {
+		genre.Aliases = []string{}
+	}
+
+	stored := *genre
+	stored.Aliases = cloneStrings(genre.Aliases)
+	db.genres[genre.ID] = stored
+}
+
+// genreWithCount returns a copy of a genre with the number of movies in it (not counting those in the trash) filled in. The caller must hold the lock.
+func (db *memoryDB) genreWithCount(genre Genre) *Genre {
+	genre.Aliases = cloneStrings(genre.Aliases)
+	genre.MovieCount = 0
+	for _, movie := range db.movies {
+		if movie.DeletedAt == nil && validator.In(genre.Slug, movie.Genres...) {
+			genre.MovieCount++
+		}
+	}
+	return &genre
+}
+
+// rewriteMovieGenres replaces the genre slug from with to on every movie which has it, or removes it if the movie already has the genre to, incrementing
+// the version and recording a revision of each movie. The caller must hold the write lock.
+func (db *memoryDB) rewriteMovieGenres(from, to string, userID int64) {
+	for id, movie := range db.movies {
+		if !validator.In(from, movie.Genres...) {
+			continue
+		}
+
+		hasTarget := validator.In(to, movie.Genres...)
+
+		genres := []string{}
+		for _, genre := range movie.Genres {
+			switch {
+			case genre != from:
+				genres = append(genres, genre)
+			case !hasTarget:
+				genres = append(genres, to)
+			}
+		}
+
+		movie.Genres = genres
+		movie.Version++
+		db.movies[id] = movie
+
+		// Revisions dont record whether the movie is in the trash, in the same way as the movie_revisions table.
+		revision := movie
+		revision.DeletedAt = nil
+		db.addRevision(revision, RevisionUpdate, userID)
+	}
+}
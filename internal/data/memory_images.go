@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// The MemoryImageModel type stores the images of movies in memory. It honours the same contract as ImageModel.
+type MemoryImageModel struct {
+	db *memoryDB
+}
+
+// Insert() adds an image to a movie, replacing and returning the movie's existing poster if the image is a poster, in the same way as ImageModel.Insert().
+func (m MemoryImageModel) Insert(ctx context.Context, image *Image) (*Image, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.movieExists(image.MovieID) {
+		return nil, ErrRecordNotFound
+	}
+
+	var replaced *Image
+
+	switch image.Kind {
+	case ImagePoster:
+		replaced = m.db.moviePoster(image.MovieID)
+		if replaced != nil {
+			delete(m.db.images, replaced.ID)
+		}
+	case ImageStill:
+		if len(m.db.movieImages(image.MovieID, ImageStill)) >= MaxStills {
+			return nil, ErrImageLimit
+		}
+	}
+
+	m.db.lastImageID++
+
+	image.ID = m.db.lastImageID
+	image.CreatedAt = time.Now().Truncate(time.Second)
+	image.setURLs()
+
+	stored := *image
+	stored.ThumbnailWidths = append([]int32{}, image.ThumbnailWidths...)
+	m.db.images[image.ID] = stored
+
+	return replaced, nil
+}
+
+// GetAllForMovie() returns the images of a movie of the given kind, in the order they were added.
+func (m MemoryImageModel) GetAllForMovie(ctx context.Context, movieID int64, kind string) ([]*Image, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	return m.db.movieImages(movieID, kind), nil
+}
+
+// Delete() removes an image of the given kind from a movie and returns it, or returns ErrRecordNotFound.
+func (m MemoryImageModel) Delete(ctx context.Context, movieID, id int64, kind string) (*Image, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	image, ok := m.db.images[id]
+	if !ok || image.MovieID != movieID || image.Kind != kind {
+		return nil, ErrRecordNotFound
+	}
+
+	delete(m.db.images, id)
+
+	return copyImage(image), nil
+}
+
+// movieImages returns copies of the images of a movie of the given kind, ordered by id. The caller must hold the lock.
+func (db *memoryDB) movieImages(movieID int64, kind string) []*Image {
+	images := []*Image{}
+	for _, image := range db.images {
+		if image.MovieID == movieID && image.Kind == kind {
+			images = append(images, copyImage(image))
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].ID < images[j].ID
+	})
+
+	return images
+}
+
+// moviePoster returns a copy of the poster of a movie, or nil if it doesnt have one. The caller must hold the lock.
+func (db *memoryDB) moviePoster(movieID int64) *Image {
+	for _, image := range db.images {
+		if image.MovieID == movieID && image.Kind == ImagePoster {
+			return copyImage(image)
+		}
+	}
+	return nil
+}
+
+// copyImage returns a copy of a stored image with its URLs filled in.
+func copyImage(image Image) *Image {
+	image.ThumbnailWidths = append([]int32{}, image.ThumbnailWidths...)
+	image.setURLs()
+	return &image
+}
@@ -0,0 +1,436 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// listItemKey identifies an item in the memoryDB, mirroring the primary key on the list_items table.
+type listItemKey struct {
+	listID  int64
+	movieID int64
+}
+
+// A memoryListItem is the stored form of a list item. The movie is looked up when the item is read, so that changes to the movie are always reflected.
+type memoryListItem struct {
+	position  int32
+	addedAt   time.Time
+	watchedAt *time.Time
+}
+
+// The MemoryListModel type stores lists in memory. It honours the same contract as ListModel.
+type MemoryListModel struct {
+	db *memoryDB
+}
+
+// Insert() assigns the system-generated id, created_at and version values and the share slug to the list and stores a copy of it.
+func (m MemoryListModel) Insert(ctx context.Context, list *List) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	err := setShareSlug(list)
+	if err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	m.db.insertList(list)
+
+	return nil
+}
+
+// Get() returns a copy of the list with the given id if it belongs to the user, or ErrRecordNotFound.
+func (m MemoryListModel) Get(ctx context.Context, id, userID int64) (*List, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	list, ok := m.db.lists[id]
+	if !ok || list.UserID != userID {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.db.listWithCount(list), nil
+}
+
+// GetWatchlist() returns the user's watchlist, creating it if they dont have one yet.
+func (m MemoryListModel) GetWatchlist(ctx context.Context, userID int64) (*List, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, list := range m.db.lists {
+		if list.UserID == userID && list.Watchlist {
+			return m.db.listWithCount(list), nil
+		}
+	}
+
+	list := &List{UserID: userID, Name: "Watchlist", Watchlist: true}
+	m.db.insertList(list)
+
+	return list, nil
+}
+
+// GetShared() returns a copy of the public list with the given share slug, or ErrRecordNotFound.
+func (m MemoryListModel) GetShared(ctx context.Context, slug string) (*List, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, list := range m.db.lists {
+		if slug != "" && list.ShareSlug == slug && list.Public {
+			return m.db.listWithCount(list), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// GetAllForUser() sorts and paginates the user's lists in the same way as the SQL query in ListModel.GetAllForUser().
+func (m MemoryListModel) GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*List, Metadata, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+
+	m.db.mu.RLock()
+
+	lists := []*List{}
+	for _, list := range m.db.lists {
+		if list.UserID == userID {
+			lists = append(lists, m.db.listWithCount(list))
+		}
+	}
+
+	m.db.mu.RUnlock()
+
+	sort.Slice(lists, func(i, j int) bool {
+		a, b := lists[i], lists[j]
+
+		if a.Watchlist != b.Watchlist {
+			return a.Watchlist
+		}
+
+		var c int
+		switch column {
+		case "name":
+			c = strings.Compare(a.Name, b.Name)
+		case "created_at":
+			c = compareTimes(&a.CreatedAt, &b.CreatedAt)
+		default:
+			c = compareInt64(a.ID, b.ID)
+		}
+		if c == 0 {
+			return a.ID < b.ID
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	metadata := calculateMetadata(len(lists), filters.Page, filters.PageSize)
+
+	return paginate(lists, filters), metadata, nil
+}
+
+// Update() saves changes to the name and visibility of a list only if the stored version still matches the version on the struct, returning
+// ErrEditConflict otherwise.
+func (m MemoryListModel) Update(ctx context.Context, list *List) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	err := setShareSlug(list)
+	if err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored, ok := m.db.lists[list.ID]
+	if !ok || stored.UserID != list.UserID || stored.Version != list.Version {
+		return ErrEditConflict
+	}
+
+	stored.Name = list.Name
+	stored.Public = list.Public
+	stored.ShareSlug = list.ShareSlug
+	stored.Version++
+
+	m.db.lists[list.ID] = stored
+	list.Version = stored.Version
+
+	return nil
+}
+
+// Delete() removes a list belonging to the user along with its items, or returns ErrRecordNotFound.
+func (m MemoryListModel) Delete(ctx context.Context, id, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	list, ok := m.db.lists[id]
+	if !ok || list.UserID != userID {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.lists, id)
+
+	for key := range m.db.listItems {
+		if key.listID == id {
+			delete(m.db.listItems, key)
+		}
+	}
+
+	return nil
+}
+
+// GetItems() sorts and paginates the movies on a list in the same way as the SQL query in ListModel.GetItems(), leaving out movies which are in the trash.
+func (m MemoryListModel) GetItems(ctx context.Context, listID int64, filters Filters) ([]*ListItem, Metadata, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+
+	m.db.mu.RLock()
+
+	items := []*ListItem{}
+	for key, stored := range m.db.listItems {
+		if key.listID != listID || !m.db.movieExists(key.movieID) {
+			continue
+		}
+
+		items = append(items, m.db.listItem(key, stored))
+	}
+
+	m.db.mu.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+
+		var c int
+		switch column {
+		case "position":
+			c = compareInt64(int64(a.Position), int64(b.Position))
+		case "added_at":
+			c = compareTimes(&a.AddedAt, &b.AddedAt)
+		case "watched_at":
+			c = compareTimes(a.WatchedAt, b.WatchedAt)
+		default:
+			c = compareMovies(a.Movie, b.Movie, column)
+		}
+		if c == 0 {
+			return a.Position < b.Position
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	metadata := calculateMetadata(len(items), filters.Page, filters.PageSize)
+
+	return paginate(items, filters), metadata, nil
+}
+
+// GetItem() returns the item for a movie on a list, or ErrRecordNotFound if the movie isnt on the list or is in the trash.
+func (m MemoryListModel) GetItem(ctx context.Context, listID, movieID int64) (*ListItem, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	key := listItemKey{listID, movieID}
+
+	stored, ok := m.db.listItems[key]
+	if !ok || !m.db.movieExists(movieID) {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.db.listItem(key, stored), nil
+}
+
+// AddItem() adds the movie on the item to the end of a list, setting the position and added_at values on the struct.
+func (m MemoryListModel) AddItem(ctx context.Context, listID int64, item *ListItem) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.lists[listID]; !ok || !m.db.movieExists(item.Movie.ID) {
+		return ErrRecordNotFound
+	}
+
+	key := listItemKey{listID, item.Movie.ID}
+	if _, ok := m.db.listItems[key]; ok {
+		return ErrDuplicateListItem
+	}
+
+	item.Position = m.db.lastListPosition(listID) + 1
+	item.AddedAt = time.Now().Truncate(time.Second)
+
+	m.db.listItems[key] = memoryListItem{position: item.Position, addedAt: item.AddedAt}
+
+	return nil
+}
+
+// UpdateItem() moves a movie to a new position on a list, shifting the movies in between up or down by one, and saves the date it was watched.
+func (m MemoryListModel) UpdateItem(ctx context.Context, listID int64, item *ListItem) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	key := listItemKey{listID, item.Movie.ID}
+
+	stored, ok := m.db.listItems[key]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	if last := m.db.lastListPosition(listID); item.Position > last {
+		item.Position = last
+	}
+
+	current := stored.position
+	for k, other := range m.db.listItems {
+		if k.listID != listID || k == key {
+			continue
+		}
+
+		switch {
+		case current < item.Position && other.position > current && other.position <= item.Position:
+			other.position--
+		case current > item.Position && other.position >= item.Position && other.position < current:
+			other.position++
+		default:
+			continue
+		}
+		m.db.listItems[k] = other
+	}
+
+	stored.position = item.Position
+	stored.watchedAt = nil
+	if item.WatchedAt != nil {
+		watchedAt := *item.WatchedAt
+		stored.watchedAt = &watchedAt
+	}
+
+	m.db.listItems[key] = stored
+
+	return nil
+}
+
+// RemoveItem() removes a movie from a list and closes the gap it leaves in the positions, or returns ErrRecordNotFound.
+func (m MemoryListModel) RemoveItem(ctx context.Context, listID, movieID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.removeListItem(listItemKey{listID, movieID}) {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// removeListItem removes an item from a list and closes the gap it leaves in the positions, reporting whether the item was on the list. The caller must
+// hold the write lock.
+func (db *memoryDB) removeListItem(key listItemKey) bool {
+	stored, ok := db.listItems[key]
+	if !ok {
+		return false
+	}
+
+	delete(db.listItems, key)
+
+	for k, other := range db.listItems {
+		if k.listID == key.listID && other.position > stored.position {
+			other.position--
+			db.listItems[k] = other
+		}
+	}
+
+	return true
+}
+
+// insertList assigns the system-generated values to a list and stores a copy of it. The caller must hold the write lock.
+func (db *memoryDB) insertList(list *List) {
+	db.lastListID++
+
+	list.ID = db.lastListID
+	list.CreatedAt = time.Now().Truncate(time.Second)
+	list.Version = 1
+	list.ItemCount = 0
+
+	db.lists[list.ID] = *list
+}
+
+// listWithCount returns a copy of a list with its item count filled in, leaving out movies which are in the trash. The caller must hold the lock.
+func (db *memoryDB) listWithCount(list List) *List {
+	list.ItemCount = 0
+	for key := range db.listItems {
+		if key.listID == list.ID && db.movieExists(key.movieID) {
+			list.ItemCount++
+		}
+	}
+	return &list
+}
+
+// listItem builds a ListItem from a stored item and a copy of its movie. The caller must hold the lock.
+func (db *memoryDB) listItem(key listItemKey, stored memoryListItem) *ListItem {
+	movie := db.movies[key.movieID]
+	movie.Genres = cloneStrings(movie.Genres)
+	db.addMovieDetails(&movie)
+
+	item := &ListItem{Position: stored.position, AddedAt: stored.addedAt, Movie: &movie}
+	if stored.watchedAt != nil {
+		watchedAt := *stored.watchedAt
+		item.WatchedAt = &watchedAt
+	}
+
+	return item
+}
+
+// lastListPosition returns the highest position on a list, or 0 if it is empty. The caller must hold the lock.
+func (db *memoryDB) lastListPosition(listID int64) int32 {
+	var last int32
+	for key, stored := range db.listItems {
+		if key.listID == listID && stored.position > last {
+			last = stored.position
+		}
+	}
+	return last
+}
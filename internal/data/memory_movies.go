@@ -0,0 +1,559 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// The MemoryMovieModel type stores movies in memory. It honours the same contract as MovieModel, including the ErrRecordNotFound and ErrEditConflict errors.
+type MemoryMovieModel struct {
+	db *memoryDB
+}
+
+// Insert() assigns the system-generated id, created_at and version values to the movie and stores a copy of it, or returns ErrDuplicateExternalID.
+func (m MemoryMovieModel) Insert(ctx context.Context, movie *Movie, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.db.externalIDConflict(0, movie.ExternalIDs) {
+		return ErrDuplicateExternalID
+	}
+
+	m.db.insertMovie(movie)
+	m.db.setExternalIDs(movie.ID, movie.ExternalIDs)
+	m.db.setReleaseDates(movie.ID, movie.ReleaseDates)
+	m.db.addRevision(m.db.movies[movie.ID], RevisionCreate, userID)
+
+	return nil
+}
+
+// InsertMany() inserts a batch of movies in one go, so that no other operation sees a partially inserted batch. As with MovieModel.InsertMany(), the
+// external IDs and release dates of the movies arent stored.
+func (m MemoryMovieModel) InsertMany(ctx context.Context, movies []*Movie, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for _, movie := range movies {
+		m.db.insertMovie(movie)
+		m.db.addRevision(m.db.movies[movie.ID], RevisionCreate, userID)
+	}
+
+	return nil
+}
+
+// insertMovie stores a new movie. The caller must record its first revision once any external IDs and release dates are stored, and must hold the write
+// lock.
+func (db *memoryDB) insertMovie(movie *Movie) {
+	db.lastMovieID++
+
+	movie.ID = db.lastMovieID
+	movie.CreatedAt = time.Now().Truncate(time.Second)
+	movie.Version = 1
+	movie.DeletedAt = nil
+
+	stored := *movie
+	stored.Genres = cloneStrings(movie.Genres)
+	stored.Poster = nil
+	stored.ExternalIDs = nil
+	stored.ReleaseDates = nil
+	db.movies[movie.ID] = stored
+}
+
+// Get() returns a copy of the movie with the given id, or ErrRecordNotFound.
+func (m MemoryMovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	movie, ok := m.db.movies[id]
+	if !ok || movie.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	movie.Genres = cloneStrings(movie.Genres)
+	m.db.addMovieDetails(&movie)
+	return &movie, nil
+}
+
+// Update() saves the movie only if the stored version still matches the version on the movie struct, returning ErrEditConflict otherwise (including when
+// the movie has been deleted in the meantime). The external IDs and release dates are replaced unless they are nil, in the same way as MovieModel.Update().
+func (m MemoryMovieModel) Update(ctx context.Context, movie *Movie, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.movies[movie.ID]
+	if !ok || current.DeletedAt != nil || current.Version != movie.Version {
+		return ErrEditConflict
+	}
+
+	if m.db.externalIDConflict(movie.ID, movie.ExternalIDs) {
+		return ErrDuplicateExternalID
+	}
+
+	movie.Version++
+
+	// The rating aggregates are maintained by the MemoryRatingModel, so keep the current values rather than whatever the caller read earlier.
+	stored := *movie
+	stored.CreatedAt = current.CreatedAt
+	stored.Genres = cloneStrings(movie.Genres)
+	stored.DeletedAt = nil
+	stored.AverageRating = current.AverageRating
+	stored.RatingCount = current.RatingCount
+	stored.Poster = nil
+	stored.ExternalIDs = nil
+	stored.ReleaseDates = nil
+	m.db.movies[movie.ID] = stored
+	m.db.setExternalIDs(movie.ID, movie.ExternalIDs)
+	m.db.setReleaseDates(movie.ID, movie.ReleaseDates)
+	m.db.addRevision(stored, RevisionUpdate, userID)
+
+	return nil
+}
+
+// Delete() moves the movie with the given id to the trash, or returns ErrRecordNotFound.
+func (m MemoryMovieModel) Delete(ctx context.Context, id int64, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	movie, ok := m.db.movies[id]
+	if !ok || movie.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+
+	deletedAt := time.Now().Truncate(time.Second)
+	movie.DeletedAt = &deletedAt
+	m.db.movies[id] = movie
+	m.db.addRevision(movie, RevisionDelete, userID)
+	return nil
+}
+
+// GetAll() filters, sorts and paginates the stored movies in the same way as the SQL query in MovieModel.GetAll(), ordering them by the sort column with id
+// ASC as the tie-breaker. Like the SQL query, it picks out one row more than the page size, either from the page offset or from the cursor.
+func (m MemoryMovieModel) GetAll(ctx context.Context, movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Resolve the sort column up front, so that an unsafe sort value panics in exactly the same way as it would for the PostgreSQL model. As there,
+	// relevance is ordered best match first.
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+	if column == "relevance" {
+		descending = !descending
+	}
+
+	matches := m.db.matchMovies(movieFilters)
+
+	sortMovies(matches, column, descending)
+
+	totalRecords := len(matches)
+	if !filters.IncludeTotal {
+		totalRecords = -1
+	}
+
+	if filters.Cursor == "" {
+		page := window(matches, filters.offset(), filters.limit()+1)
+		m.db.attachMovieDetails(page)
+		return keysetMetadata(page, filters, totalRecords, movieID, func(movie *Movie) string {
+			return movieSortKey(movie, column)
+		})
+	}
+
+	position, err := filters.position()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	pivot, err := cursorMovie(position, column)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Find the first movie after the cursor. Going backwards, the movies before that one are taken in reverse order, as the SQL query does.
+	var page []*Movie
+	if position.Before {
+		i := sort.Search(len(matches), func(i int) bool {
+			return !movieLess(matches[i], pivot, column, descending)
+		})
+		for i--; i >= 0 && len(page) <= filters.limit(); i-- {
+			page = append(page, matches[i])
+		}
+	} else {
+		i := sort.Search(len(matches), func(i int) bool {
+			return movieLess(pivot, matches[i], column, descending)
+		})
+		page = window(matches, i, filters.limit()+1)
+	}
+
+	m.db.attachMovieDetails(page)
+	return keysetMetadata(page, filters, totalRecords, movieID, func(movie *Movie) string {
+		return movieSortKey(movie, column)
+	})
+}
+
+// Export() calls fn for every movie matching the filters, in id order. The matching movies are copied while holding the lock, and fn is
+// called after it has been released, so a slow consumer doesnt block writers.
+func (m MemoryMovieModel) Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	matches := m.db.matchMovies(movieFilters)
+
+	sortMovies(matches, "id", false)
+
+	for _, movie := range matches {
+		if err := memoryContextError(ctx); err != nil {
+			return err
+		}
+
+		err := fn(movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Facets() counts the movies matching the filters for each value of the named facets.
+func (m MemoryMovieModel) Facets(ctx context.Context, movieFilters MovieFilters, names []string) (Facets, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	return countFacets(m.db.matchMovies(movieFilters), names), nil
+}
+
+// matchMovies returns copies of the movies which arent in the trash and match the filters, in no particular order, with their relevance to the title
+// search set.
+func (db *memoryDB) matchMovies(f MovieFilters) []*Movie {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var credited map[int64]bool
+	if f.PersonID != 0 {
+		credited = db.creditedMovies(f.PersonID)
+	}
+
+	var translated map[int64][]string
+	if f.Title != "" {
+		translated = db.translatedTitles()
+	}
+
+	matches := []*Movie{}
+	for _, movie := range db.movies {
+		if movie.DeletedAt != nil {
+			continue
+		}
+		if credited != nil && !credited[movie.ID] {
+			continue
+		}
+		// As in movieFilterQuery(), the translated titles are searched as well, and the movie is ranked by its best matching title.
+		titles := append([]string{movie.Title}, translated[movie.ID]...)
+		matched, rank := false, 0.0
+		for _, title := range titles {
+			if matchTitle(title, f.Title, f.SearchMode) {
+				matched = true
+				if r := searchRank(title, f.Title, f.SearchMode); r > rank {
+					rank = r
+				}
+			}
+		}
+		if !matched {
+			continue
+		}
+		if !matchMovieFilters(&movie, f) {
+			continue
+		}
+		if !db.matchExternalIDs(movie.ID, f) {
+			continue
+		}
+		if !db.matchRelease(&movie, f) {
+			continue
+		}
+
+		movie := movie
+		movie.Genres = cloneStrings(movie.Genres)
+		if f.Title != "" {
+			// Keep the rank at the same precision as the PostgreSQL float4 ranks, so that it survives the round trip through a cursor.
+			movie.Relevance = float64(float32(rank))
+		}
+		matches = append(matches, &movie)
+	}
+
+	return matches
+}
+
+// matchMovieFilters checks a movie against the genre, range and creation time filters in the same way as the conditions built by movieFilterQuery().
+func matchMovieFilters(movie *Movie, f MovieFilters) bool {
+	switch {
+	case !containsAll(movie.Genres, f.Genres):
+		return false
+	case len(f.GenresAny) > 0 && !containsAny(movie.Genres, f.GenresAny):
+		return false
+	case containsAny(movie.Genres, f.ExcludeGenres):
+		return false
+	case f.YearMin != 0 && movie.Year < f.YearMin:
+		return false
+	case f.YearMax != 0 && movie.Year > f.YearMax:
+		return false
+	case f.RuntimeMin != 0 && movie.Runtime < f.RuntimeMin:
+		return false
+	case f.RuntimeMax != 0 && movie.Runtime > f.RuntimeMax:
+		return false
+	case !f.CreatedAfter.IsZero() && movie.CreatedAt.Before(f.CreatedAfter):
+		return false
+	case !f.CreatedBefore.IsZero() && !movie.CreatedAt.Before(f.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+// GetAllDeleted() returns a page of the movies which are in the trash.
+func (m MemoryMovieModel) GetAllDeleted(ctx context.Context, filters Filters) ([]*Movie, Metadata, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+
+	m.db.mu.RLock()
+
+	matches := []*Movie{}
+	for _, movie := range m.db.movies {
+		if movie.DeletedAt == nil {
+			continue
+		}
+
+		movie := movie
+		movie.Genres = cloneStrings(movie.Genres)
+		matches = append(matches, &movie)
+	}
+
+	m.db.mu.RUnlock()
+
+	sortMovies(matches, column, descending)
+
+	metadata := calculateMetadata(len(matches), filters.Page, filters.PageSize)
+
+	return paginate(matches, filters), metadata, nil
+}
+
+// Restore() takes a movie back out of the trash, creating a new version of it.
+func (m MemoryMovieModel) Restore(ctx context.Context, id int64, userID int64) (*Movie, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	movie, ok := m.db.movies[id]
+	if !ok || movie.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	movie.DeletedAt = nil
+	movie.Version++
+	m.db.movies[id] = movie
+	m.db.addRevision(movie, RevisionRestore, userID)
+
+	movie.Genres = cloneStrings(movie.Genres)
+	return &movie, nil
+}
+
+// Purge() permanently deletes a movie, whether or not it is in the trash.
+func (m MemoryMovieModel) Purge(ctx context.Context, id int64, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	movie, ok := m.db.movies[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	m.db.purgeMovie(movie, userID)
+
+	return nil
+}
+
+// PurgeDeleted() permanently deletes every movie which was moved to the trash before the given time, returning the ids of the movies purged.
+func (m MemoryMovieModel) PurgeDeleted(ctx context.Context, before time.Time) ([]int64, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	purged := []int64{}
+	for _, movie := range m.db.movies {
+		if movie.DeletedAt != nil && movie.DeletedAt.Before(before) {
+			m.db.purgeMovie(movie, 0)
+			purged = append(purged, movie.ID)
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeMovie removes a movie from the store and records a 'purge' revision. The caller must hold the write lock.
+func (db *memoryDB) purgeMovie(movie Movie, userID int64) {
+	movie.DeletedAt = nil
+	db.addRevision(movie, RevisionPurge, userID)
+	db.deleteMovie(movie.ID)
+}
+
+// deleteMovie removes a movie from the store along with its credits, ratings, list items, images, external IDs, release dates, translations and the
+// redirects to it, in the same way as the ON DELETE CASCADE on their tables. The caller must hold the write lock.
+func (db *memoryDB) deleteMovie(movieID int64) {
+	delete(db.movies, movieID)
+
+	for id, credit := range db.credits {
+		if credit.MovieID == movieID {
+			delete(db.credits, id)
+		}
+	}
+	for key := range db.ratings {
+		if key.movieID == movieID {
+			delete(db.ratings, key)
+		}
+	}
+	for key := range db.listItems {
+		if key.movieID == movieID {
+			delete(db.listItems, key)
+		}
+	}
+	for id, image := range db.images {
+		if image.MovieID == movieID {
+			delete(db.images, id)
+		}
+	}
+	delete(db.externalIDs, movieID)
+	delete(db.releaseDates, movieID)
+	for key := range db.translations {
+		if key.movieID == movieID {
+			delete(db.translations, key)
+		}
+	}
+	for from, to := range db.movieRedirects {
+		if to == movieID {
+			delete(db.movieRedirects, from)
+		}
+	}
+}
+
+// sortMovies orders movies on the given column, using the id as the tie-breaker in the same way as the ORDER BY clauses in the SQL queries.
+func sortMovies(movies []*Movie, column string, descending bool) {
+	sort.Slice(movies, func(i, j int) bool {
+		return movieLess(movies[i], movies[j], column, descending)
+	})
+}
+
+// movieLess reports whether movie a comes before movie b in the order used by sortMovies.
+func movieLess(a, b *Movie, column string, descending bool) bool {
+	c := compareMovies(a, b, column)
+	if c == 0 {
+		return a.ID < b.ID
+	}
+	if descending {
+		return c > 0
+	}
+	return c < 0
+}
+
+// compareMovies compares two movies on the given sort column, returning -1, 0 or +1.
+func compareMovies(a, b *Movie, column string) int {
+	switch column {
+	case "title":
+		switch {
+		case a.Title < b.Title:
+			return -1
+		case a.Title > b.Title:
+			return 1
+		}
+		return 0
+	case "year":
+		return compareInt64(int64(a.Year), int64(b.Year))
+	case "runtime":
+		return compareInt64(int64(a.Runtime), int64(b.Runtime))
+	case "deleted_at":
+		return compareTimes(a.DeletedAt, b.DeletedAt)
+	case "relevance":
+		return compareFloat64(a.Relevance, b.Relevance)
+	case "rating":
+		return compareFloat64(a.AverageRating, b.AverageRating)
+	default:
+		return compareInt64(a.ID, b.ID)
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareTimes compares two optional times, ordering a nil time before any other.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	}
+	return 0
+}
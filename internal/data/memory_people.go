@@ -0,0 +1,297 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The MemoryPersonModel type stores people in memory. It honours the same contract as PersonModel.
+type MemoryPersonModel struct {
+	db *memoryDB
+}
+
+// Insert() assigns the system-generated id, created_at and version values to the person and stores a copy of them.
+func (m MemoryPersonModel) Insert(ctx context.Context, person *Person) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	m.db.lastPersonID++
+
+	person.ID = m.db.lastPersonID
+	person.CreatedAt = time.Now().Truncate(time.Second)
+	person.Version = 1
+
+	m.db.people[person.ID] = *person
+
+	return nil
+}
+
+// Get() returns a copy of the person with the given id, or ErrRecordNotFound.
+func (m MemoryPersonModel) Get(ctx context.Context, id int64) (*Person, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	person, ok := m.db.people[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return &person, nil
+}
+
+// GetAll() filters, sorts and paginates the stored people in the same way as the SQL query in PersonModel.GetAll().
+func (m MemoryPersonModel) GetAll(ctx context.Context, name string, filters Filters) ([]*Person, Metadata, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+
+	nameTerms := searchTerms(name)
+
+	m.db.mu.RLock()
+
+	matches := []*Person{}
+	for _, person := range m.db.people {
+		if len(nameTerms) > 0 && !containsAll(searchTerms(person.Name), nameTerms) {
+			continue
+		}
+
+		person := person
+		matches = append(matches, &person)
+	}
+
+	m.db.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		var c int
+		switch column {
+		case "name":
+			c = strings.Compare(a.Name, b.Name)
+		case "birth_year":
+			c = compareInt64(int64(a.BirthYear), int64(b.BirthYear))
+		}
+		if c == 0 {
+			return a.ID < b.ID
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	metadata := calculateMetadata(len(matches), filters.Page, filters.PageSize)
+
+	return paginate(matches, filters), metadata, nil
+}
+
+// Update() saves the person only if the stored version still matches the version on the person struct, returning ErrEditConflict otherwise.
+func (m MemoryPersonModel) Update(ctx context.Context, person *Person) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.people[person.ID]
+	if !ok || current.Version != person.Version {
+		return ErrEditConflict
+	}
+
+	person.Version++
+
+	stored := *person
+	stored.CreatedAt = current.CreatedAt
+	m.db.people[person.ID] = stored
+
+	return nil
+}
+
+// Delete() removes a person along with all of their credits, or returns ErrRecordNotFound.
+func (m MemoryPersonModel) Delete(ctx context.Context, id int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.people[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.people, id)
+
+	for creditID, credit := range m.db.credits {
+		if credit.PersonID == id {
+			delete(m.db.credits, creditID)
+		}
+	}
+
+	return nil
+}
+
+// The MemoryCreditModel type stores credits in memory. It honours the same contract as CreditModel.
+type MemoryCreditModel struct {
+	db *memoryDB
+}
+
+// Insert() adds a credit, setting its id and the name of the person.
+func (m MemoryCreditModel) Insert(ctx context.Context, credit *Credit) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	movie, ok := m.db.movies[credit.MovieID]
+	if !ok || movie.DeletedAt != nil {
+		return ErrRecordNotFound
+	}
+	person, ok := m.db.people[credit.PersonID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	if m.db.hasCredit(credit.MovieID, *credit) {
+		return ErrDuplicateCredit
+	}
+
+	m.db.lastCreditID++
+
+	credit.ID = m.db.lastCreditID
+	credit.PersonName = person.Name
+
+	m.db.credits[credit.ID] = Credit{
+		ID:        credit.ID,
+		MovieID:   credit.MovieID,
+		PersonID:  credit.PersonID,
+		Role:      credit.Role,
+		Character: credit.Character,
+	}
+
+	return nil
+}
+
+// Delete() removes a credit from a movie, or returns ErrRecordNotFound.
+func (m MemoryCreditModel) Delete(ctx context.Context, movieID, creditID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	credit, ok := m.db.credits[creditID]
+	if !ok || credit.MovieID != movieID {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.credits, creditID)
+
+	return nil
+}
+
+// GetAllForMovie() returns the credits of a movie, in the same order as CreditModel.GetAllForMovie().
+func (m MemoryCreditModel) GetAllForMovie(ctx context.Context, movieID int64) ([]*Credit, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+
+	credits := []*Credit{}
+	for _, credit := range m.db.credits {
+		if credit.MovieID != movieID {
+			continue
+		}
+
+		credit := credit
+		credit.PersonName = m.db.people[credit.PersonID].Name
+		credits = append(credits, &credit)
+	}
+
+	m.db.mu.RUnlock()
+
+	sort.Slice(credits, func(i, j int) bool {
+		a, b := credits[i], credits[j]
+
+		if (a.Role == CreditDirector) != (b.Role == CreditDirector) {
+			return a.Role == CreditDirector
+		}
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return a.ID < b.ID
+	})
+
+	return credits, nil
+}
+
+// GetAllForPerson() returns the filmography of a person, in the same order as CreditModel.GetAllForPerson().
+func (m MemoryCreditModel) GetAllForPerson(ctx context.Context, personID int64) ([]*Credit, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+
+	credits := []*Credit{}
+	for _, credit := range m.db.credits {
+		if credit.PersonID != personID {
+			continue
+		}
+
+		movie := m.db.movies[credit.MovieID]
+		if movie.DeletedAt != nil {
+			continue
+		}
+
+		credit := credit
+		credit.MovieTitle = movie.Title
+		credit.MovieYear = movie.Year
+		credits = append(credits, &credit)
+	}
+
+	m.db.mu.RUnlock()
+
+	sort.Slice(credits, func(i, j int) bool {
+		a, b := credits[i], credits[j]
+
+		switch {
+		case a.MovieYear != b.MovieYear:
+			return a.MovieYear > b.MovieYear
+		case a.MovieID != b.MovieID:
+			return a.MovieID > b.MovieID
+		}
+		return a.ID < b.ID
+	})
+
+	return credits, nil
+}
+
+// creditedMovies returns the ids of the movies which a person is credited on. The caller must hold the lock.
+func (db *memoryDB) creditedMovies(personID int64) map[int64]bool {
+	ids := map[int64]bool{}
+	for _, credit := range db.credits {
+		if credit.PersonID == personID {
+			ids[credit.MovieID] = true
+		}
+	}
+	return ids
+}
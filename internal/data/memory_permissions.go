@@ -0,0 +1,54 @@
+package data
+
+import (
+	"context"
+	"fmt"
+)
+
+// The MemoryPermissionModel type stores the permissions granted to each user in memory.
+type MemoryPermissionModel struct {
+	db *memoryDB
+}
+
+// GetAllForUser() returns a copy of the permission codes granted to the user.
+func (m MemoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	return Permissions(cloneStrings(m.db.userPermissions[userID])), nil
+}
+
+// AddForUser() grants the given permission codes to the user. As with the SQL version, unknown codes are silently ignored, while granting a permission that the
+// user already holds (which would violate the users_permissions primary key) is an error.
+func (m MemoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[userID]; !ok {
+		return fmt.Errorf("user %d does not exist", userID)
+	}
+
+	permissions := m.db.userPermissions[userID]
+
+	for _, code := range m.db.permissionCodes {
+		if !containsAll(codes, []string{code}) {
+			continue
+		}
+		if permissions.Include(code) {
+			return fmt.Errorf("user %d already has permission %q", userID, code)
+		}
+		permissions = append(permissions, code)
+	}
+
+	m.db.userPermissions[userID] = permissions
+
+	return nil
+}
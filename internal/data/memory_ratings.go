@@ -0,0 +1,180 @@
+package data
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// ratingKey identifies a rating in the memoryDB, mirroring the primary key on the ratings table.
+type ratingKey struct {
+	movieID int64
+	userID  int64
+}
+
+// The MemoryRatingModel type stores ratings in memory. It honours the same contract as RatingModel, and as every change is made while holding the write
+// lock, the aggregate scores on the movie are always consistent with its ratings.
+type MemoryRatingModel struct {
+	db *memoryDB
+}
+
+// Insert() adds a user's rating of a movie and updates the movie's aggregate scores.
+func (m MemoryRatingModel) Insert(ctx context.Context, rating *Rating) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.movieExists(rating.MovieID) {
+		return ErrRecordNotFound
+	}
+
+	key := ratingKey{rating.MovieID, rating.UserID}
+	if _, ok := m.db.ratings[key]; ok {
+		return ErrDuplicateRating
+	}
+
+	rating.CreatedAt = time.Now().Truncate(time.Second)
+	rating.UpdatedAt = rating.CreatedAt
+
+	m.db.ratings[key] = *rating
+	m.db.updateRatingAggregates(rating.MovieID)
+
+	return nil
+}
+
+// Update() replaces a user's rating and review of a movie and updates the movie's aggregate scores.
+func (m MemoryRatingModel) Update(ctx context.Context, rating *Rating) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.movieExists(rating.MovieID) {
+		return ErrRecordNotFound
+	}
+
+	key := ratingKey{rating.MovieID, rating.UserID}
+	current, ok := m.db.ratings[key]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	rating.CreatedAt = current.CreatedAt
+	rating.UpdatedAt = time.Now().Truncate(time.Second)
+
+	m.db.ratings[key] = *rating
+	m.db.updateRatingAggregates(rating.MovieID)
+
+	return nil
+}
+
+// Delete() removes a user's rating of a movie and updates the movie's aggregate scores.
+func (m MemoryRatingModel) Delete(ctx context.Context, movieID, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.movieExists(movieID) {
+		return ErrRecordNotFound
+	}
+
+	key := ratingKey{movieID, userID}
+	if _, ok := m.db.ratings[key]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.ratings, key)
+	m.db.updateRatingAggregates(movieID)
+
+	return nil
+}
+
+// GetReviews() returns a page of the ratings of a movie which include a written review, along with the names of the users who wrote them.
+func (m MemoryRatingModel) GetReviews(ctx context.Context, movieID int64, filters Filters) ([]*Rating, Metadata, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	column := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+
+	m.db.mu.RLock()
+
+	reviews := []*Rating{}
+	for key, rating := range m.db.ratings {
+		if key.movieID != movieID || rating.Review == "" {
+			continue
+		}
+
+		rating := rating
+		rating.UserName = m.db.users[rating.UserID].Name
+		reviews = append(reviews, &rating)
+	}
+
+	m.db.mu.RUnlock()
+
+	sort.Slice(reviews, func(i, j int) bool {
+		a, b := reviews[i], reviews[j]
+
+		var c int
+		switch column {
+		case "rating":
+			c = compareInt64(int64(a.Rating), int64(b.Rating))
+		case "created_at":
+			c = compareTimes(&a.CreatedAt, &b.CreatedAt)
+		case "updated_at":
+			c = compareTimes(&a.UpdatedAt, &b.UpdatedAt)
+		}
+		if c == 0 {
+			return a.UserID < b.UserID
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	metadata := calculateMetadata(len(reviews), filters.Page, filters.PageSize)
+
+	return paginate(reviews, filters), metadata, nil
+}
+
+// movieExists reports whether there is a movie with the given id which isnt in the trash. The caller must hold the lock.
+func (db *memoryDB) movieExists(id int64) bool {
+	movie, ok := db.movies[id]
+	return ok && movie.DeletedAt == nil
+}
+
+// updateRatingAggregates recalculates the rating count and average rating of a movie from its ratings. The average is rounded to two decimal places, like
+// the numeric(4, 2) column in PostgreSQL. The caller must hold the write lock.
+func (db *memoryDB) updateRatingAggregates(movieID int64) {
+	movie, ok := db.movies[movieID]
+	if !ok {
+		return
+	}
+
+	var count, sum int64
+	for key, rating := range db.ratings {
+		if key.movieID == movieID {
+			count++
+			sum += int64(rating.Rating)
+		}
+	}
+
+	movie.RatingCount = int32(count)
+	movie.AverageRating = 0
+	if count > 0 {
+		movie.AverageRating = math.Round(float64(sum)*100/float64(count)) / 100
+	}
+
+	db.movies[movieID] = movie
+}
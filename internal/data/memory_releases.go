@@ -0,0 +1,54 @@
+package data
+
+// setReleaseDates replaces the release dates of a movie with a copy of dates, unless dates is nil. The caller must hold the write lock.
+func (db *memoryDB) setReleaseDates(movieID int64, dates ReleaseDates) {
+	if dates == nil {
+		return
+	}
+
+	if len(dates) == 0 {
+		delete(db.releaseDates, movieID)
+		return
+	}
+
+	db.releaseDates[movieID] = cloneReleaseDates(dates)
+}
+
+// matchRelease checks a movie against the status and release date filters in the same way as the conditions built by movieFilterQuery(). The caller must
+// hold the lock.
+func (db *memoryDB) matchRelease(movie *Movie, f MovieFilters) bool {
+	if len(f.Statuses) > 0 && !containsAll(expandStatuses(f.Statuses), []string{movie.Status}) {
+		return false
+	}
+
+	if f.ReleasedFrom.IsZero() && f.ReleasedTo.IsZero() && f.ReleaseRegion == "" {
+		return true
+	}
+
+	for region, s := range db.releaseDates[movie.ID] {
+		date, err := ParseDate(s)
+		switch {
+		case err != nil:
+		case !f.ReleasedFrom.IsZero() && date.Before(f.ReleasedFrom):
+		case !f.ReleasedTo.IsZero() && date.After(f.ReleasedTo):
+		case f.ReleaseRegion != "" && region != f.ReleaseRegion:
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// cloneReleaseDates returns a copy of a set of release dates, or nil if it is empty.
+func cloneReleaseDates(dates ReleaseDates) ReleaseDates {
+	if len(dates) == 0 {
+		return nil
+	}
+
+	clone := make(ReleaseDates, len(dates))
+	for region, date := range dates {
+		clone[region] = date
+	}
+	return clone
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// The MemoryMovieRevisionModel type reads the movie revisions which the MemoryMovieModel records.
+type MemoryMovieRevisionModel struct {
+	db *memoryDB
+}
+
+// addRevision records the current state of a movie, along with its current external IDs and release dates. The caller must hold the write lock.
+func (db *memoryDB) addRevision(movie Movie, action string, userID int64) {
+	// Revisions only hold the data which can be edited, in the same way as the movie_revisions table.
+	movie.Genres = cloneStrings(movie.Genres)
+	movie.AverageRating = 0
+	movie.RatingCount = 0
+	movie.ExternalIDs = cloneRevisionMap(db.externalIDs[movie.ID])
+	movie.ReleaseDates = cloneRevisionMap(db.releaseDates[movie.ID])
+
+	db.movieRevisions = append(db.movieRevisions, MovieRevision{
+		MovieID:   movie.ID,
+		Version:   movie.Version,
+		Action:    action,
+		UserID:    userID,
+		CreatedAt: time.Now().Truncate(time.Second),
+		Movie:     movie,
+	})
+}
+
+// GetAllForMovie() returns a page of revisions for a movie, newest first.
+func (m MemoryMovieRevisionModel) GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.db.mu.RLock()
+
+	revisions := []*MovieRevision{}
+	for i := len(m.db.movieRevisions) - 1; i >= 0; i-- {
+		revision := m.db.movieRevisions[i]
+		if revision.MovieID != movieID {
+			continue
+		}
+
+		revisions = append(revisions, cloneRevision(revision))
+	}
+
+	m.db.mu.RUnlock()
+
+	totalRecords := len(revisions)
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return paginate(revisions, filters), metadata, nil
+}
+
+// Get() returns the revision which holds the state of a movie at a specific version, or ErrRecordNotFound.
+func (m MemoryMovieRevisionModel) Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, revision := range m.db.movieRevisions {
+		if revision.MovieID == movieID && revision.Version == version && revision.Action != RevisionDelete && revision.Action != RevisionPurge {
+			return cloneRevision(revision), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// cloneRevision returns a copy of a revision which shares no slices or maps with the stored one.
+func cloneRevision(revision MovieRevision) *MovieRevision {
+	revision.Movie.Genres = cloneStrings(revision.Movie.Genres)
+	revision.Movie.ExternalIDs = cloneRevisionMap(revision.Movie.ExternalIDs)
+	revision.Movie.ReleaseDates = cloneRevisionMap(revision.Movie.ReleaseDates)
+	return &revision
+}
+
+// cloneRevisionMap returns a copy of the external IDs or release dates of a movie for a revision. Unlike cloneExternalIDs() and cloneReleaseDates(), it
+// returns an empty map rather than nil when there are none, as a nil map in a revision means that they werent recorded.
+func cloneRevisionMap[M ~map[string]string](values M) M {
+	clone := make(M, len(values))
+	for key, value := range values {
+		clone[key] = value
+	}
+	return clone
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// The MemoryTokenModel type stores activation and authentication tokens in memory.
+type MemoryTokenModel struct {
+	db *memoryDB
+}
+
+// New() generates a new token for the user and stores it.
+func (m MemoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+// Insert() stores the token, keyed by its hash. Expired tokens are never returned by GetForToken(), so there is no need to remove them here.
+func (m MemoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	stored := *token
+	stored.Plaintext = ""
+	stored.Expiry = token.Expiry.Truncate(time.Second)
+	m.db.tokens[string(token.Hash)] = stored
+
+	return nil
+}
+
+// DeleteAllForUser() deletes all tokens for a specific user and scope.
+func (m MemoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	for hash, token := range m.db.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.db.tokens, hash)
+		}
+	}
+
+	return nil
+}
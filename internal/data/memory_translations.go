@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"sort"
+)
+
+// translationKey identifies a translation in the memoryDB, mirroring the primary key on the movie_translations table.
+type translationKey struct {
+	movieID  int64
+	language string
+}
+
+// The MemoryTranslationModel type stores the translations of movies in memory. It honours the same contract as TranslationModel.
+type MemoryTranslationModel struct {
+	db *memoryDB
+}
+
+// Put() adds or replaces the translation of a movie into a language.
+func (m MemoryTranslationModel) Put(ctx context.Context, translation *Translation) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if !m.db.movieExists(translation.MovieID) {
+		return ErrRecordNotFound
+	}
+
+	m.db.translations[translationKey{translation.MovieID, translation.Language}] = *translation
+
+	return nil
+}
+
+// GetAllForMovies() returns the translations of each of the movies, keyed by movie id and ordered by language.
+func (m MemoryTranslationModel) GetAllForMovies(ctx context.Context, movieIDs []int64) (map[int64][]*Translation, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	wanted := make(map[int64]bool)
+	for _, id := range movieIDs {
+		wanted[id] = true
+	}
+
+	translations := make(map[int64][]*Translation)
+	for key, translation := range m.db.translations {
+		if wanted[key.movieID] {
+			translation := translation
+			translations[key.movieID] = append(translations[key.movieID], &translation)
+		}
+	}
+
+	for _, list := range translations {
+		list := list
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Language < list[j].Language
+		})
+	}
+
+	return translations, nil
+}
+
+// Delete() removes the translation of a movie into a language, or returns ErrRecordNotFound.
+func (m MemoryTranslationModel) Delete(ctx context.Context, movieID int64, language string) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	key := translationKey{movieID, language}
+
+	if _, ok := m.db.translations[key]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.db.translations, key)
+
+	return nil
+}
+
+// translatedTitles returns the translated titles of every movie which has any, keyed by movie id. The caller must hold the lock.
+func (db *memoryDB) translatedTitles() map[int64][]string {
+	titles := make(map[int64][]string)
+	for key, translation := range db.translations {
+		titles[key.movieID] = append(titles[key.movieID], translation.Title)
+	}
+	return titles
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+)
+
+// withTx runs fn as a transaction for Models.WithTx(). The in-memory models take the lock for each operation rather than for the whole transaction, so
+// transactions are run one at a time and, if fn fails, the store is put back the way it was before fn ran. Unlike with PostgreSQL, other operations can see
+// the changes before the transaction finishes, and any changes that they make while a failed transaction is running are undone along with it. That is
+// good enough for the tests and local development that the in-memory store is used for.
+func (db *memoryDB) withTx(ctx context.Context, fn func() error) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	db.mu.RLock()
+	saved := db.snapshot()
+	db.mu.RUnlock()
+
+	err := fn()
+	if err != nil {
+		db.mu.Lock()
+		db.restore(saved)
+		db.mu.Unlock()
+	}
+
+	return err
+}
+
+// snapshot returns a copy of the contents of the store, for restore() to put back. Any table added to the memoryDB must be added here and to restore()
+// too. The caller must hold the lock.
+func (db *memoryDB) snapshot() *memoryDB {
+	saved := &memoryDB{
+		movies:          cloneMap(db.movies),
+		lastMovieID:     db.lastMovieID,
+		movieRevisions:  db.movieRevisions,
+		people:          cloneMap(db.people),
+		lastPersonID:    db.lastPersonID,
+		credits:         cloneMap(db.credits),
+		lastCreditID:    db.lastCreditID,
+		ratings:         cloneMap(db.ratings),
+		lists:           cloneMap(db.lists),
+		lastListID:      db.lastListID,
+		listItems:       cloneMap(db.listItems),
+		genres:          cloneMap(db.genres),
+		lastGenreID:     db.lastGenreID,
+		images:          cloneMap(db.images),
+		lastImageID:     db.lastImageID,
+		externalIDs:     make(map[int64]ExternalIDs, len(db.externalIDs)),
+		releaseDates:    make(map[int64]ReleaseDates, len(db.releaseDates)),
+		translations:    cloneMap(db.translations),
+		movieRedirects:  cloneMap(db.movieRedirects),
+		users:           cloneMap(db.users),
+		lastUserID:      db.lastUserID,
+		tokens:          cloneMap(db.tokens),
+		permissionCodes: cloneStrings(db.permissionCodes),
+		userPermissions: cloneMap(db.userPermissions),
+	}
+
+	// The external IDs of a movie are changed in place when movies are merged, so they are copied too. The revisions are only ever appended to, so keeping
+	// the slice is enough.
+	for movieID, ids := range db.externalIDs {
+		saved.externalIDs[movieID] = cloneExternalIDs(ids)
+	}
+	for movieID, dates := range db.releaseDates {
+		saved.releaseDates[movieID] = cloneReleaseDates(dates)
+	}
+
+	return saved
+}
+
+// restore puts back the contents of the store saved by snapshot(). The caller must hold the write lock.
+func (db *memoryDB) restore(saved *memoryDB) {
+	db.movies, db.lastMovieID = saved.movies, saved.lastMovieID
+	db.movieRevisions = saved.movieRevisions
+	db.people, db.lastPersonID = saved.people, saved.lastPersonID
+	db.credits, db.lastCreditID = saved.credits, saved.lastCreditID
+	db.ratings = saved.ratings
+	db.lists, db.lastListID, db.listItems = saved.lists, saved.lastListID, saved.listItems
+	db.genres, db.lastGenreID = saved.genres, saved.lastGenreID
+	db.images, db.lastImageID = saved.images, saved.lastImageID
+	db.externalIDs = saved.externalIDs
+	db.releaseDates = saved.releaseDates
+	db.translations = saved.translations
+	db.movieRedirects = saved.movieRedirects
+	db.users, db.lastUserID = saved.users, saved.lastUserID
+	db.tokens = saved.tokens
+	db.permissionCodes, db.userPermissions = saved.permissionCodes, saved.userPermissions
+}
+
+// cloneMap returns a shallow copy of a map.
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	clone := make(map[K]V, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"time"
+)
+
+// The MemoryUserModel type stores user accounts in memory. Email addresses are compared case-insensitively, just like the citext column in PostgreSQL.
+type MemoryUserModel struct {
+	db *memoryDB
+}
+
+// emailTaken reports whether a user other than the one with the given id already has the email address. The caller must hold the lock.
+func (m MemoryUserModel) emailTaken(email string, id int64) bool {
+	for _, user := range m.db.users {
+		if user.ID != id && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// Insert() stores a new user, returning ErrDuplicateEmail if the email address is already in use.
+func (m MemoryUserModel) Insert(ctx context.Context, user *User) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	m.db.lastUserID++
+
+	user.ID = m.db.lastUserID
+	user.CreatedAt = time.Now().Truncate(time.Second)
+	user.Version = 1
+
+	m.db.users[user.ID] = *user
+
+	return nil
+}
+
+// GetByEmail() returns the user with the given email address, or ErrRecordNotFound.
+func (m MemoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	for _, user := range m.db.users {
+		if strings.EqualFold(user.Email, email) {
+			user.Password.plaintext = nil
+			return &user, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// Update() saves the user if the version matches, returning ErrEditConflict or ErrDuplicateEmail in the same circumstances as UserModel.Update().
+func (m MemoryUserModel) Update(ctx context.Context, user *User) error {
+	if err := memoryContextError(ctx); err != nil {
+		return err
+	}
+
+	m.db.mu.Lock()
+	defer m.db.mu.Unlock()
+
+	if m.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	current, ok := m.db.users[user.ID]
+	if !ok || current.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	user.Version++
+
+	stored := *user
+	stored.CreatedAt = current.CreatedAt
+	m.db.users[user.ID] = stored
+
+	return nil
+}
+
+// GetForToken() returns the user who owns an unexpired token with the given scope and plaintext, or ErrRecordNotFound.
+func (m MemoryUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	if err := memoryContextError(ctx); err != nil {
+		return nil, err
+	}
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	token, ok := m.db.tokens[string(tokenHash[:])]
+	if !ok || token.Scope != tokenScope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := m.db.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	user.Password.plaintext = nil
+	user.tokenExpiry = token.Expiry
+	return &user, nil
+}
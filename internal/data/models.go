@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 //Define a  custom ErrRecordNotFound error. We'll return this from our Get() method when looking up a movie that doesnt exist in our database.
@@ -10,39 +12,236 @@ import (
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
+
+	// ErrCanceled is returned when a query is abandoned because the caller's context was cancelled (for example, because the client disconnected). It is
+	// distinct from a query timing out, which is still reported as an ordinary error.
+	ErrCanceled = errors.New("query canceled")
 )
 
-// Create a Models struct which wraps the MovieModel. We'll add other models to this like a UserModel and PermissionModel, as our build progresses.
+// The QueryTimeouts struct holds the maximum duration of a single query for each model. A zero or negative value means that the query is only bounded by the
+// caller's context. The Movies timeout also applies to the catalogue data that hangs off movies, like revisions, people, credits, ratings, lists, genres,
+// images and translations.
+type QueryTimeouts struct {
+	Movies      time.Duration
+	Permissions time.Duration
+	Tokens      time.Duration
+	Users       time.Duration
+}
+
+// withTimeout derives a context from the caller's context which carries the given timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextError replaces err with ErrCanceled when the query failed because ctx was cancelled. Note that a context which has passed its deadline reports
+// context.DeadlineExceeded rather than context.Canceled, so timeouts are left as they are.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return ErrCanceled
+	}
+	return err
+}
+
+// The MovieModelInterface describes the behaviour that every movie storage backend must provide. Both the PostgreSQL MovieModel and the in-memory
+// MemoryMovieModel satisfy it, which means that our handlers never need to know which one they are talking to.
+type MovieModelInterface interface {
+	Insert(ctx context.Context, movie *Movie, userID int64) error
+	InsertMany(ctx context.Context, movies []*Movie, userID int64) error
+	Get(ctx context.Context, id int64) (*Movie, error)
+	GetByExternalID(ctx context.Context, source, externalID string) (*Movie, error)
+	GetAll(ctx context.Context, movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error)
+	Update(ctx context.Context, movie *Movie, userID int64) error
+	Delete(ctx context.Context, id int64, userID int64) error
+	Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error
+	Facets(ctx context.Context, movieFilters MovieFilters, names []string) (Facets, error)
+	GetAllDeleted(ctx context.Context, filters Filters) ([]*Movie, Metadata, error)
+	Restore(ctx context.Context, id int64, userID int64) (*Movie, error)
+	Purge(ctx context.Context, id int64, userID int64) error
+	PurgeDeleted(ctx context.Context, before time.Time) ([]int64, error)
+	FindDuplicates(ctx context.Context, movie *Movie, match string) ([]int64, error)
+	Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Movie, error)
+	GetMergedInto(ctx context.Context, id int64) (int64, error)
+}
+
+// The MovieRevisionModelInterface describes the methods for reading the revision history which is recorded on every movie insert, update and delete.
+type MovieRevisionModelInterface interface {
+	GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error)
+	Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error)
+}
+
+// The PersonModelInterface describes the methods for managing the people who are credited on movies.
+type PersonModelInterface interface {
+	Insert(ctx context.Context, person *Person) error
+	Get(ctx context.Context, id int64) (*Person, error)
+	GetAll(ctx context.Context, name string, filters Filters) ([]*Person, Metadata, error)
+	Update(ctx context.Context, person *Person) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// The CreditModelInterface describes the methods for managing the credits which link people to movies.
+type CreditModelInterface interface {
+	Insert(ctx context.Context, credit *Credit) error
+	Delete(ctx context.Context, movieID, creditID int64) error
+	GetAllForMovie(ctx context.Context, movieID int64) ([]*Credit, error)
+	GetAllForPerson(ctx context.Context, personID int64) ([]*Credit, error)
+}
+
+// The RatingModelInterface describes the methods for managing users' ratings and reviews of movies. Every change to a rating also updates the aggregate
+// scores on the movie.
+type RatingModelInterface interface {
+	Insert(ctx context.Context, rating *Rating) error
+	Update(ctx context.Context, rating *Rating) error
+	Delete(ctx context.Context, movieID, userID int64) error
+	GetReviews(ctx context.Context, movieID int64, filters Filters) ([]*Rating, Metadata, error)
+}
+
+// The ListModelInterface describes the methods for managing users' watchlists and custom lists. Only the methods which look up a list check who owns it,
+// so handlers must read the list through one of them before changing its items.
+type ListModelInterface interface {
+	Insert(ctx context.Context, list *List) error
+	Get(ctx context.Context, id, userID int64) (*List, error)
+	GetWatchlist(ctx context.Context, userID int64) (*List, error)
+	GetShared(ctx context.Context, slug string) (*List, error)
+	GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*List, Metadata, error)
+	Update(ctx context.Context, list *List) error
+	Delete(ctx context.Context, id, userID int64) error
+	GetItems(ctx context.Context, listID int64, filters Filters) ([]*ListItem, Metadata, error)
+	GetItem(ctx context.Context, listID, movieID int64) (*ListItem, error)
+	AddItem(ctx context.Context, listID int64, item *ListItem) error
+	UpdateItem(ctx context.Context, listID int64, item *ListItem) error
+	RemoveItem(ctx context.Context, listID, movieID int64) error
+}
+
+// The GenreModelInterface describes the methods for managing the genre vocabulary. Changing the slug of a genre or merging it into another rewrites the
+// movies in that genre.
+type GenreModelInterface interface {
+	Insert(ctx context.Context, genre *Genre) error
+	Get(ctx context.Context, id int64) (*Genre, error)
+	GetAll(ctx context.Context) ([]*Genre, error)
+	Update(ctx context.Context, genre *Genre, userID int64) error
+	Merge(ctx context.Context, sourceID, targetID int64, userID int64) (*Genre, error)
+}
+
+// The ImageModelInterface describes the methods for managing the posters and stills of movies. The image files themselves are kept in a blob store, so
+// the methods which remove images return them, for the caller to delete their blobs.
+type ImageModelInterface interface {
+	Insert(ctx context.Context, image *Image) (*Image, error)
+	GetAllForMovie(ctx context.Context, movieID int64, kind string) ([]*Image, error)
+	Delete(ctx context.Context, movieID, id int64, kind string) (*Image, error)
+}
+
+// The TranslationModelInterface describes the methods for managing the titles and synopses of movies in other languages.
+type TranslationModelInterface interface {
+	Put(ctx context.Context, translation *Translation) error
+	GetAllForMovies(ctx context.Context, movieIDs []int64) (map[int64][]*Translation, error)
+	Delete(ctx context.Context, movieID int64, language string) error
+}
+
+// The PermissionModelInterface describes the methods for reading and granting user permissions.
+type PermissionModelInterface interface {
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+// The TokenModelInterface describes the methods for creating and removing activation and authentication tokens.
+type TokenModelInterface interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+}
+
+// The UserModelInterface describes the methods for creating, looking up and updating user accounts.
+type UserModelInterface interface {
+	Insert(ctx context.Context, user *User) error
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+}
+
+// Create a Models struct which wraps our models. Each field is an interface rather than a concrete type, so that the same Models value can be backed by
+// PostgreSQL or by the in-memory implementation.
 
 type Models struct {
-	/*Movies interface {
-	    Insert(movie *Movie) error
-	    Get(id int64) (*Movie, error)
-	    GetAll(title string, genres []string, filters Filters) ([]*Movie,Metadata, error)
-	    Update(movie *Movie) error
-	    Delete(id int64) error
-	} */
-	Movies      MovieModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	Movies         MovieModelInterface
+	MovieRevisions MovieRevisionModelInterface
+	People         PersonModelInterface
+	Credits        CreditModelInterface
+	Ratings        RatingModelInterface
+	Lists          ListModelInterface
+	Genres         GenreModelInterface
+	Images         ImageModelInterface
+	Translations   TranslationModelInterface
+	Permissions    PermissionModelInterface
+	Tokens         TokenModelInterface
+	Users          UserModelInterface
+
+	// db and timeouts are what the PostgreSQL models were created with, memory is the store behind the in-memory models and cache is the Cache that
+	// wraps the models, if any. WithTx() uses them to start transactions, and sets inTx on the models that it passes to its function.
+	db       *sql.DB
+	timeouts QueryTimeouts
+	memory   *memoryDB
+	cache    *Cache
+	inTx     bool
 }
 
 //For ease of use, we also add a New() method which returns a Models struct conaining the initialized MovieModel.
-//Create a helper function which returns a Model instance containing the mock models only
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, replicas *ReplicaSet, timeouts QueryTimeouts) Models {
+	var reads DBTX = db
+	if replicas != nil {
+		reads = replicas
+	}
+
+	models := newModels(db, reads, timeouts)
+	models.db = db
+	return models
+}
+
+// newModels returns the PostgreSQL models, running their queries through db, which is either the connection pool or a transaction. The read-only queries
+// of the catalogue and permission models go through reads instead.
+func newModels(db, reads DBTX, timeouts QueryTimeouts) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Movies:         MovieModel{DB: db, ReadDB: reads, Timeout: timeouts.Movies},
+		MovieRevisions: MovieRevisionModel{DB: db, ReadDB: reads, Timeout: timeouts.Movies},
+		People:         PersonModel{DB: db, ReadDB: reads, Timeout: timeouts.Movies},
+		Credits:        CreditModel{DB: db, ReadDB: reads, Timeout: timeouts.Movies},
+		Ratings:        RatingModel{DB: db, ReadDB: reads, Timeout: timeouts.Movies},
+		Lists:          ListModel{DB: db, Timeout: timeouts.Movies},
+		Genres:         GenreModel{DB: db, ReadDB: reads, Timeout: timeouts.Movies},
+		Images:         ImageModel{DB: db, Timeout: timeouts.Movies},
+		Translations:   TranslationModel{DB: db, ReadDB: reads, Timeout: timeouts.Movies},
+		Permissions:    PermissionModel{DB: db, ReadDB: reads, Timeout: timeouts.Permissions},
+		Tokens:         TokenModel{DB: db, Timeout: timeouts.Tokens},
+		Users:          UserModel{DB: db, Timeout: timeouts.Users},
+		timeouts:       timeouts,
 	}
 }
 
-//Create a helper function which returns a Models instance containing the mock models only
-func NewMockModels() Models {
+// NewMemoryModels returns a Models instance backed by a fresh in-memory store. All of the models share the same store, so that (for example) a token inserted
+// through the Tokens model can be used to look up a user through the Users model, just like with PostgreSQL.
+func NewMemoryModels() Models {
+	db := newMemoryDB()
+
 	return Models{
-		//Movies: MockMovieModel{},
-		//Users: MockUserModel{},
+		Movies:         MemoryMovieModel{db: db},
+		MovieRevisions: MemoryMovieRevisionModel{db: db},
+		People:         MemoryPersonModel{db: db},
+		Credits:        MemoryCreditModel{db: db},
+		Ratings:        MemoryRatingModel{db: db},
+		Lists:          MemoryListModel{db: db},
+		Genres:         MemoryGenreModel{db: db},
+		Images:         MemoryImageModel{db: db},
+		Translations:   MemoryTranslationModel{db: db},
+		Permissions:    MemoryPermissionModel{db: db},
+		Tokens:         MemoryTokenModel{db: db},
+		Users:          MemoryUserModel{db: db},
+		memory:         db,
 	}
 }
+
+//Create a helper function which returns a Models instance containing the mock models only. These are now the fully working in-memory models.
+func NewMockModels() Models {
+	return NewMemoryModels()
+}
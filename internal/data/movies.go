@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"github.com/lib/pq"
 	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,22 +21,47 @@ type Movie struct {
 	Runtime Runtime  `json:"runtime,omitempty"`
 	Genres  []string `json:"genres,omitempty"` // Slice of genres for the movie (romance, comedy, etc)
 	Version int32    `json:"version"`          // The version number starts at 1 and will be incremented each time the movie information is upadated
+	// Status is one of the MovieStatuses, and ReleaseDates are the dates that the movie was (or is due to be) released in each region. When a movie has
+	// release dates, Year is the year of the earliest one.
+	Status       string       `json:"status,omitempty"`
+	ReleaseDates ReleaseDates `json:"release_dates,omitempty"`
+	// DeletedAt is set when the movie has been moved to the trash. It is only ever populated for movies returned by GetAllDeleted().
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Relevance is how well the movie matched the title search, and is only populated when sorting by relevance. Highlight is the title as HTML with the
+	// matching words marked, and is only populated when a client asks for it.
+	Relevance float64 `json:"-"`
+	Highlight string  `json:"highlight,omitempty"`
+	// AverageRating and RatingCount summarise the ratings that users have given the movie. They are maintained by the RatingModel rather than set directly.
+	AverageRating float64 `json:"average_rating,omitempty"`
+	RatingCount   int32   `json:"rating_count,omitempty"`
+	// Poster is the movie's poster image, if it has one. It is managed through the ImageModel rather than set directly.
+	Poster *Image `json:"poster,omitempty"`
+	// ExternalIDs are the IDs of the movie in other catalogues, like IMDb.
+	ExternalIDs ExternalIDs `json:"external_ids,omitempty"`
+	// Language is set when the movie has been localized with Localize(), to the language of the translation that Title and Synopsis are in. OriginalTitle
+	// is then the title that the translation replaced.
+	Language      string `json:"language,omitempty"`
+	OriginalTitle string `json:"original_title,omitempty"`
+	Synopsis      string `json:"synopsis,omitempty"`
+	// runtimeFormat is the format that MarshalJSON() writes the runtime in. It is set with SetRuntimeFormat().
+	runtimeFormat string
 }
 
-// The MovieModel struct type wraps a sql.DB connection pool.
+// The MovieModel struct type wraps a sql.DB connection pool, along with the maximum time that any single query is allowed to run for. The read-only
+// queries go through ReadDB instead, which is either the same as DB or a ReplicaSet that spreads them across the read replicas. The other catalogue models
+// (and the PermissionModel) are split in the same way.
 type MovieModel struct {
-	DB *sql.DB
+	DB      DBTX
+	ReadDB  DBTX
+	Timeout time.Duration
 }
 
-type MockMovieModel struct{}
-
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long.")
 
-	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be the future")
+	// The year is checked along with the status and release dates, as the years which are allowed depend on the status.
+	validateRelease(v, movie)
 
 	v.Check(movie.Runtime != 0, "runtime", "must be provided")
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
@@ -45,29 +72,241 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(validator.Unique(movie.Genres), "genres", "must not containe duplicate values")
 }
 
-//The Insert() method accepts a pointer to a movies struct, which should contain the data for the new record
-func (m MovieModel) Insert(movie *Movie) error {
-	//Define the SQL query for inserting a new record in the movies table and returning the system-generated data.
+// MovieFilters holds the conditions that a list of movies can be filtered on. SearchMode is one of the SearchModes, and says how Title is matched. Genres must all be present on a movie, at least one of GenresAny must be (if any
+// are given), and none of ExcludeGenres may be. The ranges are inclusive, except for CreatedBefore, and a zero value means that end of the range is open.
+// PersonID limits the movies to those which the person is credited on. Movies must have an external ID from every source in HasExternalIDs, and from none
+// of the sources in MissingExternalIDs. Statuses are the release statuses to include (StatusUpcoming stands for all of the statuses before release), and
+// movies must have a release date between ReleasedFrom and ReleasedTo (both inclusive), in ReleaseRegion if that is set.
+type MovieFilters struct {
+	Title              string
+	SearchMode         string
+	Genres             []string
+	GenresAny          []string
+	ExcludeGenres      []string
+	YearMin            int32
+	YearMax            int32
+	RuntimeMin         Runtime
+	RuntimeMax         Runtime
+	CreatedAfter       time.Time
+	CreatedBefore      time.Time
+	PersonID           int64
+	HasExternalIDs     []string
+	MissingExternalIDs []string
+	Statuses           []string
+	ReleasedFrom       time.Time
+	ReleasedTo         time.Time
+	ReleaseRegion      string
+}
+
+func ValidateMovieFilters(v *validator.Validator, f MovieFilters) {
+	v.Check(len(f.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(validator.In(f.SearchMode, SearchModes...), "search_mode", "must be one of words, prefix or fuzzy")
+
+	v.Check(f.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(f.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(f.YearMax == 0 || f.YearMin <= f.YearMax, "year_min", "must not be greater than year_max")
+
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_min", "must not be greater than runtime_max")
+
+	v.Check(f.CreatedBefore.IsZero() || f.CreatedAfter.Before(f.CreatedBefore), "created_after", "must be before created_before")
+
+	v.Check(f.PersonID >= 0, "person_id", "must be a positive integer")
+
+	// Each genre list is bounded, so that a client can't make us build an arbitrarily large query.
+	v.Check(len(f.Genres) <= 20, "genres_all", "must not contain more than 20 genres")
+	v.Check(len(f.GenresAny) <= 20, "genres_any", "must not contain more than 20 genres")
+	v.Check(len(f.ExcludeGenres) <= 20, "exclude_genres", "must not contain more than 20 genres")
+
+	for _, genre := range f.ExcludeGenres {
+		if validator.In(genre, f.Genres...) {
+			v.AddError("exclude_genres", "must not contain a genre which is also required")
+			break
+		}
+	}
+
+	validateExternalSources(v, "has_external_ids", f.HasExternalIDs)
+	validateExternalSources(v, "missing_external_ids", f.MissingExternalIDs)
+
+	for _, source := range f.MissingExternalIDs {
+		if validator.In(source, f.HasExternalIDs...) {
+			v.AddError("missing_external_ids", "must not contain a source which is also required")
+			break
+		}
+	}
+
+	validateStatuses(v, f.Statuses)
+	v.Check(f.ReleasedTo.IsZero() || !f.ReleasedTo.Before(f.ReleasedFrom), "released_between", "must not end before it starts")
+	v.Check(f.ReleaseRegion == "" || regionRX.MatchString(f.ReleaseRegion), "release_region", "must be a two letter country code like US")
+}
+
+//The Insert() method accepts a pointer to a movies struct, which should contain the data for the new record, and the ID of the user who is creating it.
+//It returns ErrDuplicateExternalID if one of the movie's external IDs is already used by another movie.
+func (m MovieModel) Insert(ctx context.Context, movie *Movie, userID int64) error {
+	//Define the SQL query for inserting a new record in the movies table and returning the system-generated data. The second (data-modifying) CTE records
+	//the first revision of the movie as part of the same statement, so the movie and its history can never get out of step. The third and fourth store the
+	//external IDs and release dates, which are passed as JSON objects.
 	query := `
-        INSERT INTO movies (title, year, runtime, genres)
-        VALUES ($1, $2, $3, $4)
-        RETURNING id, created_at, version`
+        WITH inserted AS (
+            INSERT INTO movies (title, year, runtime, genres, status)
+            VALUES ($1, $2, $3, $4, $7)
+            RETURNING id, created_at, title, year, runtime, genres, status, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+            SELECT id, version, 'create', title, year, runtime, genres, status, COALESCE($8::jsonb, '{}'), COALESCE($6::jsonb, '{}'), NULLIF($5::bigint, 0)
+            FROM inserted
+        ), external_ids AS (
+            INSERT INTO movie_external_ids (movie_id, source, external_id)
+            SELECT inserted.id, ids.key, ids.value
+            FROM inserted, jsonb_each_text($6::jsonb) AS ids
+        ), release_dates AS (
+            INSERT INTO movie_release_dates (movie_id, region, release_date)
+            SELECT inserted.id, dates.key, dates.value::date
+            FROM inserted, jsonb_each_text($8::jsonb) AS dates
+        )
+        SELECT id, created_at, version FROM inserted`
+
+	externalIDs, err := externalIDsJSON(movie.ExternalIDs)
+	if err != nil {
+		return err
+	}
+
+	releaseDates, err := releaseDatesJSON(movie.ReleaseDates)
+	if err != nil {
+		return err
+	}
 
 	//create an args slice containing the values for the placeholder parameters from the movie struct. Declaring this slice immediately next to our SQL query helps
 	//to make it nice and clear *what values are being used where* in the query.
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), userID, externalIDs, movie.Status, releaseDates}
 
-	//Create a context with a 3-second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	//Derive a context from the caller's context which carries the model's query timeout
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Use the QueryRow() method to execute the SQL query on our connection pool, passing in the args slice as a variadic parameter and scanning the system-generated
 	// id, created_at and version values into the movie struct
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_external_ids_source_external_id_key"`:
+			return ErrDuplicateExternalID
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InsertMany() inserts a batch of movies in a single transaction, filling in the system-generated id, created_at and version values on each of them. The rows
+// are streamed into a temporary table with COPY, which is much faster than running one INSERT per movie, and then moved into the movies table with a single
+// INSERT ... SELECT which also records the 'create' revisions.
+func (m MovieModel) InsertMany(ctx context.Context, movies []*Movie, userID int64) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        CREATE TEMPORARY TABLE movies_import (
+            position integer NOT NULL,
+            title    text    NOT NULL,
+            year     integer NOT NULL,
+            runtime  integer NOT NULL,
+            genres   text[]  NOT NULL,
+            status   text    NOT NULL
+        ) ON COMMIT DROP`)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("movies_import", "position", "title", "year", "runtime", "genres", "status"))
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	for i, movie := range movies {
+		_, err = stmt.ExecContext(ctx, i, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.Status)
+		if err != nil {
+			stmt.Close()
+			return contextError(ctx, err)
+		}
+	}
+
+	// Calling Exec() with no arguments flushes the buffered rows to the server.
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return contextError(ctx, err)
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	// The ids come from a sequence and are assigned in the order that the rows are inserted, so ordering the returned rows by id lines them up with the
+	// movies slice.
+	query := `
+        WITH inserted AS (
+            INSERT INTO movies (title, year, runtime, genres, status)
+            SELECT title, year, runtime, genres, status
+            FROM movies_import
+            ORDER BY position
+            RETURNING id, created_at, title, year, runtime, genres, status, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+            SELECT id, version, 'create', title, year, runtime, genres, status, '{}', '{}', NULLIF($1::bigint, 0)
+            FROM inserted
+        )
+        SELECT id, created_at, version FROM inserted ORDER BY id`
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		if i >= len(movies) {
+			return errors.New("more movies inserted than were imported")
+		}
+
+		err := rows.Scan(&movies[i].ID, &movies[i].CreatedAt, &movies[i].Version)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+		i++
+	}
+	if err = rows.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	// The temporary table is only dropped on commit of the whole transaction, so when this runs inside WithTx() it has to be dropped here, in case the
+	// transaction imports another batch.
+	_, err = tx.ExecContext(ctx, "DROP TABLE movies_import")
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	err = tx.Commit()
+	return contextError(ctx, err)
 }
 
 //Add a placeholder method for fetching a specific record from the movies tables.
-func (m MovieModel) Get(id int64) (*Movie, error) {
+func (m MovieModel) Get(ctx context.Context, id int64) (*Movie, error) {
 	// The PostgreSQL bigserial type that we are using for the movie ID starts auto-incrementing at 1 by default,so we know that no movies will have ID values less
 	// than that. To avoid making an unnecessary database call, we take a shorcut and return an ErrRecordNotFound error straight away.
 	if id < 1 {
@@ -76,15 +315,16 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 
 	// Define the SQL query for retrieving the movie data
 	query := `
-        SELECT id, created_at, title, year, runtime, genres, version 
+        SELECT id, created_at, title, year, runtime, genres, status, version, average_rating, rating_count
         FROM movies
-        WHERE id = $1`
+        WHERE id = $1 AND deleted_at IS NULL`
 
 	//Declare a Movie struct to hold the data returned by the query
 	var movie Movie
 
-	// Use the context.WithTimeout() function to create a context.Context which carries a 3-second timeout deadline. Note that we are using  the empty context.Background() as the aprent context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Use the withTimeout() helper to derive a context.Context which carries the model's timeout deadline. Note that we are using the caller's context as the
+	// parent context, so the query is also abandoned if the client goes away.
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 
 	//Importantly, use defer to make sure that we cancel the context before the Get() method returns
 	defer cancel()
@@ -92,15 +332,19 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	//Execute the query using the QueryRow() method, passing in the provided id value as a placeholder parameter, and scan the response data into the fields of the movie
 	//struct. Importantly, notice that we need to convert the scan target for the genres column using the pq.Array() adapter function again.
 	// Use the QueryRowContext() method to execute the query, passing in the context with the deadline as the first argument.
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.ReadDB.QueryRowContext(ctx, query, id).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
 		&movie.Year,
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
+		&movie.Status,
 		&movie.Version,
+		&movie.AverageRating,
+		&movie.RatingCount,
 	)
+	err = contextError(ctx, err)
 
 	//Handle any errors. If there was no matching movie found, Scan() will return a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
 	//error instead
@@ -113,18 +357,65 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		}
 	}
 
+	err = attachMovieDetails(ctx, m.ReadDB, []*Movie{&movie})
+	if err != nil {
+		return nil, err
+	}
+
 	// Otherwise, return a  pointer to the Movie struct
 	return &movie, nil
 }
 
-// Add a placeholder method for updating a specific record in the movies table.
-func (m MovieModel) Update(movie *Movie) error {
-	// Declare the SQL query for updating the record and returning the new version.
+// Add a placeholder method for updating a specific record in the movies table. The userID is recorded against the new revision of the movie. The movie's
+// external IDs are replaced with those on the struct, unless ExternalIDs is nil, in which case they are left as they are. It returns ErrDuplicateExternalID
+// if one of the external IDs is already used by another movie.
+func (m MovieModel) Update(ctx context.Context, movie *Movie, userID int64) error {
+	// Declare the SQL query for updating the record and returning the new version. The new state is also recorded in movie_revisions, so the state that
+	// it replaces is still available as the previous revision. The external IDs from sources which are no longer present are deleted and the others are
+	// upserted; the two sets of rows never overlap, so the order in which PostgreSQL runs the CTEs doesnt matter. The release dates are replaced in the same
+	// way. Every CTE sees the tables as they were before the statement, so the revision records the new release dates and external IDs from the parameters,
+	// falling back to the current ones when they are left as they are.
 	query := `
-        UPDATE movies
-        SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-        WHERE id = $5 AND version = $6
-        RETURNING version`
+        WITH updated AS (
+            UPDATE movies
+            SET title = $1, year = $2, runtime = $3, genres = $4, status = $9, version = version + 1
+            WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+            RETURNING id, title, year, runtime, genres, status, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+            SELECT id, version, 'update', title, year, runtime, genres, status,
+                COALESCE($10::jsonb, (SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = updated.id), '{}'),
+                COALESCE($8::jsonb, (SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = updated.id), '{}'),
+                NULLIF($7::bigint, 0)
+            FROM updated
+        ), removed_release_dates AS (
+            DELETE FROM movie_release_dates
+            WHERE $10::jsonb IS NOT NULL AND movie_id IN (SELECT id FROM updated) AND NOT $10::jsonb ? region
+        ), release_dates AS (
+            INSERT INTO movie_release_dates (movie_id, region, release_date)
+            SELECT updated.id, dates.key, dates.value::date
+            FROM updated, jsonb_each_text($10::jsonb) AS dates
+            ON CONFLICT (movie_id, region) DO UPDATE SET release_date = EXCLUDED.release_date
+        ), removed_external_ids AS (
+            DELETE FROM movie_external_ids
+            WHERE $8::jsonb IS NOT NULL AND movie_id IN (SELECT id FROM updated) AND NOT $8::jsonb ? source
+        ), external_ids AS (
+            INSERT INTO movie_external_ids (movie_id, source, external_id)
+            SELECT updated.id, ids.key, ids.value
+            FROM updated, jsonb_each_text($8::jsonb) AS ids
+            ON CONFLICT (movie_id, source) DO UPDATE SET external_id = EXCLUDED.external_id
+        )
+        SELECT version FROM updated`
+
+	externalIDs, err := externalIDsJSON(movie.ExternalIDs)
+	if err != nil {
+		return err
+	}
+
+	releaseDates, err := releaseDatesJSON(movie.ReleaseDates)
+	if err != nil {
+		return err
+	}
 
 	// Create an args slice containing the values for the placeholder paramerers
 	args := []interface{}{
@@ -134,20 +425,27 @@ func (m MovieModel) Update(movie *Movie) error {
 		pq.Array(movie.Genres),
 		movie.ID,
 		movie.Version,
+		userID,
+		externalIDs,
+		movie.Status,
+		releaseDates,
 	}
 
-	//Create a context with a  3-second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	//Create a context with the model's timeout
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Use the QueryRow() method to execute the query, passing in the args slice as a variadic parrameter and scanning the new version value into the movie struct
 	// Execute the SQL query. if no matching row could be found, we know the movie version has changed(or record has been deleted) and we return our custom ErrEditConflict error
 	//
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err = contextError(ctx, err)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_external_ids_source_external_id_key"`:
+			return ErrDuplicateExternalID
 		default:
 			return err
 		}
@@ -156,32 +454,41 @@ func (m MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-//Add a placeholder method for deleting a specific  record from the movies table.
-func (m MovieModel) Delete(id int64) error {
+//Add a placeholder method for deleting a specific  record from the movies table. Deleting a movie only moves it to the trash by setting deleted_at, from where
+//it can be restored with Restore() until it is purged.
+func (m MovieModel) Delete(ctx context.Context, id int64, userID int64) error {
 	// Return an ErrRecordNotFound error if the movie ID is less than 1.
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	// Construct the SQL query to delete the record
+	// Construct the SQL query to trash the record, recording a 'delete' revision with the row as it was and returning the number of rows changed.
 	query := `
-        DELETE FROM movies
-        WHERE id = $1`
+        WITH deleted AS (
+            UPDATE movies
+            SET deleted_at = NOW()
+            WHERE id = $1 AND deleted_at IS NULL
+            RETURNING id, title, year, runtime, genres, status, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+            SELECT id, version, 'delete', title, year, runtime, genres, status,
+                COALESCE((SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = deleted.id), '{}'),
+                COALESCE((SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = deleted.id), '{}'),
+                NULLIF($2::bigint, 0)
+            FROM deleted
+        )
+        SELECT count(*) FROM deleted`
 
-	// Create a context with 3-second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Create a context with the model's timeout
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
-	// Execute the SQL query using the Exec() method, passing in the id variable as the value for the placeholder parameter. The Exec() method returns a sql.Result object
 
-	result, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
+	// Execute the SQL query, scanning the number of deleted rows.
+	var rowsAffected int64
 
-	//call the RowsAffected() method on the sql.Result object to get the nmber or rows affected by the query
-	rowsAffected, err := result.RowsAffected()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&rowsAffected)
 	if err != nil {
-		return err
+		return contextError(ctx, err)
 	}
 
 	// If no rows were affected, we know that the movies table didnt contain a record with provided ID at the moment we tried to delete it. In that case we return an ErrRecordNotFound
@@ -193,28 +500,82 @@ func (m MovieModel) Delete(id int64) error {
 }
 
 //Create a new GetAll() method which returns a slice of movies. Although we're not using the right now , we've set this to accept the various filter parameters as arguments
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+//
+// When filters.Cursor is set, the page is found with a keyset condition on the sort column and id rather than with OFFSET, so it costs the same however deep
+// into the list it is. One row more than the page size is fetched, to find out whether there is another page after it.
+func (m MovieModel) GetAll(ctx context.Context, movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	column := filters.sortColumn()
+	direction := filters.sortDirection()
+
+	q, rank := movieFilterQuery(movieFilters)
+
+	// The key is the expression to sort on. Relevance is ordered best match first, and the rank expression stands in for a sort column.
+	key, relevance := column, "0"
+	switch column {
+	case "relevance":
+		if rank == "" {
+			rank = "0"
+		}
+		key, relevance = rank, rank
+		direction = flipDirection(direction)
+	case "rating":
+		key = "average_rating"
+	}
+
+	// Take a copy of the filters before the keyset condition is added, for counting the total number of matching records.
+	count := q.clone()
+
+	offset := filters.offset()
+	order := fmt.Sprintf("%s %s, id ASC", key, direction)
+
+	if filters.Cursor != "" {
+		position, err := filters.position()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		// Check that the value in the cursor suits the sort column before it goes anywhere near the database.
+		if _, err := cursorMovie(position, column); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		// Rows after the cursor in sort order come next. To go backwards, the comparisons and the sort order are reversed, so that the rows closest to
+		// the cursor come first, and keysetMetadata() puts them back in order afterwards.
+		op, idOp := ">", ">"
+		if direction == "DESC" {
+			op = "<"
+		}
+		if position.Before {
+			op, idOp = flipComparison(op), "<"
+			order = fmt.Sprintf("%s %s, id DESC", key, flipDirection(direction))
+		}
+
+		value, id := q.arg(position.Value), q.arg(position.ID)
+		q.where(fmt.Sprintf("(%s %s %s OR (%s = %s AND id %s %s))", key, op, value, key, value, idOp, id))
+		offset = 0
+	}
+
+	// Only ask for the window count when paging by number, as with a cursor it would count the rows after the cursor rather than all of the matches.
+	total := "0"
+	if filters.IncludeTotal && filters.Cursor == "" {
+		total = "count(*) OVER()"
+	}
+
 	// Construct the SQL query to retrieve all movie records
 	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+        SELECT %s, %s, id, created_at, title, year, runtime, genres, status, version, average_rating, rating_count
         FROM movies
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-        AND (genres @> $2 OR $2 = '{}')
-        ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+        %s
+        ORDER BY %s
+        LIMIT %s OFFSET %s`, total, relevance, q.whereClause(), order, q.arg(filters.limit()+1), q.arg(offset))
 
-	// Create a context with a 3-second timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Create a context with the model's timeout
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	// As our SQL query now has quite a few placeholder parameters, lets collect the values for the placeholders in a slice. Notice here how we call the limit() and offset()
-	// methods on the Filters strcut to get the appropriate values for the LIMIT and OFFSET clauses
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
-
 	// Use QueryContext() to execute the query. This returns a sql.Rows resultset containing the result.
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.ReadDB.QueryContext(ctx, query, q.args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, contextError(ctx, err)
 	}
 	// Importantly, defer a call to rows.Close() to ensure that the resultset is closed before GetAll() returns.
 	defer rows.Close()
@@ -228,52 +589,515 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 		// Scan the values from the row into the Movie struct. Again, note that we're using the pq.Array() adapter on the genres field here
 		err := rows.Scan(
 			&totalRecords,
+			&movie.Relevance,
 			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
+			&movie.Status,
 			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
 		)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, Metadata{}, contextError(ctx, err)
 		}
 		// Add the movie struct to the slice
 		movies = append(movies, &movie)
 	}
 	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error that was encounteredd during the iteration
 	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	rows.Close()
+
+	err = attachMovieDetails(ctx, m.ReadDB, movies)
+	if err != nil {
 		return nil, Metadata{}, err
 	}
 
-	// Generate a Metadata struct, passing in the total record count and pagination parameters from the client
+	// With a cursor, the total is counted separately, without the keyset condition.
+	switch {
+	case !filters.IncludeTotal:
+		totalRecords = -1
+	case filters.Cursor != "":
+		query := "SELECT count(*) FROM movies " + count.whereClause()
+
+		err = m.ReadDB.QueryRowContext(ctx, query, count.args...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+	}
+
+	// Generate a Metadata struct from the page of movies and the pagination parameters from the client
+	return keysetMetadata(movies, filters, totalRecords, movieID, func(movie *Movie) string {
+		return movieSortKey(movie, column)
+	})
+}
+
+// movieFilterQuery returns the conditions for selecting the movies which arent in the trash and match the filters. These are shared by GetAll() and Export(),
+// so that an export contains exactly the movies which the same filters list. Filters which arent set add no condition at all, rather than a condition which
+// is always true, so that the planner can make the most of the indexes. If there is a title search, it also returns an expression which ranks how well
+// each movie matches it (higher is better), for sorting by relevance.
+//
+// Word and prefix searches use the full-text index on the title, and fuzzy searches use the trigram index from the pg_trgm extension. The translated titles
+// of each movie are searched in the same way, and a movie is ranked by its best matching title.
+func movieFilterQuery(f MovieFilters) (*filterQuery, string) {
+	q := &filterQuery{}
+	q.where("deleted_at IS NULL")
+
+	rank := ""
+	if f.Title != "" {
+		// match and score are formats for the condition and rank expression on a title column, which are applied to the title on the movies table and to
+		// the titles of its translations.
+		var match, score string
+
+		switch f.SearchMode {
+		case SearchPrefix:
+			query := fmt.Sprintf("to_tsquery('simple', %s)", q.arg(prefixQuery(f.Title)))
+			match = "to_tsvector('simple', %s) @@ " + query
+			score = "ts_rank(to_tsvector('simple', %s), " + query + ")"
+		case SearchFuzzy:
+			search := q.arg(f.Title)
+			match = search + " <%% %s"
+			score = "word_similarity(" + search + ", %s)"
+		default:
+			query := fmt.Sprintf("plainto_tsquery('simple', %s)", q.arg(f.Title))
+			match = "to_tsvector('simple', %s) @@ " + query
+			score = "ts_rank(to_tsvector('simple', %s), " + query + ")"
+		}
+
+		q.where(fmt.Sprintf("(%s OR id IN (SELECT movie_id FROM movie_translations WHERE %s))", fmt.Sprintf(match, "title"), fmt.Sprintf(match, "movie_translations.title")))
+		rank = fmt.Sprintf("GREATEST(%s, (SELECT max(%s) FROM movie_translations WHERE movie_translations.movie_id = movies.id))",
+			fmt.Sprintf(score, "title"), fmt.Sprintf(score, "movie_translations.title"))
+	}
+	if len(f.Genres) > 0 {
+		q.where(fmt.Sprintf("genres @> %s", q.arg(pq.Array(f.Genres))))
+	}
+	if len(f.GenresAny) > 0 {
+		q.where(fmt.Sprintf("genres && %s", q.arg(pq.Array(f.GenresAny))))
+	}
+	if len(f.ExcludeGenres) > 0 {
+		q.where(fmt.Sprintf("NOT genres && %s", q.arg(pq.Array(f.ExcludeGenres))))
+	}
+	if f.YearMin != 0 {
+		q.where(fmt.Sprintf("year >= %s", q.arg(f.YearMin)))
+	}
+	if f.YearMax != 0 {
+		q.where(fmt.Sprintf("year <= %s", q.arg(f.YearMax)))
+	}
+	if f.RuntimeMin != 0 {
+		q.where(fmt.Sprintf("runtime >= %s", q.arg(f.RuntimeMin)))
+	}
+	if f.RuntimeMax != 0 {
+		q.where(fmt.Sprintf("runtime <= %s", q.arg(f.RuntimeMax)))
+	}
+	if !f.CreatedAfter.IsZero() {
+		q.where(fmt.Sprintf("created_at >= %s", q.arg(f.CreatedAfter)))
+	}
+	if !f.CreatedBefore.IsZero() {
+		q.where(fmt.Sprintf("created_at < %s", q.arg(f.CreatedBefore)))
+	}
+	if f.PersonID != 0 {
+		q.where(fmt.Sprintf("id IN (SELECT movie_id FROM credits WHERE person_id = %s)", q.arg(f.PersonID)))
+	}
+	for _, source := range f.HasExternalIDs {
+		q.where(fmt.Sprintf("id IN (SELECT movie_id FROM movie_external_ids WHERE source = %s)", q.arg(source)))
+	}
+	if len(f.MissingExternalIDs) > 0 {
+		q.where(fmt.Sprintf("id NOT IN (SELECT movie_id FROM movie_external_ids WHERE source = ANY(%s))", q.arg(pq.Array(f.MissingExternalIDs))))
+	}
+	if len(f.Statuses) > 0 {
+		q.where(fmt.Sprintf("status = ANY(%s)", q.arg(pq.Array(expandStatuses(f.Statuses)))))
+	}
+	if !f.ReleasedFrom.IsZero() || !f.ReleasedTo.IsZero() || f.ReleaseRegion != "" {
+		conditions := []string{}
+		if !f.ReleasedFrom.IsZero() {
+			conditions = append(conditions, fmt.Sprintf("release_date >= %s", q.arg(f.ReleasedFrom.Format(dateLayout))))
+		}
+		if !f.ReleasedTo.IsZero() {
+			conditions = append(conditions, fmt.Sprintf("release_date <= %s", q.arg(f.ReleasedTo.Format(dateLayout))))
+		}
+		if f.ReleaseRegion != "" {
+			conditions = append(conditions, fmt.Sprintf("region = %s", q.arg(f.ReleaseRegion)))
+		}
+		q.where(fmt.Sprintf("id IN (SELECT movie_id FROM movie_release_dates WHERE %s)", strings.Join(conditions, " AND ")))
+	}
+
+	return q, rank
+}
+
+// attachMovieDetails loads the data about movies which is kept outside the movies table, like their posters, external IDs and release dates, and sets it
+// on each movie.
+func attachMovieDetails(ctx context.Context, db DBTX, movies []*Movie) error {
+	err := attachPosters(ctx, db, movies)
+	if err != nil {
+		return err
+	}
+
+	err = attachExternalIDs(ctx, db, movies)
+	if err != nil {
+		return err
+	}
+
+	return attachReleaseDates(ctx, db, movies)
+}
+
+// movieSortKey returns the value of the given sort column for the movie, in the form that it is stored in a cursor.
+func movieSortKey(movie *Movie, column string) string {
+	switch column {
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.FormatInt(int64(movie.Year), 10)
+	case "runtime":
+		return strconv.FormatInt(int64(movie.Runtime), 10)
+	case "relevance":
+		// Ranks are float4 in PostgreSQL, so format them at that precision for the value to compare equal when it comes back.
+		return strconv.FormatFloat(movie.Relevance, 'g', -1, 32)
+	case "rating":
+		return strconv.FormatFloat(movie.AverageRating, 'f', 2, 64)
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
+}
+
+// cursorMovie returns a movie with its id and the given sort column set from the cursor, or ErrInvalidCursor if the value in the cursor doesnt suit the
+// column.
+func cursorMovie(c cursor, column string) (*Movie, error) {
+	movie := &Movie{ID: c.ID}
+
+	switch column {
+	case "title":
+		movie.Title = c.Value
+	case "year":
+		year, err := strconv.ParseInt(c.Value, 10, 32)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		movie.Year = int32(year)
+	case "runtime":
+		runtime, err := strconv.ParseInt(c.Value, 10, 32)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		movie.Runtime = Runtime(runtime)
+	case "relevance":
+		relevance, err := strconv.ParseFloat(c.Value, 32)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		movie.Relevance = relevance
+	case "rating":
+		rating, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		movie.AverageRating = rating
+	default:
+		id, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil || id != c.ID {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return movie, nil
+}
+
+func movieID(movie *Movie) int64 {
+	return movie.ID
+}
+
+func flipComparison(op string) string {
+	if op == ">" {
+		return "<"
+	}
+	return ">"
+}
+
+func flipDirection(direction string) string {
+	if direction == "DESC" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// GetAllDeleted() returns a page of the movies which are in the trash, including the time that each one was deleted.
+func (m MovieModel) GetAllDeleted(ctx context.Context, filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, status, version, deleted_at
+        FROM movies
+        WHERE deleted_at IS NOT NULL
+        ORDER BY %s %s, id ASC
+        LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Status,
+			&movie.Version,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
-	// If everything went OK, then return the slice of movies
 	return movies, metadata, nil
 }
 
-func (m MockMovieModel) Insert(movie *Movie) error {
-	// Mock the action
+// Restore() takes a movie back out of the trash. Restoring a movie creates a new version of it (with a 'restore' revision), so that any client still
+// holding the version from before the movie was deleted gets an edit conflict rather than silently overwriting it.
+func (m MovieModel) Restore(ctx context.Context, id int64, userID int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        WITH restored AS (
+            UPDATE movies
+            SET deleted_at = NULL, version = version + 1
+            WHERE id = $1 AND deleted_at IS NOT NULL
+            RETURNING id, created_at, title, year, runtime, genres, status, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+            SELECT id, version, 'restore', title, year, runtime, genres, status,
+                COALESCE((SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = restored.id), '{}'),
+                COALESCE((SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = restored.id), '{}'),
+                NULLIF($2::bigint, 0)
+            FROM restored
+        )
+        SELECT id, created_at, title, year, runtime, genres, status, version FROM restored`
+
+	var movie Movie
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Status,
+		&movie.Version,
+	)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &movie, nil
+}
+
+// Purge() permanently deletes a movie, whether or not it is in the trash. A 'purge' revision is recorded so that the history shows who removed it.
+func (m MovieModel) Purge(ctx context.Context, id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        WITH deleted AS (
+            DELETE FROM movies
+            WHERE id = $1
+            RETURNING id, title, year, runtime, genres, status, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids, user_id)
+            SELECT id, version, 'purge', title, year, runtime, genres, status,
+                COALESCE((SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = deleted.id), '{}'),
+                COALESCE((SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = deleted.id), '{}'),
+                NULLIF($2::bigint, 0)
+            FROM deleted
+        )
+        SELECT count(*) FROM deleted`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var rowsAffected int64
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&rowsAffected)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
 }
 
-func (m MockMovieModel) Get(id int64) (*Movie, error) {
-	// Mock the action
-	return nil, nil
+// PurgeDeleted() permanently deletes every movie which was moved to the trash before the given time, returning the ids of the movies purged.
+func (m MovieModel) PurgeDeleted(ctx context.Context, before time.Time) ([]int64, error) {
+	query := `
+        WITH deleted AS (
+            DELETE FROM movies
+            WHERE deleted_at < $1
+            RETURNING id, title, year, runtime, genres, status, version
+        ), revision AS (
+            INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres, status, release_dates, external_ids)
+            SELECT id, version, 'purge', title, year, runtime, genres, status,
+                COALESCE((SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = deleted.id), '{}'),
+                COALESCE((SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = deleted.id), '{}')
+            FROM deleted
+        )
+        SELECT id FROM deleted`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	purged := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		purged = append(purged, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return purged, nil
 }
 
-func (m MockMovieModel) Update(movie *Movie) error {
-	//Mock the action
-	return nil
+// Export() calls fn for every movie matching the filters, in id order. Rather than loading the whole result set into memory, it declares a
+// server-side cursor and fetches the rows from it a batch at a time, so memory use stays flat no matter how many movies there are. The model's timeout applies
+// to each fetch rather than to the export as a whole (and not to the time spent in fn, which may be writing to a slow client), and the export stops as soon as
+// ctx is cancelled or fn returns an error.
+func (m MovieModel) Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error {
+	tx, err := beginTx(ctx, m.DB, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	q, _ := movieFilterQuery(movieFilters)
+
+	query := `
+        DECLARE movies_export NO SCROLL CURSOR FOR
+        SELECT id, created_at, title, year, runtime, genres, status, version
+        FROM movies
+        ` + q.whereClause() + `
+        ORDER BY id`
+
+	_, err = tx.ExecContext(ctx, query, q.args...)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	for {
+		fetched, err := m.exportBatch(ctx, tx, fn)
+		if err != nil {
+			return err
+		}
+		if fetched == 0 {
+			break
+		}
+	}
+
+	return contextError(ctx, tx.Commit())
 }
 
-func (m MockMovieModel) Delete(id int64) error {
-	// Mock the action
-	return nil
+// exportBatch fetches the next batch of rows from the export cursor and calls fn for each of them, returning the number of rows fetched.
+func (m MovieModel) exportBatch(ctx context.Context, tx DBTX, fn func(*Movie) error) (int, error) {
+	movies, err := m.fetchExportBatch(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, movie := range movies {
+		err = fn(movie)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(movies), nil
 }
 
-func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
-	return nil, Metadata{}, nil
+// fetchExportBatch reads the next batch of rows from the export cursor, within the model's timeout.
+func (m MovieModel) fetchExportBatch(ctx context.Context, tx DBTX) ([]*Movie, error) {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, "FETCH 500 FROM movies_export")
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Status,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return movies, nil
 }
@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"github.com/lib/pq"
 	"time"
 )
@@ -23,12 +22,14 @@ func (p Permissions) Include(code string) bool {
 
 //Define the PermissionModel type
 type PermissionModel struct {
-	DB *sql.DB
+	DB      DBTX
+	ReadDB  DBTX
+	Timeout time.Duration
 }
 
 // The GetAllForUser() method returns all permission codes for a specific user in a Permissions slice. The code in this method should feel very farmiliar
 // it uses the standard pattern that we've already seen before for retrieving multiple data rows in an SQL query.
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
         SELECT permissions.code
         FROM permissions
@@ -36,12 +37,12 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
         INNER JOIN users ON users_permissions.user_id = users.id
         WHERE users.id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	rows, err := m.ReadDB.QueryContext(ctx, query, userID)
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
 
 	defer rows.Close()
@@ -53,13 +54,13 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 
 		err := rows.Scan(&permission)
 		if err != nil {
-			return nil, err
+			return nil, contextError(ctx, err)
 		}
 
 		permissions = append(permissions, permission)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
 
 	return permissions, nil
@@ -68,14 +69,14 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 // Add the provided permission codes for a specific user. Notice that we are using a variadic parameter for the codes so that we can assign multiple permissions in
 // a single call
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
         INSERT INTO users_permissions
         SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
+	return contextError(ctx, err)
 }
@@ -0,0 +1,41 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A filterQuery collects the conditions for the WHERE clause of a query along with the values for their placeholder parameters, numbering the placeholders
+// in the order that the values are added. This lets the list queries include only the conditions that a client has actually asked for.
+type filterQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds a value for a placeholder parameter and returns the placeholder to use for it in the query, such as "$3".
+func (q *filterQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// where adds a condition to the WHERE clause. Conditions are combined with AND.
+func (q *filterQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// whereClause returns the WHERE clause for the conditions added so far.
+func (q *filterQuery) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+
+	return "WHERE " + strings.Join(q.conditions, "\n        AND ")
+}
+
+// clone returns a copy of the query which can be extended without affecting the original.
+func (q *filterQuery) clone() *filterQuery {
+	return &filterQuery{
+		conditions: append([]string(nil), q.conditions...),
+		args:       append([]interface{}(nil), q.args...),
+	}
+}
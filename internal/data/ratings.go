@@ -0,0 +1,213 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"time"
+)
+
+// ErrDuplicateRating is returned when a user tries to add a second rating to the same movie.
+var ErrDuplicateRating = errors.New("duplicate rating")
+
+// A Rating is one user's score for a movie from 1 to 10, with an optional written review. Each user can rate each movie once. UserName is populated when
+// listing reviews.
+type Rating struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name,omitempty"`
+	Rating    int32     `json:"rating"`
+	Review    string    `json:"review,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Rating != 0, "rating", "must be provided")
+	v.Check(rating.Rating == 0 || (rating.Rating >= 1 && rating.Rating <= 10), "rating", "must be between 1 and 10")
+
+	v.Check(len(rating.Review) <= 10_000, "review", "must not be more than 10000 bytes long")
+}
+
+// The RatingModel struct type wraps a sql.DB connection pool, along with the maximum time that any single operation is allowed to run for.
+type RatingModel struct {
+	DB      DBTX
+	ReadDB  DBTX
+	Timeout time.Duration
+}
+
+// Insert() adds a user's rating of a movie and updates the movie's aggregate scores. It returns ErrRecordNotFound if the movie doesnt exist (or is in the
+// trash), and ErrDuplicateRating if the user has already rated it.
+func (m RatingModel) Insert(ctx context.Context, rating *Rating) error {
+	return m.withMovieLocked(ctx, rating.MovieID, func(ctx context.Context, tx DBTX) error {
+		query := `
+            INSERT INTO ratings (movie_id, user_id, rating, review)
+            VALUES ($1, $2, $3, $4)
+            RETURNING created_at, updated_at`
+
+		args := []interface{}{rating.MovieID, rating.UserID, rating.Rating, rating.Review}
+
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "ratings_pkey"`:
+				return ErrDuplicateRating
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Update() replaces a user's rating and review of a movie and updates the movie's aggregate scores. It returns ErrRecordNotFound if the movie doesnt
+// exist or the user hasnt rated it.
+func (m RatingModel) Update(ctx context.Context, rating *Rating) error {
+	return m.withMovieLocked(ctx, rating.MovieID, func(ctx context.Context, tx DBTX) error {
+		query := `
+            UPDATE ratings
+            SET rating = $1, review = $2, updated_at = NOW()
+            WHERE movie_id = $3 AND user_id = $4
+            RETURNING created_at, updated_at`
+
+		args := []interface{}{rating.Rating, rating.Review, rating.MovieID, rating.UserID}
+
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Delete() removes a user's rating of a movie and updates the movie's aggregate scores, or returns ErrRecordNotFound.
+func (m RatingModel) Delete(ctx context.Context, movieID, userID int64) error {
+	return m.withMovieLocked(ctx, movieID, func(ctx context.Context, tx DBTX) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM ratings WHERE movie_id = $1 AND user_id = $2", movieID, userID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+// withMovieLocked runs fn in a transaction which holds a lock on the movie row, then recalculates the movie's rating_count and average_rating from its
+// ratings before committing. Taking the lock first means that concurrent changes to the ratings of the same movie are applied one after the other, and as
+// each statement in a READ COMMITTED transaction sees everything committed before it started, the recalculation always includes every other rating. It
+// returns ErrRecordNotFound if the movie doesnt exist or is in the trash.
+func (m RatingModel) withMovieLocked(ctx context.Context, movieID int64, fn func(context.Context, DBTX) error) error {
+	if movieID < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := beginTx(ctx, m.DB, nil)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var id int64
+
+	err = tx.QueryRowContext(ctx, "SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", movieID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return contextError(ctx, err)
+		}
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	query := `
+        UPDATE movies
+        SET (rating_count, average_rating) = (
+            SELECT count(*), COALESCE(round(avg(rating), 2), 0)
+            FROM ratings
+            WHERE movie_id = $1
+        )
+        WHERE id = $1`
+
+	_, err = tx.ExecContext(ctx, query, movieID)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+// GetReviews() returns a page of the ratings of a movie which include a written review, along with the names of the users who wrote them.
+func (m RatingModel) GetReviews(ctx context.Context, movieID int64, filters Filters) ([]*Rating, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), ratings.movie_id, ratings.user_id, users.name, ratings.rating, ratings.review, ratings.created_at, ratings.updated_at
+        FROM ratings
+        INNER JOIN users ON users.id = ratings.user_id
+        WHERE ratings.movie_id = $1 AND ratings.review <> ''
+        ORDER BY ratings.%s %s, ratings.user_id ASC
+        LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	ratings := []*Rating{}
+
+	for rows.Next() {
+		var rating Rating
+
+		err := rows.Scan(
+			&totalRecords,
+			&rating.MovieID,
+			&rating.UserID,
+			&rating.UserName,
+			&rating.Rating,
+			&rating.Review,
+			&rating.CreatedAt,
+			&rating.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		ratings = append(ratings, &rating)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return ratings, metadata, nil
+}
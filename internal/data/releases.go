@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Define constants for the release status of a movie. Only released movies are held to being in the past; the others can be given a year up to
+// maxAnnouncedYears ahead.
+const (
+	StatusAnnounced    = "announced"
+	StatusInProduction = "in_production"
+	StatusReleased     = "released"
+	StatusCancelled    = "cancelled"
+)
+
+// MovieStatuses lists the supported release statuses.
+var MovieStatuses = []string{StatusAnnounced, StatusInProduction, StatusReleased, StatusCancelled}
+
+// StatusUpcoming can be used in the status filter to stand for every status of a movie which is still to come out, that is announced and in_production.
+const StatusUpcoming = "upcoming"
+
+// maxAnnouncedYears is how many years ahead a movie which hasnt been released yet can be announced for.
+const maxAnnouncedYears = 10
+
+// dateLayout is the format of release dates, in JSON and in the query string.
+const dateLayout = "2006-01-02"
+
+// regionRX matches the regions that a movie can have a release date in, which are ISO 3166-1 alpha-2 country codes like "US".
+var regionRX = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ReleaseDates holds the date that a movie was (or is due to be) released in each region, keyed by region, with the dates in the form "2006-01-02".
+type ReleaseDates map[string]string
+
+// Earliest returns the earliest of the release dates, or false if there arent any valid dates.
+func (dates ReleaseDates) Earliest() (time.Time, bool) {
+	var earliest time.Time
+	found := false
+
+	for _, s := range dates {
+		date, err := time.Parse(dateLayout, s)
+		if err != nil {
+			continue
+		}
+		if !found || date.Before(earliest) {
+			earliest, found = date, true
+		}
+	}
+
+	return earliest, found
+}
+
+// ReleaseYear returns the year of the earliest release date of the movie, or zero if it doesnt have any release dates. Where a movie has release dates, its
+// Year should be set from this.
+func (movie *Movie) ReleaseYear() int32 {
+	earliest, ok := movie.ReleaseDates.Earliest()
+	if !ok {
+		return 0
+	}
+	return int32(earliest.Year())
+}
+
+// ParseDate parses a date in the form "2006-01-02".
+func ParseDate(s string) (time.Time, error) {
+	return time.Parse(dateLayout, s)
+}
+
+// validateRelease checks the status, year and release dates of a movie, which depend on each other. A released movie must be from this year or
+// earlier, and if it has release dates then at least one of them must have passed. A cancelled movie cant have any release dates. Whatever the status, a
+// movie with release dates must have the year of the earliest one. Errors for the release dates are recorded under "release_dates.<region>".
+func validateRelease(v *validator.Validator, movie *Movie) {
+	v.Check(validator.In(movie.Status, MovieStatuses...), "status", fmt.Sprintf("must be one of %s", strings.Join(MovieStatuses, ", ")))
+
+	now := time.Now()
+
+	v.Check(movie.Year != 0, "year", "must be provided")
+	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
+	if movie.Status == StatusReleased {
+		v.Check(movie.Year <= int32(now.Year()), "year", "must not be in the future for a released movie")
+	} else {
+		v.Check(movie.Year <= int32(now.Year()+maxAnnouncedYears), "year", fmt.Sprintf("must not be more than %d years in the future", maxAnnouncedYears))
+	}
+
+	v.Check(len(movie.ReleaseDates) <= 250, "release_dates", "must not contain more than 250 regions")
+	v.Check(movie.Status != StatusCancelled || len(movie.ReleaseDates) == 0, "release_dates", "must not be given for a cancelled movie")
+
+	released := false
+	for region, s := range movie.ReleaseDates {
+		if !regionRX.MatchString(region) {
+			v.AddError("release_dates", "must only contain two letter country codes like US")
+			continue
+		}
+
+		date, err := ParseDate(s)
+		if err != nil {
+			v.AddError("release_dates."+region, "must be a date like 2006-01-02")
+			continue
+		}
+		v.Check(date.Year() >= 1888, "release_dates."+region, "must not be before 1888")
+
+		if !date.After(now) {
+			released = true
+		}
+	}
+
+	if len(movie.ReleaseDates) > 0 && movie.Status == StatusReleased {
+		v.Check(released, "release_dates", "must contain a date which has passed for a released movie")
+	}
+	if year := movie.ReleaseYear(); year != 0 {
+		v.Check(movie.Year == year, "year", "must be the year of the earliest release date")
+	}
+}
+
+// validateStatuses checks that the statuses in the filters are all supported, allowing StatusUpcoming as well.
+func validateStatuses(v *validator.Validator, statuses []string) {
+	for _, status := range statuses {
+		if status != StatusUpcoming && !validator.In(status, MovieStatuses...) {
+			v.AddError("status", fmt.Sprintf("must only contain %s or %s", strings.Join(MovieStatuses, ", "), StatusUpcoming))
+			return
+		}
+	}
+}
+
+// expandStatuses returns the statuses in the filters with StatusUpcoming replaced by the statuses it stands for.
+func expandStatuses(statuses []string) []string {
+	expanded := []string{}
+	for _, status := range statuses {
+		if status == StatusUpcoming {
+			expanded = append(expanded, StatusAnnounced, StatusInProduction)
+			continue
+		}
+		expanded = append(expanded, status)
+	}
+	return expanded
+}
+
+// releaseDatesJSON encodes a set of release dates as a JSON object for the queries which store them, or returns nil if the set is nil.
+func releaseDatesJSON(dates ReleaseDates) (interface{}, error) {
+	if dates == nil {
+		return nil, nil
+	}
+
+	js, err := json.Marshal(dates)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+// attachReleaseDates looks up the release dates of the movies in a single query and sets the ReleaseDates field of each movie which has any.
+func attachReleaseDates(ctx context.Context, db DBTX, movies []*Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+
+	query := `
+        SELECT movie_id, region, to_char(release_date, 'YYYY-MM-DD')
+        FROM movie_release_dates
+        WHERE movie_id = ANY($1)`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	releaseDates := make(map[int64]ReleaseDates)
+
+	for rows.Next() {
+		var (
+			movieID      int64
+			region, date string
+		)
+
+		err := rows.Scan(&movieID, &region, &date)
+		if err != nil {
+			return contextError(ctx, err)
+		}
+
+		if releaseDates[movieID] == nil {
+			releaseDates[movieID] = ReleaseDates{}
+		}
+		releaseDates[movieID][region] = date
+	}
+	if err = rows.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	for _, movie := range movies {
+		movie.ReleaseDates = releaseDates[movie.ID]
+	}
+
+	return nil
+}
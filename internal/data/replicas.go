@@ -0,0 +1,232 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// replicaCheckTimeout is how long a replica has to answer a health check.
+const replicaCheckTimeout = 2 * time.Second
+
+// primaryContextKey is the key for the flag set by UsePrimary().
+const primaryContextKey = contextKey("primary")
+
+// contextKey is the type of the keys used for the values that the data package stores in contexts.
+type contextKey string
+
+// UsePrimary returns a copy of ctx which makes the models read from the primary database rather than from a replica or the cache. It is used when the
+// reads have to see writes which have only just been made, like when a movie is read back after it has been updated, as the replicas may be a little
+// behind the primary.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey, true)
+}
+
+// usesPrimary reports whether ctx was returned by UsePrimary().
+func usesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey).(bool)
+	return primary
+}
+
+// A ReplicaSet spreads read-only queries across the read replicas of the primary database, in turn. Replicas which fail their health check, or fail to
+// connect when they are queried, are skipped until they pass a health check again, and the reads go to the primary when no replica is healthy. It
+// satisfies DBTX, so it can be used wherever the models expect a database, but only queries are sent to the replicas: anything else goes to the primary.
+type ReplicaSet struct {
+	primary   *sql.DB
+	replicas  []*replica
+	next      uint32
+	fallbacks int64
+}
+
+// A replica is one of the read replicas in a ReplicaSet, along with its health and the counts which are reported by Stats().
+type replica struct {
+	name     string
+	db       *sql.DB
+	healthy  int32
+	queries  int64
+	failures int64
+}
+
+// ReplicaStats reports on one of the replicas in a ReplicaSet. Queries counts the reads sent to the replica and Failures those which failed to connect and
+// were sent to the primary instead.
+type ReplicaStats struct {
+	Healthy  bool        `json:"healthy"`
+	Queries  int64       `json:"queries"`
+	Failures int64       `json:"failures"`
+	Pool     sql.DBStats `json:"pool"`
+}
+
+// A ReplicaHealth reports a change in the health of a replica, found by CheckHealth(). Err is why the replica is unhealthy.
+type ReplicaHealth struct {
+	Name    string
+	Healthy bool
+	Err     error
+}
+
+// NewReplicaSet returns a ReplicaSet for the given replicas of the primary database, which are named "replica1", "replica2" and so on in the order given.
+// The replicas start out healthy, so CheckHealth() should be called before the set is used.
+func NewReplicaSet(primary *sql.DB, replicas []*sql.DB) *ReplicaSet {
+	rs := &ReplicaSet{primary: primary}
+
+	for i, db := range replicas {
+		rs.replicas = append(rs.replicas, &replica{name: fmt.Sprintf("replica%d", i+1), db: db, healthy: 1})
+	}
+
+	return rs
+}
+
+// CheckHealth() pings each of the replicas, marking those which answer as healthy and the rest as unhealthy, and returns the replicas whose health changed.
+func (rs *ReplicaSet) CheckHealth(ctx context.Context) []ReplicaHealth {
+	var changes []ReplicaHealth
+
+	for _, r := range rs.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+
+		if r.setHealthy(err == nil) {
+			changes = append(changes, ReplicaHealth{Name: r.name, Healthy: err == nil, Err: err})
+		}
+	}
+
+	return changes
+}
+
+// Stats() returns the stats of each replica, keyed by name.
+func (rs *ReplicaSet) Stats() map[string]ReplicaStats {
+	stats := make(map[string]ReplicaStats, len(rs.replicas))
+
+	for _, r := range rs.replicas {
+		stats[r.name] = ReplicaStats{
+			Healthy:  atomic.LoadInt32(&r.healthy) == 1,
+			Queries:  atomic.LoadInt64(&r.queries),
+			Failures: atomic.LoadInt64(&r.failures),
+			Pool:     r.db.Stats(),
+		}
+	}
+
+	return stats
+}
+
+// Fallbacks() returns the number of reads which went to the primary because no replica was healthy, or because the replica they were sent to failed.
+func (rs *ReplicaSet) Fallbacks() int64 {
+	return atomic.LoadInt64(&rs.fallbacks)
+}
+
+// Close() closes the connection pools of all of the replicas. The primary is left open.
+func (rs *ReplicaSet) Close() error {
+	var err error
+	for _, r := range rs.replicas {
+		if closeErr := r.db.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// ExecContext runs the statement on the primary, as statements may write.
+func (rs *ReplicaSet) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return rs.primary.ExecContext(ctx, query, args...)
+}
+
+// PrepareContext prepares the statement on the primary, as statements may write.
+func (rs *ReplicaSet) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return rs.primary.PrepareContext(ctx, query)
+}
+
+// QueryContext runs the query on the next healthy replica, or on the primary if there isnt one or the replica fails to connect.
+func (rs *ReplicaSet) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	r := rs.pick(ctx)
+	if r == nil {
+		return rs.primary.QueryContext(ctx, query, args...)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil && rs.failed(ctx, r, err) {
+		return rs.primary.QueryContext(ctx, query, args...)
+	}
+
+	return rows, err
+}
+
+// QueryRowContext runs the query on the next healthy replica, or on the primary if there isnt one or the replica fails to connect.
+func (rs *ReplicaSet) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	r := rs.pick(ctx)
+	if r == nil {
+		return rs.primary.QueryRowContext(ctx, query, args...)
+	}
+
+	row := r.db.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); err != nil && rs.failed(ctx, r, err) {
+		return rs.primary.QueryRowContext(ctx, query, args...)
+	}
+
+	return row
+}
+
+// pick returns the next healthy replica in turn, or nil if the read should go to the primary because there are none or the context asks for the primary.
+func (rs *ReplicaSet) pick(ctx context.Context) *replica {
+	if len(rs.replicas) == 0 {
+		return nil
+	}
+	if usesPrimary(ctx) {
+		return nil
+	}
+
+	start := atomic.AddUint32(&rs.next, 1)
+	for i := range rs.replicas {
+		r := rs.replicas[(int(start)+i)%len(rs.replicas)]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			atomic.AddInt64(&r.queries, 1)
+			return r
+		}
+	}
+
+	atomic.AddInt64(&rs.fallbacks, 1)
+	return nil
+}
+
+// failed is called when a query on a replica returns an error. If the replica couldnt be reached, it is marked as unhealthy and failed returns true, so
+// that the query is sent to the primary instead. Any other error (like a cancelled context or a bad query) would happen on the primary too, so it is left
+// for the caller.
+func (rs *ReplicaSet) failed(ctx context.Context, r *replica, err error) bool {
+	if ctx.Err() != nil || !isConnectionError(err) {
+		return false
+	}
+
+	r.setHealthy(false)
+	atomic.AddInt64(&r.failures, 1)
+	atomic.AddInt64(&rs.fallbacks, 1)
+	return true
+}
+
+// setHealthy sets the health of the replica, and reports whether it changed.
+func (r *replica) setHealthy(healthy bool) bool {
+	value := int32(0)
+	if healthy {
+		value = 1
+	}
+	return atomic.SwapInt32(&r.healthy, value) != value
+}
+
+// isConnectionError reports whether err means that the database couldnt be reached or is shutting down, rather than that the query itself failed.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	var pqErr *pq.Error
+
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.As(err, &netErr):
+		return true
+	case errors.As(err, &pqErr):
+		// admin_shutdown, crash_shutdown and cannot_connect_now.
+		return pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	default:
+		return false
+	}
+}
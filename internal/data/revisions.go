@@ -0,0 +1,180 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Define constants for the action which produced a movie revision.
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionPurge   = "purge"
+	RevisionMerge   = "merge"
+)
+
+// A MovieRevision holds the full state of a movie at a specific version, along with the action which produced it, the user who performed that action and
+// when it happened. The "delete" and "purge" revisions hold the state of the movie at the moment it was trashed or permanently deleted, and "merge"
+// revisions are recorded for both movies when one is merged into another. Revisions recorded before release dates and external IDs were kept have nil
+// ReleaseDates and ExternalIDs on the movie, while later ones have empty maps when the movie had none.
+type MovieRevision struct {
+	MovieID   int64     `json:"movie_id"`
+	Version   int32     `json:"version"`
+	Action    string    `json:"action"`
+	UserID    int64     `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Movie     Movie     `json:"movie"`
+}
+
+// The MovieRevisionModel struct type wraps a sql.DB connection pool. Revisions are written by the MovieModel as part of each insert, update and delete, so this
+// model only reads them.
+type MovieRevisionModel struct {
+	DB      DBTX
+	ReadDB  DBTX
+	Timeout time.Duration
+}
+
+// GetAllForMovie() returns a page of revisions for a movie, newest first. Only the Page and PageSize fields of the filters are used.
+func (m MovieRevisionModel) GetAllForMovie(ctx context.Context, movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := `
+        SELECT count(*) OVER(), movie_id, version, action, COALESCE(user_id, 0), created_at, title, year, runtime, genres, status, release_dates, external_ids
+        FROM movie_revisions
+        WHERE movie_id = $1
+        ORDER BY id DESC
+        LIMIT $2 OFFSET $3`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		var (
+			revision                  MovieRevision
+			releaseDates, externalIDs []byte
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Action,
+			&revision.UserID,
+			&revision.CreatedAt,
+			&revision.Movie.Title,
+			&revision.Movie.Year,
+			&revision.Movie.Runtime,
+			pq.Array(&revision.Movie.Genres),
+			&revision.Movie.Status,
+			&releaseDates,
+			&externalIDs,
+		)
+		if err != nil {
+			return nil, Metadata{}, contextError(ctx, err)
+		}
+
+		err = revision.decodeDetails(releaseDates, externalIDs)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revision.Movie.ID = revision.MovieID
+		revision.Movie.Version = revision.Version
+
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, contextError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// Get() returns the revision which holds the state of a movie at a specific version, or ErrRecordNotFound.
+func (m MovieRevisionModel) Get(ctx context.Context, movieID int64, version int32) (*MovieRevision, error) {
+	if movieID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT movie_id, version, action, COALESCE(user_id, 0), created_at, title, year, runtime, genres, status, release_dates, external_ids
+        FROM movie_revisions
+        WHERE movie_id = $1 AND version = $2 AND action NOT IN ('delete', 'purge')`
+
+	var (
+		revision                  MovieRevision
+		releaseDates, externalIDs []byte
+	)
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := m.ReadDB.QueryRowContext(ctx, query, movieID, version).Scan(
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Action,
+		&revision.UserID,
+		&revision.CreatedAt,
+		&revision.Movie.Title,
+		&revision.Movie.Year,
+		&revision.Movie.Runtime,
+		pq.Array(&revision.Movie.Genres),
+		&revision.Movie.Status,
+		&releaseDates,
+		&externalIDs,
+	)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = revision.decodeDetails(releaseDates, externalIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Movie.ID = revision.MovieID
+	revision.Movie.Version = revision.Version
+
+	return &revision, nil
+}
+
+// decodeDetails sets the release dates and external IDs of the movie in a revision from the JSON objects in the release_dates and external_ids columns,
+// leaving them nil if the columns are NULL.
+func (revision *MovieRevision) decodeDetails(releaseDates, externalIDs []byte) error {
+	if releaseDates != nil {
+		err := json.Unmarshal(releaseDates, &revision.Movie.ReleaseDates)
+		if err != nil {
+			return err
+		}
+	}
+
+	if externalIDs != nil {
+		err := json.Unmarshal(externalIDs, &revision.Movie.ExternalIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
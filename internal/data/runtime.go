@@ -1,21 +1,65 @@
 package data
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
-//Define and error that our UnmarshalJSON() method can return if we are unable to parse or convert the JSON string successfully
-var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
+// Define the errors that parsing a runtime can fail with. Their messages are written to be shown to clients after the name of the field, in the same way as
+// validation errors.
+var (
+	ErrInvalidRuntimeFormat = errors.New(`must be a whole number of minutes, or a duration like "102 mins", "1h 42m" or "PT1H42M"`)
+	ErrNegativeRuntime      = errors.New("must not be negative")
+	ErrRuntimeOutOfRange    = fmt.Errorf("must not be more than %d minutes", math.MaxInt32)
+)
+
+// A RuntimeError reports a runtime which couldnt be parsed, along with the reason, which is one of the errors above. Use errors.Is() to check the reason.
+type RuntimeError struct {
+	Value string
+	Err   error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Define the formats that runtimes can be written in. RuntimeText ("102 mins") is the default, RuntimeMinutes is a plain number of minutes for machine
+// clients, and RuntimeISO8601 is an ISO 8601 duration ("PT1H42M").
+const (
+	RuntimeText    = "text"
+	RuntimeMinutes = "minutes"
+	RuntimeISO8601 = "iso8601"
+)
+
+// RuntimeFormats lists the supported runtime formats.
+var RuntimeFormats = []string{RuntimeText, RuntimeMinutes, RuntimeISO8601}
+
+var (
+	// runtimeDurationRX matches runtimes in hours and minutes, with or without the units spelt out, like "102 mins", "1h 42m" or "2 hours". At least one
+	// of the parts must be present, which ParseRuntime() checks.
+	runtimeDurationRX = regexp.MustCompile(`^(?:(\d+)\s*h(?:ours?|rs?)?)?\s*(?:(\d+)\s*m(?:in(?:ute)?s?)?)?$`)
+
+	// runtimeISO8601RX matches ISO 8601 durations in hours and minutes, like "PT1H42M" or "PT102M".
+	runtimeISO8601RX = regexp.MustCompile(`^pt(?:(\d+)h)?(?:(\d+)m)?$`)
+)
 
 // Declare a custom Runtime type, which has the underlying type int32(the same as our movie struct field)
 //
 type Runtime int32
 
 // Implement a MarshalJSON() method on the Runtime type so that it satisfies the json.Marshaler interface. This should return the JSON-encoded value for he movie
-// runtime(in our case it will return a string in the format "<runtime> mins")
+// runtime(in our case it will return a string in the format "<runtime> mins"). Movies can be written with their runtime in one of the other formats
+// instead, with Movie.SetRuntimeFormat().
 //
 func (r Runtime) MarshalJSON() ([]byte, error) {
 	// Generate a string containing the movie runtime in the required format.
@@ -31,36 +75,171 @@ func (r Runtime) MarshalJSON() ([]byte, error) {
 // Implement a UnmarshalJSON() method on the Runtime type so that it satisfies the json.Unmarshaller interface
 // IMPORTANT : Because UnmarshalJSON() needs to modify the receiver (our Runtime type), we must use a pointer receiver
 //for this to work correctly. Otherwise, we will only be modifying a copy(which is then discarded when this method returns)
-
+//
+// The runtime can be a JSON number of minutes or a string in any of the formats accepted by ParseRuntime(). A JSON null leaves the runtime unchanged, as
+// for the built-in types.
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
-	// we expect that the incoming JSSON will be a string in the format "<runtime> mins", and the first thing we need to do is
-	// remove the surrounding double-quotes from this string. If we can't unquote it, then we return ErrInvalidRuntimeFormat error.
-	//
-	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	s := string(jsonValue)
+
+	if s == "null" {
+		return nil
+	}
+
+	// A string has to be unquoted before it is parsed. If we can't unquote it, then we return ErrInvalidRuntimeFormat error.
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return &RuntimeError{Value: s, Err: ErrInvalidRuntimeFormat}
+		}
+		s = unquoted
+	}
+
+	// Parse the runtime, and assign the result to the receiver. Note that we use the * operator to dereference the receiver
+	//(which is a pointer to a Runtime type) in order to set the underlying value of the pointer
+	i, err := ParseRuntime(s)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return &RuntimeError{Value: string(jsonValue), Err: errors.Unwrap(err)}
+	}
+
+	*r = i
+
+	return nil
+}
+
+// ParseRuntime() parses a runtime, returning a *RuntimeError if it can't. It is used to read runtimes from sources other than JSON too, like the cells of a
+// CSV file and the query string. Case and surrounding spaces are ignored, and the runtime can be given as:
+//
+//   - a whole number of minutes, like "102"
+//   - minutes and hours, with the units abbreviated or spelt out, like "102 mins", "1h 42m" or "2 hours"
+//   - an ISO 8601 duration in hours and minutes, like "PT102M" or "PT1H42M"
+func ParseRuntime(s string) (Runtime, error) {
+	value := s
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	// Check for a minus sign up front, so that a negative runtime which is otherwise well-formed gets a more helpful error than a bad format.
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimSpace(strings.TrimPrefix(s, "-"))
+
+	var hours, minutes string
+
+	if parts := runtimeISO8601RX.FindStringSubmatch(s); parts != nil {
+		hours, minutes = parts[1], parts[2]
+	} else if parts := runtimeDurationRX.FindStringSubmatch(s); parts != nil {
+		hours, minutes = parts[1], parts[2]
+	} else if _, err := strconv.ParseUint(s, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		minutes = s
 	}
 
-	// Spplit the string to isolate the part containing the number.
-	parts := strings.Split(unquotedJSONValue, " ")
+	if hours == "" && minutes == "" {
+		return 0, &RuntimeError{Value: value, Err: ErrInvalidRuntimeFormat}
+	}
+	if negative {
+		return 0, &RuntimeError{Value: value, Err: ErrNegativeRuntime}
+	}
 
-	//Sanity check the parts of the string to make sure it was in the expected format
-	// If it is not, we return the ErrInvalidFormat error again.
-	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+	// Add the parts up in an int64, checking that each stays within the range of an int32 so that the sum can't overflow either.
+	total := int64(0)
+	for _, part := range []struct {
+		digits string
+		scale  int64
+	}{{hours, 60}, {minutes, 1}} {
+		if part.digits == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(part.digits, 10, 64)
+		if err != nil || n > math.MaxInt32/part.scale {
+			return 0, &RuntimeError{Value: value, Err: ErrRuntimeOutOfRange}
+		}
+		total += n * part.scale
 	}
 
-	// Otherwise, parse the string containing the number into an int32. Again, if this fails return the ErrInvalidRuntimeFormat error.
-	i, err := strconv.ParseInt(parts[0], 10, 32)
-	if err != nil {
-		return ErrInvalidRuntimeFormat
+	if total > math.MaxInt32 {
+		return 0, &RuntimeError{Value: value, Err: ErrRuntimeOutOfRange}
 	}
 
-	//convert the int32 to a Runtime type and assign this to the receiver. Note that we use the * operator to dereference the receiver
-	//(which is a pointer to a Runtime type) in order to set the underlying value of the pointer
+	return Runtime(total), nil
+}
+
+// Format returns the runtime in the given format, as a value to be encoded to JSON or written with fmt. An unknown format is taken to be RuntimeText.
+func (r Runtime) Format(format string) interface{} {
+	switch format {
+	case RuntimeMinutes:
+		return int32(r)
+	case RuntimeISO8601:
+		switch {
+		case r%60 == 0 && r != 0:
+			return fmt.Sprintf("PT%dH", r/60)
+		case r >= 60:
+			return fmt.Sprintf("PT%dH%dM", r/60, r%60)
+		default:
+			return fmt.Sprintf("PT%dM", r)
+		}
+	default:
+		return fmt.Sprintf("%d mins", r)
+	}
+}
+
+// SetRuntimeFormat sets the format that the movie's runtime is written in when it is encoded to JSON.
+func (movie *Movie) SetRuntimeFormat(format string) {
+	movie.runtimeFormat = format
+}
 
-	*r = Runtime(i)
+// MarshalJSON encodes the movie with its runtime in the format set with SetRuntimeFormat(), which is RuntimeText unless it has been set.
+func (movie Movie) MarshalJSON() ([]byte, error) {
+	// The plainMovie type has the same fields as Movie but not this method, so that encoding it doesnt recurse.
+	type plainMovie Movie
 
-	return nil
+	if movie.runtimeFormat == "" || movie.runtimeFormat == RuntimeText {
+		return json.Marshal(plainMovie(movie))
+	}
+
+	// The Runtime field here is shallower than the one in the embedded plainMovie, so it takes its place in the output.
+	var runtime interface{}
+	if movie.Runtime != 0 {
+		runtime = movie.Runtime.Format(movie.runtimeFormat)
+	}
 
+	return json.Marshal(struct {
+		plainMovie
+		Runtime interface{} `json:"runtime,omitempty"`
+	}{plainMovie(movie), runtime})
+}
+
+// SetRuntimeFormat sets the runtime format of every movie held in v, which can be a pointer to a movie or any value (like a response envelope) which holds
+// movies by pointer, or in slices or structs reached through pointers. Movies which cant be changed in place are left as they are.
+func SetRuntimeFormat(v interface{}, format string) {
+	setRuntimeFormat(reflect.ValueOf(v), format)
+}
+
+var movieType = reflect.TypeOf(Movie{})
+
+func setRuntimeFormat(v reflect.Value, format string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			setRuntimeFormat(v.Elem(), format)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			setRuntimeFormat(v.Index(i), format)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			setRuntimeFormat(iter.Value(), format)
+		}
+	case reflect.Struct:
+		if v.Type() == movieType {
+			if v.CanAddr() {
+				v.Addr().Interface().(*Movie).SetRuntimeFormat(format)
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				setRuntimeFormat(v.Field(i), format)
+			}
+		}
+	}
 }
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Runtime
+		err  error
+	}{
+		{name: "string of minutes", json: `"102"`, want: 102},
+		{name: "number of minutes", json: `102`, want: 102},
+		{name: "text", json: `"102 mins"`, want: 102},
+		{name: "hours and minutes", json: `"1h 42m"`, want: 102},
+		{name: "hours and minutes spelt out", json: `"1 hour 42 minutes"`, want: 102},
+		{name: "hours", json: `"2 hours"`, want: 120},
+		{name: "ISO 8601", json: `"PT1H42M"`, want: 102},
+		{name: "ISO 8601 lower case", json: `" pt102m "`, want: 102},
+		{name: "ISO 8601 hours", json: `"PT2H"`, want: 120},
+		{name: "zero", json: `0`, want: 0},
+		{name: "ISO 8601 without parts", json: `"PT"`, err: ErrInvalidRuntimeFormat},
+		{name: "empty", json: `""`, err: ErrInvalidRuntimeFormat},
+		{name: "words", json: `"a long time"`, err: ErrInvalidRuntimeFormat},
+		{name: "fraction", json: `1.5`, err: ErrInvalidRuntimeFormat},
+		{name: "negative text", json: `"-5 mins"`, err: ErrNegativeRuntime},
+		{name: "negative number", json: `-5`, err: ErrNegativeRuntime},
+		{name: "negative ISO 8601", json: `"-PT5M"`, err: ErrNegativeRuntime},
+		{name: "too many minutes", json: `"99999999999"`, err: ErrRuntimeOutOfRange},
+		{name: "too many minutes as a number", json: `99999999999`, err: ErrRuntimeOutOfRange},
+		{name: "more minutes than fit in int64", json: `"99999999999999999999"`, err: ErrRuntimeOutOfRange},
+		{name: "too many hours", json: `"PT35791395H"`, err: ErrRuntimeOutOfRange},
+		{name: "hours and minutes which overflow together", json: `"35791394h 9999m"`, err: ErrRuntimeOutOfRange},
+		{name: "largest runtime", json: strconv.Itoa(math.MaxInt32), want: math.MaxInt32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Runtime
+			err := json.Unmarshal([]byte(tt.json), &got)
+
+			if tt.err != nil {
+				var runtimeError *RuntimeError
+				if !errors.As(err, &runtimeError) || !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v; want a *RuntimeError for %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeUnmarshalJSONNull(t *testing.T) {
+	// As for the built-in types, null leaves the value as it was.
+	got := Runtime(102)
+
+	err := json.Unmarshal([]byte("null"), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 102 {
+		t.Errorf("got %d; want 102", got)
+	}
+
+	var input struct {
+		Runtime *Runtime `json:"runtime"`
+	}
+
+	err = json.Unmarshal([]byte(`{"runtime": null}`), &input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.Runtime != nil {
+		t.Errorf("got %d; want nil", *input.Runtime)
+	}
+}
+
+func TestRuntimeFormat(t *testing.T) {
+	tests := []struct {
+		runtime Runtime
+		format  string
+		want    interface{}
+	}{
+		{102, RuntimeText, "102 mins"},
+		{102, "", "102 mins"},
+		{102, RuntimeMinutes, int32(102)},
+		{102, RuntimeISO8601, "PT1H42M"},
+		{120, RuntimeISO8601, "PT2H"},
+		{59, RuntimeISO8601, "PT59M"},
+		{0, RuntimeISO8601, "PT0M"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.runtime.Format(tt.format); got != tt.want {
+			t.Errorf("%d in %q: got %#v; want %#v", tt.runtime, tt.format, got, tt.want)
+		}
+	}
+}
+
+// TestRuntimeFormatRoundTrip checks that a movie written in each runtime format can be read back with the same runtime.
+func TestRuntimeFormatRoundTrip(t *testing.T) {
+	for _, format := range RuntimeFormats {
+		for _, runtime := range []Runtime{1, 59, 60, 102, 120, math.MaxInt32} {
+			movie := Movie{ID: 1, Title: "Moana", Runtime: runtime}
+			movie.SetRuntimeFormat(format)
+
+			js, err := json.Marshal(movie)
+			if err != nil {
+				t.Fatalf("%s %d: %v", format, runtime, err)
+			}
+
+			var got struct {
+				Runtime Runtime `json:"runtime"`
+			}
+
+			err = json.Unmarshal(js, &got)
+			if err != nil {
+				t.Fatalf("%s %d: reading %s: %v", format, runtime, js, err)
+			}
+			if got.Runtime != runtime {
+				t.Errorf("%s: got %d from %s; want %d", format, got.Runtime, js, runtime)
+			}
+		}
+	}
+}
+
+func TestRuntimeUnmarshalJSONBadString(t *testing.T) {
+	// encoding/json checks the syntax before calling UnmarshalJSON(), so call it directly with a string which can't be unquoted.
+	var got Runtime
+
+	err := got.UnmarshalJSON([]byte(`"102`))
+	if !errors.Is(err, ErrInvalidRuntimeFormat) {
+		t.Errorf("got error %v; want ErrInvalidRuntimeFormat", err)
+	}
+}
+
+func TestParseRuntimeError(t *testing.T) {
+	_, err := ParseRuntime(" -5 mins ")
+
+	var runtimeError *RuntimeError
+	if !errors.As(err, &runtimeError) {
+		t.Fatalf("got error %v; want a *RuntimeError", err)
+	}
+	if runtimeError.Value != " -5 mins " {
+		t.Errorf("got value %q; want the runtime as given", runtimeError.Value)
+	}
+	if err.Error() != ErrNegativeRuntime.Error() {
+		t.Errorf("got message %q; want %q", err.Error(), ErrNegativeRuntime.Error())
+	}
+}
@@ -0,0 +1,197 @@
+package data
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// The title search modes. SearchWords matches titles containing every word of the search, SearchPrefix also matches words which only start with the last
+// (or any) word typed so far, for type-ahead, and SearchFuzzy matches titles which are similar to the search by trigrams, so that typos still find something.
+const (
+	SearchWords  = "words"
+	SearchPrefix = "prefix"
+	SearchFuzzy  = "fuzzy"
+)
+
+// SearchModes lists the supported title search modes.
+var SearchModes = []string{SearchWords, SearchPrefix, SearchFuzzy}
+
+// fuzzyThreshold is the minimum word similarity for a fuzzy match. It is the default value of pg_trgm.word_similarity_threshold, which the <% operator uses.
+const fuzzyThreshold = 0.6
+
+// prefixQuery returns a tsquery which matches titles containing words starting with every one of the search terms, such as "godf:* & par:*". The terms are
+// split with searchTerms(), so they only contain letters and digits and can't inject tsquery syntax.
+func prefixQuery(title string) string {
+	terms := searchTerms(title)
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// HighlightTitle() returns the title with the words which matched the search wrapped in <b> and </b> tags, in the same way as ts_headline() marks them.
+// Titles are short, so the snippet is always the whole title. It is worked out here rather than in the database so that it also works for fuzzy matches,
+// which ts_headline() can't mark, and so that every storage backend highlights in the same way. The result is meant to be used as HTML, so the title itself
+// is HTML-escaped and the tags are the only markup in it.
+func HighlightTitle(title, search, mode string) string {
+	terms := searchTerms(search)
+	if len(terms) == 0 {
+		return html.EscapeString(title)
+	}
+
+	var b strings.Builder
+	word := []rune{}
+
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if matchesTerm(strings.ToLower(string(word)), terms, mode) {
+			b.WriteString("<b>" + html.EscapeString(string(word)) + "</b>")
+		} else {
+			b.WriteString(html.EscapeString(string(word)))
+		}
+		word = word[:0]
+	}
+
+	for _, r := range title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+
+	return b.String()
+}
+
+// matchesTerm reports whether a (lowercase) word from a title matches any of the search terms in the given mode.
+func matchesTerm(word string, terms []string, mode string) bool {
+	for _, term := range terms {
+		switch mode {
+		case SearchPrefix:
+			if strings.HasPrefix(word, term) {
+				return true
+			}
+		case SearchFuzzy:
+			if wordSimilarity(term, word) >= fuzzyThreshold {
+				return true
+			}
+		default:
+			if word == term {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trigrams returns the set of trigrams in s in the same way as pg_trgm: each word is lowercased and padded with two spaces in front and one behind, so
+// "cat" gives "  c", " ca", "cat" and "at ".
+func trigrams(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range searchTerms(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// wordSimilarity approximates pg_trgm's word_similarity(search, title): the proportion of the trigrams in the search which also appear in the title, so a
+// search which is a slightly misspelled word of a longer title still scores highly.
+func wordSimilarity(search, title string) float64 {
+	s := trigrams(search)
+	if len(s) == 0 {
+		return 0
+	}
+
+	t := trigrams(title)
+
+	shared := 0
+	for trigram := range s {
+		if t[trigram] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(s))
+}
+
+// similarity approximates pg_trgm's similarity(a, b): the number of trigrams that the strings share, divided by the number of distinct trigrams in either.
+func similarity(a, b string) float64 {
+	x, y := trigrams(a), trigrams(b)
+
+	shared := 0
+	for trigram := range x {
+		if y[trigram] {
+			shared++
+		}
+	}
+
+	total := len(x) + len(y) - shared
+	if total == 0 {
+		return 0
+	}
+
+	return float64(shared) / float64(total)
+}
+
+// searchRank scores how well a title matches a search in the given mode, for sort=relevance in the in-memory models. The scores aren't the same as
+// ts_rank() or word_similarity() in PostgreSQL, but they order the matches in much the same way: titles where the matched words make up more of the title
+// come first.
+func searchRank(title, search, mode string) float64 {
+	if mode == SearchFuzzy {
+		return wordSimilarity(search, title)
+	}
+
+	words := searchTerms(title)
+	if len(words) == 0 {
+		return 0
+	}
+
+	terms := searchTerms(search)
+
+	matched := 0
+	for _, word := range words {
+		if matchesTerm(word, terms, mode) {
+			matched++
+		}
+	}
+
+	return float64(matched) / float64(len(words))
+}
+
+// matchTitle reports whether a title matches a search in the given mode, in the same way as the conditions built by movieFilterQuery().
+func matchTitle(title, search, mode string) bool {
+	terms := searchTerms(search)
+	if len(terms) == 0 {
+		return true
+	}
+
+	if mode == SearchFuzzy {
+		return wordSimilarity(search, title) >= fuzzyThreshold
+	}
+
+	words := searchTerms(title)
+	for _, term := range terms {
+		if !anyMatches(words, term, mode) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyMatches reports whether any of the words matches the search term in the given mode.
+func anyMatches(words []string, term string, mode string) bool {
+	for _, word := range words {
+		if matchesTerm(word, []string{term}, mode) {
+			return true
+		}
+	}
+	return false
+}
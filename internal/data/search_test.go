@@ -0,0 +1,30 @@
+package data
+
+import "testing"
+
+func TestHighlightTitle(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		search string
+		mode   string
+		want   string
+	}{
+		{"words", "The Godfather Part II", "godfather part", SearchWords, "The <b>Godfather</b> <b>Part</b> II"},
+		{"whole words only", "The Godfather", "god", SearchWords, "The Godfather"},
+		{"prefix", "The Godfather Part II", "god pa", SearchPrefix, "The <b>Godfather</b> <b>Part</b> II"},
+		{"fuzzy", "The Godfather", "godfathr", SearchFuzzy, "The <b>Godfather</b>"},
+		{"no terms", "Up", "!!", SearchWords, "Up"},
+		{"escaped separators", `Tom & Jerry <3 "Cats"`, "jerry cats", SearchWords, `Tom &amp; <b>Jerry</b> &lt;3 &#34;<b>Cats</b>&#34;`},
+		{"escaped without terms", `<script>alert("x")</script>`, "", SearchWords, `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;`},
+		{"escaped without matches", `Fast & Furious`, "slow", SearchWords, `Fast &amp; Furious`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HighlightTitle(tt.title, tt.search, tt.mode); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/myk4040okothogodo/greenlight/internal/validator"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// languageRX matches the language tags which translations can be stored under: a two or three letter language, optionally followed by a four letter script
+// and then a two letter or three digit region, like "en", "pt-BR" or "zh-Hant-TW".
+var languageRX = regexp.MustCompile(`^([a-zA-Z]{2,3})(-[a-zA-Z]{4})?(-[a-zA-Z]{2}|-[0-9]{3})?$`)
+
+// A Translation holds the title (and optionally the synopsis) of a movie in another language.
+type Translation struct {
+	MovieID  int64  `json:"-"`
+	Language string `json:"language"`
+	Title    string `json:"title"`
+	Synopsis string `json:"synopsis,omitempty"`
+}
+
+// NormalizeLanguage returns a language tag in its canonical case (like "pt-BR" for "PT-br"), and false if it isnt a tag that translations can be stored
+// under.
+func NormalizeLanguage(tag string) (string, bool) {
+	parts := languageRX.FindStringSubmatch(tag)
+	if parts == nil {
+		return "", false
+	}
+
+	normalized := strings.ToLower(parts[1])
+	if parts[2] != "" {
+		normalized += "-" + strings.ToUpper(parts[2][1:2]) + strings.ToLower(parts[2][2:])
+	}
+	if parts[3] != "" {
+		normalized += strings.ToUpper(parts[3])
+	}
+
+	return normalized, true
+}
+
+// baseLanguage returns the language subtag of a normalized language tag, like "pt" for "pt-BR".
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return base
+}
+
+func ValidateTranslation(v *validator.Validator, translation *Translation) {
+	_, ok := NormalizeLanguage(translation.Language)
+	v.Check(ok, "language", "must be a language tag like en or pt-BR")
+
+	v.Check(translation.Title != "", "title", "must be provided")
+	v.Check(len(translation.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(len(translation.Synopsis) <= 5000, "synopsis", "must not be more than 5000 bytes long")
+}
+
+// BestTranslation returns the translation which best suits the languages that a client prefers, most preferred first, or nil if none of them do. A
+// translation into exactly the language asked for is best, and otherwise one into the same base language, so that "pt" finds a "pt-BR" translation and
+// "en-GB" finds an "en" one.
+func BestTranslation(translations []*Translation, preferred []string) *Translation {
+	for _, language := range preferred {
+		var fallback *Translation
+
+		for _, translation := range translations {
+			if translation.Language == language {
+				return translation
+			}
+			if fallback == nil && baseLanguage(translation.Language) == baseLanguage(language) {
+				fallback = translation
+			}
+		}
+
+		if fallback != nil {
+			return fallback
+		}
+	}
+
+	return nil
+}
+
+// Localize replaces the title of the movie with the translation, keeping the original title in OriginalTitle.
+func (movie *Movie) Localize(translation *Translation) {
+	movie.OriginalTitle = movie.Title
+	movie.Title = translation.Title
+	movie.Language = translation.Language
+	movie.Synopsis = translation.Synopsis
+}
+
+// The TranslationModel struct type wraps a sql.DB connection pool, along with the maximum time that any single query is allowed to run for.
+type TranslationModel struct {
+	DB      DBTX
+	ReadDB  DBTX
+	Timeout time.Duration
+}
+
+// Put() adds a translation of a movie, or replaces the movie's existing translation into the same language. It returns ErrRecordNotFound if the movie doesnt
+// exist or is in the trash.
+func (m TranslationModel) Put(ctx context.Context, translation *Translation) error {
+	query := `
+        INSERT INTO movie_translations (movie_id, language, title, synopsis)
+        SELECT id, $2, $3, $4
+        FROM movies
+        WHERE id = $1 AND deleted_at IS NULL
+        ON CONFLICT (movie_id, language) DO UPDATE SET title = EXCLUDED.title, synopsis = EXCLUDED.synopsis
+        RETURNING movie_id`
+
+	args := []interface{}{translation.MovieID, translation.Language, translation.Title, translation.Synopsis}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var id int64
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&id)
+	err = contextError(ctx, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllForMovies() returns the translations of each of the movies, keyed by movie id and ordered by language.
+func (m TranslationModel) GetAllForMovies(ctx context.Context, movieIDs []int64) (map[int64][]*Translation, error) {
+	translations := make(map[int64][]*Translation)
+	if len(movieIDs) == 0 {
+		return translations, nil
+	}
+
+	query := `
+        SELECT movie_id, language, title, synopsis
+        FROM movie_translations
+        WHERE movie_id = ANY($1)
+        ORDER BY movie_id, language`
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.ReadDB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var translation Translation
+
+		err := rows.Scan(&translation.MovieID, &translation.Language, &translation.Title, &translation.Synopsis)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+
+		translations[translation.MovieID] = append(translations[translation.MovieID], &translation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return translations, nil
+}
+
+// Delete() removes the translation of a movie into a language, or returns ErrRecordNotFound.
+func (m TranslationModel) Delete(ctx context.Context, movieID int64, language string) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM movie_translations WHERE movie_id = $1 AND language = $2", movieID, language)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"sync/atomic"
+	"time"
+)
+
+// maxTxAttempts is the number of times WithTx() runs a transaction which keeps failing with a serialization failure or deadlock before giving up.
+const maxTxAttempts = 3
+
+// txRetryDelay is how long WithTx() waits before retrying a transaction. The wait grows with each attempt, so that the transactions which conflicted are
+// less likely to conflict again.
+const txRetryDelay = 20 * time.Millisecond
+
+// DBTX is the set of methods shared by a *sql.DB connection pool and a *sql.Tx transaction. The PostgreSQL models run their queries through it, so that the
+// same model works both on its own and inside a transaction started by WithTx().
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// A dbTx is a transaction started by beginTx(), which is either a real transaction or a savepoint in one.
+type dbTx interface {
+	DBTX
+	Commit() error
+	Rollback() error
+}
+
+// beginTx starts a transaction on db. When db is already a transaction (because the model is being used inside WithTx()) it sets a savepoint instead, so
+// that the model can still roll back its own changes without ending the transaction around it. The options only apply to real transactions.
+func beginTx(ctx context.Context, db DBTX, opts *sql.TxOptions) (dbTx, error) {
+	switch db := db.(type) {
+	case *sql.DB:
+		return db.BeginTx(ctx, opts)
+	case *sql.Tx:
+		return newSavepoint(ctx, db)
+	default:
+		return nil, fmt.Errorf("cannot begin a transaction on %T", db)
+	}
+}
+
+// lastSavepoint numbers savepoints, so that nested ones get different names.
+var lastSavepoint int64
+
+// A savepoint stands in for a transaction inside another transaction. Committing it releases the savepoint and rolling it back undoes the changes made
+// since it was set. Like sql.Tx, it can only be committed or rolled back once, and further calls return sql.ErrTxDone.
+type savepoint struct {
+	*sql.Tx
+	name string
+	done bool
+}
+
+func newSavepoint(ctx context.Context, tx *sql.Tx) (*savepoint, error) {
+	sp := &savepoint{Tx: tx, name: fmt.Sprintf("sp_%d", atomic.AddInt64(&lastSavepoint, 1))}
+
+	_, err := tx.ExecContext(ctx, "SAVEPOINT "+sp.name)
+	if err != nil {
+		return nil, err
+	}
+
+	return sp, nil
+}
+
+func (sp *savepoint) Commit() error {
+	return sp.end("RELEASE SAVEPOINT ")
+}
+
+func (sp *savepoint) Rollback() error {
+	return sp.end("ROLLBACK TO SAVEPOINT ")
+}
+
+func (sp *savepoint) end(statement string) error {
+	if sp.done {
+		return sql.ErrTxDone
+	}
+	sp.done = true
+
+	_, err := sp.Tx.Exec(statement + sp.name)
+	return err
+}
+
+// WithTx() runs fn as a single unit of work, passing it a copy of the models which all run in the same transaction. If fn returns an error, or the
+// transaction can't be committed, then none of its changes are kept and the error is returned. With PostgreSQL, the transaction is serializable and is
+// retried from the start (up to maxTxAttempts times) when it fails with a serialization failure or deadlock, so fn may be called more than once and must
+// not have side effects outside the models. Calling WithTx() on models which are already in a transaction just runs fn in that transaction.
+func (m Models) WithTx(ctx context.Context, fn func(Models) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+
+	// When the models are cached, the models in the transaction are wrapped too, but skip the cache and put off their invalidations until the
+	// transaction has finished.
+	if m.cache != nil {
+		tx := &cacheTx{}
+		defer m.cache.commit(tx)
+
+		uncached := fn
+		fn = func(txModels Models) error {
+			return uncached(m.cache.wrap(txModels, tx))
+		}
+	}
+
+	if m.memory != nil {
+		return m.memory.withTx(ctx, func() error {
+			txModels := m
+			if m.cache != nil {
+				txModels = m.cache.base
+			}
+			txModels.inTx = true
+			return fn(txModels)
+		})
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := m.runTx(ctx, fn)
+		if err == nil || attempt == maxTxAttempts || !isRetryableTxError(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * txRetryDelay):
+		case <-ctx.Done():
+			return contextError(ctx, err)
+		}
+	}
+}
+
+// runTx runs one attempt of the transaction for WithTx().
+func (m Models) runTx(ctx context.Context, fn func(Models) error) error {
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	txModels := newModels(tx, tx, m.timeouts)
+	txModels.db = m.db
+	txModels.inTx = true
+
+	err = fn(txModels)
+	if err != nil {
+		return err
+	}
+
+	return contextError(ctx, tx.Commit())
+}
+
+// isRetryableTxError reports whether err is a serialization failure or a deadlock, after which PostgreSQL expects the transaction to be retried.
+func isRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
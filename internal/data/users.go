@@ -28,6 +28,9 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
+
+	// tokenExpiry is the expiry of the token that the user was looked up with, and is only set by GetForToken().
+	tokenExpiry time.Time
 }
 
 // Declare a new AnonymousUser variable
@@ -38,8 +41,6 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
-type MockUserModel struct{}
-
 // Create a custom password type which is a struct containing the plaintext and hashed versions of the password for a user. The plaintext field is a *pointer* to a
 // string, so that we are able to distinguish between a plaintext password not being present in the struct at all, versus a plaintext password which is an empty string "".
 
@@ -50,7 +51,8 @@ type password struct {
 
 // Create a UserModel struct which wraps the connection pool.
 type UserModel struct {
-	DB *sql.DB
+	DB      DBTX
+	Timeout time.Duration
 }
 
 // The set() method calculates the bcrypt hash of a plaintext password, ans stores both the hash and the plaintext  versions in the struct.
@@ -111,7 +113,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 // Insert a new record in the database for the user. Note that the id, created_at and version fields are all automatically generated by our database, so we use the returning
 // clause to read them into the User struct after the insert, in the same way that we did when creating a movie.
 //
-func (m UserModel) Insert(user *User) error {
+func (m UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
         INSERT INTO users (name, email, password_hash, activated)
         VALUES ($1, $2, $3, $4)
@@ -119,13 +121,14 @@ func (m UserModel) Insert(user *User) error {
 
 	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// If the table already contains a record with this email address, then when we try to perform the insert thea will be a violationof the UNIQUE "users_email_key"
 	// constraint that we set up in the previous chapter. We check for this error specifically, and return custom ErrDuplicateEmail error instead.
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err = contextError(ctx, err)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -140,7 +143,7 @@ func (m UserModel) Insert(user *User) error {
 // Retrieve the User details from the database based on the users email address. Because we have a UNIQUE constraint on the email column, this SQL query will omly return
 // one record (or none at all, in which case we return a ErrRecordNotFound error)
 //
-func (m UserModel) GetByEmail(email string) (*User, error) {
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
         SELECT id, created_at, name, email, password_hash, activated, version
         FROM users
@@ -148,7 +151,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
@@ -160,6 +163,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Activated,
 		&user.Version,
 	)
+	err = contextError(ctx, err)
 
 	if err != nil {
 		switch {
@@ -177,7 +181,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 // originally
 //
 //
-func (m UserModel) Update(user *User) error {
+func (m UserModel) Update(ctx context.Context, user *User) error {
 	query := `
         UPDATE users 
         SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
@@ -193,10 +197,11 @@ func (m UserModel) Update(user *User) error {
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err = contextError(ctx, err)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -210,7 +215,7 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
-func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
 	//calculate the SHA-256 hash of the plaintext token provided by the client
 	//remember that this returns a byte *array* with length 32, not a slice.
 	//
@@ -219,7 +224,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// Set up the SQL query.
 	//
 	query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, tokens.expiry
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -235,7 +240,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := withTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Execute the query, scanning the return values into a User struct. If no matching record is found we return an ErrRecordNotFound error
@@ -248,7 +253,9 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.tokenExpiry,
 	)
+	err = contextError(ctx, err)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -261,19 +268,3 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// Return the matching user .
 	return &user, nil
 }
-
-func (u MockUserModel) Insert(user *User) error {
-	return nil
-}
-
-func (u MockUserModel) Get(id int64) (*User, error) {
-	return nil, nil
-}
-
-func (u MockUserModel) Update(user *User) error {
-	return nil
-}
-
-func (u MockUserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
-	return nil, nil
-}
@@ -0,0 +1,228 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+// The content types of the images which can be uploaded.
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	WebP = "image/webp"
+)
+
+// ContentTypes lists the supported content types.
+var ContentTypes = []string{JPEG, PNG, WebP}
+
+// extensions maps the supported content types to the file extensions which images of that type are stored with.
+var extensions = map[string]string{
+	JPEG: "jpg",
+	PNG:  "png",
+	WebP: "webp",
+}
+
+// Extension returns the file extension (without the dot) for a supported content type, or "" for any other type.
+func Extension(contentType string) string {
+	return extensions[contentType]
+}
+
+// TypeByExtension returns the content type for the file extension (without the dot) of a supported image type, or "" for any other extension.
+func TypeByExtension(ext string) string {
+	for contentType, e := range extensions {
+		if e == ext {
+			return contentType
+		}
+	}
+	return ""
+}
+
+var (
+	// ErrUnsupportedType is returned when the content of an upload isnt one of the supported image types, whatever the client said it was.
+	ErrUnsupportedType = errors.New("unsupported image type")
+
+	// ErrInvalidImage is returned when an upload looks like a supported image type but can't be decoded.
+	ErrInvalidImage = errors.New("invalid image")
+
+	// ErrTooManyPixels is returned for images larger than MaxPixels, which are refused before they are decoded so that a small, highly compressed file
+	// can't make us allocate an enormous bitmap.
+	ErrTooManyPixels = errors.New("image has too many pixels")
+)
+
+// MaxPixels is the largest number of pixels (width * height) accepted in an image.
+const MaxPixels = 25_000_000
+
+// An Info describes an uploaded image. The content type is sniffed from the data rather than trusted from the client.
+type Info struct {
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Inspect sniffs the type of the image in data and reads its dimensions without decoding the pixels.
+func Inspect(data []byte) (*Info, error) {
+	info := &Info{ContentType: http.DetectContentType(data)}
+
+	switch info.ContentType {
+	case JPEG, PNG:
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		info.Width, info.Height = config.Width, config.Height
+	case WebP:
+		width, height, err := webpSize(data)
+		if err != nil {
+			return nil, err
+		}
+		info.Width, info.Height = width, height
+	default:
+		return nil, ErrUnsupportedType
+	}
+
+	if info.Width < 1 || info.Height < 1 {
+		return nil, ErrInvalidImage
+	}
+	if info.Width*info.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	return info, nil
+}
+
+// CanResize reports whether thumbnails can be generated for images of the content type. The standard library has no WebP decoder, so WebP images are
+// stored as they are.
+func CanResize(contentType string) bool {
+	return contentType == JPEG || contentType == PNG
+}
+
+// Thumbnails decodes a JPEG or PNG image and writes a copy scaled down to each of the widths which is narrower than the image, in the same format, by
+// calling fn with the width and the encoded thumbnail. The aspect ratio is kept.
+func Thumbnails(data []byte, widths []int, fn func(width int, thumbnail []byte) error) error {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ErrInvalidImage
+	}
+
+	// Convert the image to RGBA once, so that the resizing can work on the pixel slice directly rather than through the (much slower) At() method.
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	for _, width := range widths {
+		if width >= bounds.Dx() {
+			continue
+		}
+
+		height := bounds.Dy() * width / bounds.Dx()
+		if height < 1 {
+			height = 1
+		}
+
+		var buf bytes.Buffer
+
+		err = encode(&buf, resize(rgba, width, height), format)
+		if err != nil {
+			return err
+		}
+
+		err = fn(width, buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encode(w io.Writer, img image.Image, format string) error {
+	if format == "png" {
+		return png.Encode(w, img)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+}
+
+// resize scales an image down with a box filter: each pixel of the result is the average of the block of source pixels which it covers. This gives good
+// results for the reductions used for thumbnails without needing anything beyond the standard library.
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := (y + 1) * srcHeight / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := (x + 1) * srcWidth / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			// The RGBA pixels are alpha-premultiplied, so averaging each channel separately is correct for transparent pixels too.
+			p := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			p[0] = uint8(r / n)
+			p[1] = uint8(g / n)
+			p[2] = uint8(b / n)
+			p[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// webpSize reads the dimensions of a WebP image from its header. A WebP file is a RIFF container whose first chunk is either "VP8 " (lossy), "VP8L"
+// (lossless) or "VP8X" (extended), and each stores the dimensions differently.
+func webpSize(data []byte) (int, int, error) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, ErrInvalidImage
+	}
+
+	switch string(data[12:16]) {
+	case "VP8 ":
+		// The frame header starts with a 3-byte frame tag and the start code 9d 01 2a, followed by the 14-bit width and height.
+		if data[23] != 0x9d || data[24] != 0x01 || data[25] != 0x2a {
+			return 0, 0, ErrInvalidImage
+		}
+		width := int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+		return width, height, nil
+	case "VP8L":
+		// After the 0x2f signature byte, the width and height minus one are packed into 14 bits each.
+		if data[20] != 0x2f {
+			return 0, 0, ErrInvalidImage
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int((bits>>14)&0x3fff) + 1, nil
+	case "VP8X":
+		// After 4 bytes of flags, the canvas width and height minus one are stored as 24-bit integers.
+		width := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+		height := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+		return width + 1, height + 1, nil
+	default:
+		return 0, 0, ErrInvalidImage
+	}
+}
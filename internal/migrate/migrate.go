@@ -0,0 +1,355 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockID is the key for the PostgreSQL advisory lock which is held while migrations run. Every instance of the application uses the same key, so if several
+// of them start at the same time only one applies migrations and the others wait for it to finish.
+const lockID int64 = 7_305_941_117_286_493
+
+var (
+	// ErrDirty is returned when a previous migration may have failed part-way through, and the schema needs to be checked (and repaired if need be) by hand
+	// and then forced to a version.
+	ErrDirty = errors.New("database schema is dirty, fix it manually and then use 'migrate force'")
+	// ErrNoChange is returned by Down() when there are no applied migrations to roll back.
+	ErrNoChange = errors.New("no migrations to roll back")
+)
+
+// Match file names in the format used by the migrate tool, like "000001_create_movies_table.up.sql".
+var fileRX = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// The Migration struct holds the up and down SQL for a single numbered migration.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// The MigrationStatus struct reports whether a single migration has been applied.
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	Applied bool
+}
+
+// The Status struct describes the current state of the database schema. A Version of 0 means that no migrations have been applied.
+type Status struct {
+	Version    int64
+	Dirty      bool
+	Migrations []MigrationStatus
+}
+
+// The Migrator type applies migrations to a database. The applied version is recorded in a schema_migrations table with the same layout as the one used by
+// the migrate tool, so databases which were set up with the tool carry on working.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New reads the migration files from fsys and returns a Migrator for them.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		matches := fileRX.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has more than one name", version)
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	m := &Migrator{db: db}
+	for _, migration := range byVersion {
+		m.migrations = append(m.migrations, *migration)
+	}
+
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return m, nil
+}
+
+// Up applies all pending migrations in order, returning the ones which were applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+
+			err := m.run(ctx, conn, migration.Up, version, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+			version = migration.Version
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the n most recently applied migrations, returning the ones which were rolled back.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+
+		// Find the position of the current version in the list of migrations.
+		i := len(m.migrations) - 1
+		for i >= 0 && m.migrations[i].Version > version {
+			i--
+		}
+		if i < 0 {
+			return ErrNoChange
+		}
+		if m.migrations[i].Version != version {
+			return fmt.Errorf("applied version %d has no migration file", version)
+		}
+
+		for ; i >= 0 && len(reverted) < n; i-- {
+			migration := m.migrations[i]
+
+			// Rolling back a migration leaves the schema at the previous version, or with no version at all once the first migration is rolled back.
+			var previous int64
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			err := m.run(ctx, conn, migration.Down, migration.Version, previous)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Force records the given version as applied and clears the dirty flag, without running any migrations. A version of 0 records that no migrations are applied.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version != 0 && !m.exists(version) {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return recordVersion(ctx, conn, version, false)
+	})
+}
+
+// Status returns the current schema version and whether each migration has been applied.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		version, dirty, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		status.Version = version
+		status.Dirty = dirty
+
+		for _, migration := range m.migrations {
+			status.Migrations = append(status.Migrations, MigrationStatus{
+				Version: migration.Version,
+				Name:    migration.Name,
+				Applied: migration.Version <= version,
+			})
+		}
+
+		return nil
+	})
+
+	return status, err
+}
+
+func (m *Migrator) exists(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// withLock runs fn on a dedicated connection while holding the migrations advisory lock. Advisory locks belong to a session, so the lock, the migrations and
+// the unlock all have to use the same connection rather than the pool.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID)
+	if err != nil {
+		return err
+	}
+
+	// Release the lock with a fresh context, so that it is still released if ctx has been cancelled.
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	_, err = conn.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version bigint  NOT NULL PRIMARY KEY,
+            dirty   boolean NOT NULL
+        )`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// currentVersion returns the applied version and dirty flag from the schema_migrations table.
+func (m *Migrator) currentVersion(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var version int64
+	var dirty bool
+
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return version, dirty, nil
+}
+
+// run executes the SQL for one migration, taking the schema from version from to version to. The new version is first recorded as dirty, and is only marked
+// clean in the same transaction as the migration, so that if the process dies part-way through the schema is left dirty. If the migration itself fails,
+// its transaction is rolled back and the previous version is recorded again, so a failed migration leaves no trace behind. The version is only left dirty
+// when we can't tell what happened, like when the commit fails or the previous version can't be recorded again.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, query string, from, to int64) error {
+	err := recordVersion(ctx, conn, to, true)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return restoreVersion(conn, from, err)
+	}
+	defer tx.Rollback()
+
+	// The files can contain several statements, which lib/pq runs together when the query has no parameters.
+	_, err = tx.ExecContext(ctx, query)
+	if err == nil {
+		err = setVersion(ctx, tx, to, false)
+	}
+	if err != nil {
+		tx.Rollback()
+		return restoreVersion(conn, from, err)
+	}
+
+	return tx.Commit()
+}
+
+// restoreVersion records the version from before a migration which failed and was rolled back, and returns the error it failed with. A fresh context is
+// used, as the migration may have failed because ctx was cancelled.
+func restoreVersion(conn *sql.Conn, version int64, err error) error {
+	restoreErr := recordVersion(context.Background(), conn, version, false)
+	if restoreErr != nil {
+		return fmt.Errorf("%w (and the schema was left dirty: %v)", err, restoreErr)
+	}
+	return err
+}
+
+// recordVersion replaces the version recorded in the schema_migrations table in a transaction of its own.
+func recordVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setVersion(ctx, tx, version, dirty)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setVersion replaces the version recorded in the schema_migrations table. Version 0 with dirty unset is recorded as an empty table, meaning that no
+// migrations are applied.
+func setVersion(ctx context.Context, tx *sql.Tx, version int64, dirty bool) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+
+	if version == 0 && !dirty {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)", version, dirty)
+	return err
+}
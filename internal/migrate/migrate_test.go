@@ -0,0 +1,406 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNew(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_add_index.up.sql":       {Data: []byte("up 10")},
+		"000010_add_index.down.sql":     {Data: []byte("down 10")},
+		"000002_create_movies.up.sql":   {Data: []byte("up 2")},
+		"000002_create_movies.down.sql": {Data: []byte("down 2")},
+		"3_no_down.up.sql":              {Data: []byte("up 3")},
+		"migrations.go":                 {Data: []byte("package migrations")},
+		"000004_notes.txt":              {Data: []byte("ignored")},
+	}
+
+	m, err := New(nil, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The migrations are in version order rather than name order, and files which arent migrations are ignored.
+	want := []Migration{
+		{Version: 2, Name: "create_movies", Up: "up 2", Down: "down 2"},
+		{Version: 3, Name: "no_down", Up: "up 3"},
+		{Version: 10, Name: "add_index", Up: "up 10", Down: "down 10"},
+	}
+	if !reflect.DeepEqual(m.migrations, want) {
+		t.Errorf("got migrations %+v; want %+v", m.migrations, want)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "version 0",
+			fsys: fstest.MapFS{"000000_start.up.sql": {}},
+		},
+		{
+			name: "two names for one version",
+			fsys: fstest.MapFS{"000001_one.up.sql": {}, "000001_other.down.sql": {}},
+		},
+		{
+			name: "version too large",
+			fsys: fstest.MapFS{"99999999999999999999_big.up.sql": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(nil, tt.fsys); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t, 1, 2, 3)
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, "up", applied, 1, 2, 3)
+	db.check(t, 3, false, "up 1", "up 2", "up 3")
+
+	// Once everything is applied there is nothing more to do.
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, "second up", applied)
+
+	reverted, err := m.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, "down 2", reverted, 3, 2)
+	db.check(t, 1, false, "up 1", "up 2", "up 3", "down 3", "down 2")
+
+	// Rolling back more migrations than are applied stops at the first one, which leaves no version recorded.
+	reverted, err = m.Down(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, "down 5", reverted, 1)
+	db.check(t, 0, false, "up 1", "up 2", "up 3", "down 3", "down 2", "down 1")
+	if db.recorded {
+		t.Error("got a version recorded; want none")
+	}
+
+	_, err = m.Down(ctx, 1)
+	if !errors.Is(err, ErrNoChange) {
+		t.Errorf("got error %v; want ErrNoChange", err)
+	}
+}
+
+func TestUpFromVersion(t *testing.T) {
+	m, db := newTestMigrator(t, 1, 2, 5)
+	db.version, db.recorded = 2, true
+
+	applied, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, "up", applied, 5)
+	db.check(t, 5, false, "up 5")
+}
+
+func TestDownUnknownVersion(t *testing.T) {
+	m, db := newTestMigrator(t, 1, 2)
+	db.version, db.recorded = 3, true
+
+	_, err := m.Down(context.Background(), 1)
+	if err == nil || errors.Is(err, ErrNoChange) {
+		t.Errorf("got error %v; want an error for the missing migration file", err)
+	}
+	db.check(t, 3, false)
+}
+
+// TestUpFailure checks that a migration which fails is rolled back without leaving the schema dirty, and that the migrations before it stay applied.
+func TestUpFailure(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t, 1, 2, 3)
+	db.failExec = "up 2"
+
+	applied, err := m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "migration 2_migration") {
+		t.Fatalf("got error %v; want an error for migration 2", err)
+	}
+	checkVersions(t, "up", applied, 1)
+	db.check(t, 1, false, "up 1")
+
+	db.failExec = ""
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, "retried up", applied, 2, 3)
+	db.check(t, 3, false, "up 1", "up 2", "up 3")
+}
+
+// TestDirty checks that a migration whose outcome isnt known leaves the schema dirty, and that nothing more runs until the version is forced.
+func TestDirty(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t, 1, 2, 3)
+	db.failCommit = "up 2"
+
+	applied, err := m.Up(ctx)
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	checkVersions(t, "up", applied, 1)
+	db.check(t, 2, true, "up 1")
+
+	db.failCommit = ""
+
+	_, err = m.Up(ctx)
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("up: got error %v; want ErrDirty", err)
+	}
+	_, err = m.Down(ctx, 1)
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("down: got error %v; want ErrDirty", err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 2 || !status.Dirty {
+		t.Errorf("got status version %d dirty %v; want version 2 dirty", status.Version, status.Dirty)
+	}
+
+	// Once the schema has been checked, forcing it to the version it is really at lets the migrations carry on.
+	err = m.Force(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, "up after force", applied, 2, 3)
+	db.check(t, 3, false, "up 1", "up 2", "up 3")
+}
+
+func TestForce(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t, 1, 2)
+
+	if err := m.Force(ctx, 3); err == nil {
+		t.Error("got no error forcing a version without a migration")
+	}
+
+	if err := m.Force(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	db.check(t, 2, false)
+
+	if err := m.Force(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	db.check(t, 0, false)
+	if db.recorded {
+		t.Error("got a version recorded; want none")
+	}
+}
+
+// newTestMigrator returns a Migrator for migrations with the given versions, whose SQL is "up N" and "down N", running against a fake database.
+func newTestMigrator(t *testing.T, versions ...int64) (*Migrator, *fakeDB) {
+	db := &fakeDB{}
+
+	m := &Migrator{db: sql.OpenDB(fakeConnector{db})}
+	t.Cleanup(func() { m.db.Close() })
+
+	for _, version := range versions {
+		m.migrations = append(m.migrations, Migration{
+			Version: version,
+			Name:    "migration",
+			Up:      "up " + strconv.FormatInt(version, 10),
+			Down:    "down " + strconv.FormatInt(version, 10),
+		})
+	}
+
+	return m, db
+}
+
+func checkVersions(t *testing.T, name string, migrations []Migration, want ...int64) {
+	t.Helper()
+
+	var got []int64
+	for _, migration := range migrations {
+		got = append(got, migration.Version)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got migrations %v; want %v", name, got, want)
+	}
+}
+
+// fakeDB stands in for a PostgreSQL database. It keeps the row in the schema_migrations table and the migrations which have been run, and supports
+// transactions by putting them back as they were on a rollback.
+type fakeDB struct {
+	mu sync.Mutex
+
+	recorded bool
+	version  int64
+	dirty    bool
+	executed []string
+
+	// failExec makes running that migration fail, and failCommit makes committing the transaction which ran it fail.
+	failExec   string
+	failCommit string
+}
+
+func (db *fakeDB) check(t *testing.T, version int64, dirty bool, executed ...string) {
+	t.Helper()
+
+	if db.version != version || db.dirty != dirty {
+		t.Errorf("got version %d dirty %v; want version %d dirty %v", db.version, db.dirty, version, dirty)
+	}
+	if !reflect.DeepEqual(db.executed, executed) {
+		t.Errorf("got migrations run %q; want %q", db.executed, executed)
+	}
+}
+
+type fakeConnector struct {
+	db *fakeDB
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+	tx *fakeTx
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.tx = &fakeTx{conn: c, recorded: c.db.recorded, version: c.db.version, dirty: c.db.dirty, executed: len(c.db.executed)}
+	return c.tx, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_"), strings.Contains(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case query == "DELETE FROM schema_migrations":
+		c.db.recorded, c.db.version, c.db.dirty = false, 0, false
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		c.db.recorded, c.db.version, c.db.dirty = true, args[0].Value.(int64), args[1].Value.(bool)
+	case query == c.db.failExec:
+		return nil, errors.New("syntax error")
+	default:
+		c.db.executed = append(c.db.executed, query)
+		if c.tx != nil && query == c.db.failCommit {
+			c.tx.failCommit = true
+		}
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	if query != "SELECT version, dirty FROM schema_migrations LIMIT 1" {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	rows := &fakeRows{}
+	if c.db.recorded {
+		rows.values = [][]driver.Value{{c.db.version, c.db.dirty}}
+	}
+	return rows, nil
+}
+
+type fakeTx struct {
+	conn       *fakeConn
+	recorded   bool
+	version    int64
+	dirty      bool
+	executed   int
+	failCommit bool
+}
+
+func (tx *fakeTx) Commit() error {
+	if tx.failCommit {
+		tx.Rollback()
+		return errors.New("connection reset")
+	}
+
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	db := tx.conn.db
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.recorded, db.version, db.dirty, db.executed = tx.recorded, tx.version, tx.dirty, db.executed[:tx.executed]
+	tx.conn.tx = nil
+	return nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"version", "dirty"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
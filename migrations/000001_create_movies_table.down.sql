@@ -1 +1 @@
-DROPS TABLE IF EXISTS movies;
+DROP TABLE IF EXISTS movies;
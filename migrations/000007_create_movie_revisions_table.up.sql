@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+    id          bigserial    PRIMARY KEY,
+    movie_id    bigint       NOT NULL,
+    version     integer      NOT NULL,
+    action      text         NOT NULL,
+    title       text         NOT NULL,
+    year        integer      NOT NULL,
+    runtime     integer      NOT NULL,
+    genres      text[]       NOT NULL,
+    user_id     bigint       REFERENCES users ON DELETE SET NULL,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS movie_revisions_movie_version_idx ON movie_revisions (movie_id, version) WHERE action <> 'delete';
+
+INSERT INTO movie_revisions (movie_id, version, action, title, year, runtime, genres)
+SELECT id, version, CASE WHEN version = 1 THEN 'create' ELSE 'update' END, title, year, runtime, genres
+FROM movies;
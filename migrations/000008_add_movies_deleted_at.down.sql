@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE code = 'movies:purge';
+
+UPDATE movie_revisions SET action = 'delete' WHERE action = 'purge';
+DROP INDEX IF EXISTS movie_revisions_movie_version_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS movie_revisions_movie_version_idx ON movie_revisions (movie_id, version) WHERE action <> 'delete';
+
+DROP INDEX IF EXISTS movies_deleted_at_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,9 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx ON movies (deleted_at) WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS movie_revisions_movie_version_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS movie_revisions_movie_version_idx ON movie_revisions (movie_id, version) WHERE action NOT IN ('delete', 'purge');
+
+INSERT INTO permissions (code)
+VALUES
+    ('movies:purge');
@@ -0,0 +1,59 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    slug text NOT NULL UNIQUE,
+    name text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- Start with a standard vocabulary. This list is mirrored by defaultGenres in the in-memory store.
+INSERT INTO genres (slug, name, aliases)
+VALUES
+    ('action', 'Action', '{}'),
+    ('adventure', 'Adventure', '{}'),
+    ('animation', 'Animation', '{animated}'),
+    ('comedy', 'Comedy', '{}'),
+    ('crime', 'Crime', '{}'),
+    ('documentary', 'Documentary', '{}'),
+    ('drama', 'Drama', '{}'),
+    ('family', 'Family', '{}'),
+    ('fantasy', 'Fantasy', '{}'),
+    ('history', 'History', '{historical}'),
+    ('horror', 'Horror', '{}'),
+    ('music', 'Music', '{musical}'),
+    ('mystery', 'Mystery', '{}'),
+    ('romance', 'Romance', '{romantic}'),
+    ('science-fiction', 'Science Fiction', '{sci-fi,scifi,sf}'),
+    ('thriller', 'Thriller', '{}'),
+    ('war', 'War', '{}'),
+    ('western', 'Western', '{}')
+ON CONFLICT (slug) DO NOTHING;
+
+-- Add any other genres which are already used by movies, using the same slugs as GenreSlug() in the data package.
+WITH used AS (
+    SELECT DISTINCT genre, trim(both '-' from regexp_replace(lower(genre), '[^[:alnum:]]+', '-', 'g')) AS slug
+    FROM movies, unnest(genres) AS genre
+)
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (slug) slug, initcap(genre)
+FROM used
+WHERE slug <> '' AND NOT EXISTS (SELECT 1 FROM genres WHERE genres.slug = used.slug OR used.slug = ANY(genres.aliases))
+ORDER BY slug, genre;
+
+-- Rewrite the genres of every movie to the canonical slugs, keeping their order and dropping any duplicates this creates.
+UPDATE movies
+SET genres = ARRAY(
+    SELECT slug
+    FROM (
+        SELECT DISTINCT ON (genres.slug) genres.slug, used.ord
+        FROM unnest(movies.genres) WITH ORDINALITY AS used(genre, ord)
+        INNER JOIN genres ON trim(both '-' from regexp_replace(lower(used.genre), '[^[:alnum:]]+', '-', 'g')) = ANY(genres.slug || genres.aliases)
+        ORDER BY genres.slug, used.ord
+    ) AS canonical
+    ORDER BY ord
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('genres:write');
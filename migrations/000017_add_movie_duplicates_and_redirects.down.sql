@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS movie_redirects;
+
+DROP INDEX IF EXISTS movies_normalized_title_trgm_idx;
+DROP INDEX IF EXISTS movies_normalized_title_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS normalized_title;
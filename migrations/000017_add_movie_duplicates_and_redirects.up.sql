@@ -0,0 +1,16 @@
+-- The normalized title is used to spot probable duplicates. It must match NormalizeTitle() in the data package: the title is lowercased, every run of
+-- characters other than letters and digits becomes a single space, and a leading article is dropped.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS normalized_title text GENERATED ALWAYS AS (
+    regexp_replace(btrim(regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g')), '^(the|a|an) ', '')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_normalized_title_idx ON movies (normalized_title, year) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS movies_normalized_title_trgm_idx ON movies USING GIN (normalized_title gin_trgm_ops);
+
+-- When a movie is merged into another, its id is redirected to the movie that it was merged into.
+CREATE TABLE IF NOT EXISTS movie_redirects (
+    movie_id bigint PRIMARY KEY,
+    target_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS movie_redirects_target_id_idx ON movie_redirects (target_id);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS movie_release_dates;
+
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_year_check;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_status_check;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS status;
+ALTER TABLE movies DROP COLUMN IF EXISTS status;
+
+-- Movies which were announced for a future year would fail the old check, so it is only applied to new rows.
+ALTER TABLE movies ADD CONSTRAINT movies_year_check CHECK (year BETWEEN 1888 AND date_part('year', now())) NOT VALID;
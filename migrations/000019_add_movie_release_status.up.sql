@@ -0,0 +1,25 @@
+-- Every movie catalogued before release statuses existed has been released, so the existing rows are backfilled with 'released'. New rows must always
+-- give a status.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'released';
+ALTER TABLE movies ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'released';
+ALTER TABLE movie_revisions ALTER COLUMN status DROP DEFAULT;
+
+-- Only released movies have to be from this year or earlier. The others can be announced for up to 10 years ahead, which must match maxAnnouncedYears in
+-- the data package.
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_year_check;
+ALTER TABLE movies ADD CONSTRAINT movies_status_check CHECK (status IN ('announced', 'in_production', 'released', 'cancelled'));
+ALTER TABLE movies ADD CONSTRAINT movies_year_check CHECK (
+    year >= 1888 AND year <= date_part('year', now()) + CASE WHEN status = 'released' THEN 0 ELSE 10 END
+);
+
+CREATE INDEX IF NOT EXISTS movies_status_idx ON movies (status) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS movie_release_dates (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    region text NOT NULL CHECK (region ~ '^[A-Z]{2}$'),
+    release_date date NOT NULL,
+    PRIMARY KEY (movie_id, region)
+);
+
+CREATE INDEX IF NOT EXISTS movie_release_dates_release_date_idx ON movie_release_dates (release_date);
@@ -0,0 +1,2 @@
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS external_ids;
+ALTER TABLE movie_revisions DROP COLUMN IF EXISTS release_dates;
@@ -0,0 +1,13 @@
+-- Revisions recorded before this migration didnt keep the release dates and external IDs of the movie, so they are left NULL, and reverting to one of them
+-- leaves the movie's current release dates and external IDs as they are. The latest revision of each movie is the movie as it is now, so it is backfilled.
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS release_dates jsonb;
+ALTER TABLE movie_revisions ADD COLUMN IF NOT EXISTS external_ids jsonb;
+
+UPDATE movie_revisions
+SET release_dates = COALESCE((
+        SELECT jsonb_object_agg(region, to_char(release_date, 'YYYY-MM-DD')) FROM movie_release_dates WHERE movie_id = movie_revisions.movie_id
+    ), '{}'),
+    external_ids = COALESCE((
+        SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = movie_revisions.movie_id
+    ), '{}')
+WHERE id IN (SELECT max(id) FROM movie_revisions GROUP BY movie_id) AND movie_id IN (SELECT id FROM movies);
@@ -0,0 +1,10 @@
+package migrations
+
+import (
+	"embed"
+)
+
+// Files holds the SQL migration files in this directory, so that they can be compiled into the api binary and applied without the external migrate tool.
+//
+//go:embed *.sql
+var Files embed.FS